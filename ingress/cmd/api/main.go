@@ -14,8 +14,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/go-chi/httprate"
+	"github.com/orchard9/trellis/ingress/internal/attribution"
 	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/clientip"
 	"github.com/orchard9/trellis/ingress/internal/ingestion"
+	"github.com/orchard9/trellis/ingress/internal/ipintel"
+	"github.com/orchard9/trellis/ingress/internal/logging"
+	"github.com/orchard9/trellis/ingress/internal/partners"
+	"github.com/orchard9/trellis/ingress/internal/ratelimit"
+	"github.com/orchard9/trellis/ingress/internal/telemetry"
+	"github.com/orchard9/trellis/ingress/internal/tracking"
 	"github.com/orchard9/trellis/ingress/pkg/config"
 )
 
@@ -30,6 +39,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Apply log level, format and sampling
+	if err := logging.Setup(os.Stderr, logging.Config{
+		Level:            cfg.LogLevel,
+		Format:           cfg.LogFormat,
+		SampleInitial:    cfg.LogSampleInitial,
+		SampleThereafter: cfg.LogSampleThereafter,
+	}); err != nil {
+		slog.Error("failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize tracing before anything that starts spans
+	shutdownTracing, err := telemetry.SetupTracing(ctx, telemetry.TracingConfig{
+		Exporter:     cfg.Tracing.Exporter,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+		ServiceName:  cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize Warden client for authentication
 	wardenClient, err := auth.NewWardenClient(cfg.GetWardenAddress())
 	if err != nil {
@@ -38,20 +71,156 @@ func main() {
 	}
 	defer wardenClient.Close()
 
+	// Resolve client IPs through trusted proxies only
+	clientIPs, err := clientip.NewResolver(cfg.GetTrustedProxies())
+	if err != nil {
+		slog.Error("failed to parse trusted proxies", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize visitor tracking
+	idGenerator, err := tracking.NewIDGenerator(int64(cfg.Tracking.NodeID))
+	if err != nil {
+		slog.Error("failed to create ID generator", "error", err)
+		os.Exit(1)
+	}
+	tracker := tracking.NewTracker(
+		idGenerator,
+		nil,
+		cfg.Tracking.CookieSecret,
+		cfg.Tracking.CookieDomain,
+		time.Duration(cfg.Tracking.CookieMaxAgeDays)*24*time.Hour,
+		time.Duration(cfg.Tracking.FingerprintWindowMinutes)*time.Minute,
+		cfg.IsProduction(),
+	)
+	sessionizer := tracking.NewSessionizer(nil, idGenerator, time.Duration(cfg.Tracking.SessionTimeoutMinutes)*time.Minute)
+
+	// Initialize deduplication and fraud detection
+	redisTimeout := time.Duration(cfg.Fraud.RedisTimeoutMs) * time.Millisecond
+	datacenterASNs, err := cfg.GetDatacenterASNs()
+	if err != nil {
+		slog.Error("failed to parse datacenter ASNs", "error", err)
+		os.Exit(1)
+	}
+	dedup := ingestion.NewDeduplicator(nil, redisTimeout)
+	clickRetention := time.Duration(cfg.Fraud.ClickRetentionDays) * 24 * time.Hour
+	clicks := ingestion.NewClickIndex(nil, clickRetention, redisTimeout)
+	postbacks := ingestion.NewPostbackStore(nil, nil, clickRetention, redisTimeout)
+	bots := ingestion.NewBotDetector(nil, time.Duration(cfg.Fraud.BotVerifyTimeoutMs)*time.Millisecond)
+	if cfg.Fraud.BotListFile != "" {
+		if err := bots.LoadFile(cfg.Fraud.BotListFile); err != nil {
+			slog.Error("failed to load bot list", "error", err)
+			os.Exit(1)
+		}
+	}
+	ipListFiles, err := cfg.GetIPListFiles()
+	if err != nil {
+		slog.Error("failed to parse IP list files", "error", err)
+		os.Exit(1)
+	}
+	ipIntel, err := ipintel.NewIntel(nil, ipListFiles, time.Duration(cfg.Fraud.IPListRefreshMinutes)*time.Minute)
+	if err != nil {
+		slog.Error("failed to load IP lists", "error", err)
+		os.Exit(1)
+	}
+	velocity := ingestion.NewVelocityDetector(nil,
+		time.Duration(cfg.Fraud.VelocityWindowSeconds)*time.Second,
+		int64(cfg.Fraud.MaxClicksPerIP),
+		int64(cfg.Fraud.MaxClicksPerVisitor),
+		redisTimeout)
+	conversionTiming := ingestion.NewConversionTimingDetector(time.Duration(cfg.Fraud.MinConversionSeconds) * time.Second)
+	fraud := ingestion.NewFraudChain(
+		&ingestion.DuplicateDetector{Weight: 0.3},
+		&ingestion.SpoofedCrawlerDetector{},
+		&ingestion.UserAgentDetector{},
+		&ingestion.AcceptLanguageDetector{},
+		ingestion.NewASNDetector(cfg.Fraud.ASNHeader, datacenterASNs),
+		ingestion.NewIPReputationDetector(ingestion.DefaultIPListWeights),
+		velocity,
+		conversionTiming,
+		&ingestion.RateLimitDetector{},
+	)
+
+	// Initialize postback partners
+	partnerRegistry := partners.NewRegistry(nil)
+	partnerAuth := partners.NewAuthenticator(partnerRegistry, time.Duration(cfg.Postback.SignatureMaxSkewSeconds)*time.Second)
+
+	// Initialize metrics, exported to Prometheus on their own listener
+	var metrics ingestion.Metrics = ingestion.NewSimpleMetrics()
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled {
+		promMetrics := ingestion.NewPrometheusMetrics(cfg.Metrics.MaxOrganizations)
+		metrics = promMetrics
+
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promMetrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:         fmt.Sprintf(":%d", cfg.Metrics.Port),
+			Handler:      metricsMux,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+		go func() {
+			slog.Info("starting metrics server", "port", cfg.Metrics.Port)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics server error", "error", err)
+			}
+		}()
+	}
+
+	// Initialize outbound postback forwarding
+	forwarder := ingestion.NewForwarder(nil, nil, metrics, ingestion.ForwarderConfig{
+		MaxAttempts:  cfg.Postback.ForwardMaxAttempts,
+		Timeout:      time.Duration(cfg.Postback.ForwardTimeoutMs) * time.Millisecond,
+		Backoff:      time.Duration(cfg.Postback.ForwardBackoffSeconds) * time.Second,
+		MaxBackoff:   time.Duration(cfg.Postback.ForwardMaxBackoffMinutes) * time.Minute,
+		Workers:      cfg.Postback.ForwardWorkers,
+		AllowPrivate: cfg.Postback.ForwardAllowPrivate,
+	})
+	forwarderDone := make(chan struct{})
+	go func() {
+		forwarder.Run(ctx)
+		close(forwarderDone)
+	}()
+
+	// Initialize layered rate limits
+	plans, err := rateLimitPlans(cfg)
+	if err != nil {
+		slog.Error("failed to parse rate limit plans", "error", err)
+		os.Exit(1)
+	}
+	// Initialize campaign routing and per-organization settings
+	routing, err := ingestion.NewRoutingEngine(nil, ingestion.DefaultOrganizationSettings())
+	if err != nil {
+		slog.Error("failed to create routing engine", "error", err)
+		os.Exit(1)
+	}
+
+	// Organization plans come from their settings
+	limiter := ratelimit.NewLimiter(nil,
+		time.Duration(cfg.RateLimit.WindowSeconds)*time.Second,
+		time.Duration(cfg.RateLimit.RedisTimeoutMs)*time.Millisecond,
+		plans, cfg.RateLimit.DefaultPlan, func(organizationID string) string {
+			return routing.OrganizationSettings(organizationID).Plan
+		})
+
 	// Initialize ingestion components (placeholders for now)
-	metrics := ingestion.NewSimpleMetrics()
-	
 	// TODO: Initialize actual pubsub, redis, clickhouse clients
 	// For now, we'll use nil values and implement proper initialization later
-	handler := ingestion.NewHandler(nil, nil, nil, metrics)
+	handler := ingestion.NewHandler(nil, routing, metrics, tracker, sessionizer, idGenerator, dedup, clicks, fraud, bots, ipIntel, postbacks, forwarder)
+
+	// Retroactive attribution, re-run when campaign rules change
+	attributor := attribution.NewAttributor(nil, routing)
+	go attributor.Watch(ctx, time.Minute)
 
 	// Setup HTTP router
 	r := chi.NewRouter()
 
 	// Middleware stack
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(telemetry.Middleware)
+	r.Use(clientIPs.Middleware)
+	r.Use(logging.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Use(middleware.Compress(5))
@@ -82,16 +251,25 @@ func main() {
 	r.Group(func(r chi.Router) {
 		r.Use(wardenClient.AuthenticationMiddleware)
 
-		// Main ingestion endpoints
-		r.HandleFunc("/in", handler.HandleTraffic)
-		r.HandleFunc("/in/{campaign_id}", handler.HandleTraffic)
-		r.Get("/pixel.gif", handler.HandlePixel)
-		r.HandleFunc("/postback", handler.HandlePostback)
+		// Main ingestion endpoints; clicks over their rate limit still redirect, flagged
+		r.Group(func(r chi.Router) {
+			r.Use(limiter.Flag)
+			r.HandleFunc("/in", handler.HandleTraffic)
+			r.HandleFunc("/in/{campaign_id}", handler.HandleTraffic)
+			r.Get("/pixel.gif", handler.HandlePixel)
+		})
+		r.With(limiter.Reject).HandleFunc("/postback", handler.HandlePostback)
 	})
 
+	// Partner postbacks authenticate with per-partner credentials instead of an API key
+	r.With(partnerAuth.Middleware, limiter.Reject).HandleFunc("/postback/{partner_id}", handler.HandlePostback)
+
 	// API routes (require authentication)
 	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(httprate.Limit(cfg.RateLimit.APIRequestsPerMinute, time.Minute,
+			httprate.WithKeyFuncs(ratelimit.KeyByClientIP)))
 		r.Use(wardenClient.AuthenticationMiddleware)
+		r.Use(limiter.Reject)
 
 		// Health endpoint
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -114,6 +292,42 @@ func main() {
 				response["status"], response["service"], response["organization_id"], response["timestamp"])
 		})
 
+		// Organization IP allow and deny lists
+		r.Route("/ip-lists", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			ipintel.NewAPI(ipIntel).Routes(r)
+		})
+
+		// Postback partners and their credentials
+		r.Route("/partners", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			partners.NewAPI(partnerRegistry, cfg.Postback.BaseURL).Routes(r)
+		})
+
+		// Organization ingestion settings
+		r.Route("/settings", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			ingestion.NewSettingsAPI(routing).Routes(r)
+		})
+
+		// Retroactive campaign attribution
+		r.Route("/attribution", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			attribution.NewAPI(attributor, routing).Routes(r)
+		})
+
+		// Routing diagnostics
+		r.Route("/routing", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			ingestion.NewRoutingAPI(handler).Routes(r)
+		})
+
+		// Outbound postback delivery log and replays
+		r.Route("/postback-deliveries", func(r chi.Router) {
+			r.Use(wardenClient.RequirePermission("settings:write"))
+			ingestion.NewDeliveryAPI(forwarder).Routes(r)
+		})
+
 		// TODO: Add campaign management endpoints
 		// r.Route("/campaigns", func(r chi.Router) {
 		//     r.Get("/", listCampaigns)
@@ -142,6 +356,16 @@ func main() {
 		}
 	}()
 
+	// Reload safe settings on SIGHUP without restarting the listeners
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		current := cfg
+		for range reloadChan {
+			current = reloadConfig(current, limiter, velocity, conversionTiming)
+		}
+	}()
+
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -160,6 +384,67 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		slog.Error("server shutdown error", "error", err)
 	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("metrics server shutdown error", "error", err)
+		}
+	}
+
+	// Stop claiming outbound postbacks and let in-flight ones finish, up to
+	// the shutdown timeout; unfinished ones are retried after their lease
+	cancel()
+	select {
+	case <-forwarderDone:
+	case <-shutdownCtx.Done():
+	}
+
+	// Flush pending spans
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("tracing shutdown error", "error", err)
+	}
 
 	slog.Info("ingress server stopped")
-}
\ No newline at end of file
+}
+
+// rateLimitPlans converts the configured rate limit plans
+func rateLimitPlans(cfg *config.Config) (map[string]ratelimit.Plan, error) {
+	ratePlans, err := cfg.GetRateLimitPlans()
+	if err != nil {
+		return nil, err
+	}
+	plans := make(map[string]ratelimit.Plan, len(ratePlans))
+	for name, plan := range ratePlans {
+		plans[name] = ratelimit.Plan(plan)
+	}
+	return plans, nil
+}
+
+// reloadConfig re-reads the configuration and applies the settings that
+// can change at runtime, returning the configuration now in effect. On
+// error the current configuration stays in effect.
+func reloadConfig(current *config.Config, limiter *ratelimit.Limiter, velocity *ingestion.VelocityDetector, conversionTiming *ingestion.ConversionTimingDetector) *config.Config {
+	next, err := config.Load()
+	if err != nil {
+		slog.Error("failed to reload config, keeping current settings", "error", err)
+		return current
+	}
+	plans, err := rateLimitPlans(next)
+	if err != nil {
+		slog.Error("failed to reload config, keeping current settings", "error", err)
+		return current
+	}
+
+	if err := logging.SetLevel(next.LogLevel); err != nil {
+		slog.Error("failed to reload config, keeping current settings", "error", err)
+		return current
+	}
+	limiter.SetPlans(plans, next.RateLimit.DefaultPlan)
+	velocity.SetLimits(int64(next.Fraud.MaxClicksPerIP), int64(next.Fraud.MaxClicksPerVisitor))
+	conversionTiming.SetMinDelay(time.Duration(next.Fraud.MinConversionSeconds) * time.Second)
+
+	if changed := current.RestartRequired(next); len(changed) > 0 {
+		slog.Warn("config changes take effect after a restart", "settings", changed)
+	}
+	slog.Info("reloaded config")
+	return current.Reloaded(next)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/ingestion"
+	"github.com/orchard9/trellis/ingress/internal/ratelimit"
+	"github.com/orchard9/trellis/ingress/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReloadConfigRateLimitPlans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(plans string) {
+		data := "rate_limit:\n  plans: " + plans + "\n  default_plan: free\n"
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+	t.Setenv("TRELLIS_CONFIG_FILE", path)
+	t.Setenv("RATE_LIMIT_PLANS", "")
+
+	writeConfig("free=1/0/0")
+	current, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	plans, err := rateLimitPlans(current)
+	if err != nil {
+		t.Fatalf("rateLimitPlans() error = %v", err)
+	}
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	limiter := ratelimit.NewLimiter(client, time.Minute, time.Second, plans, current.RateLimit.DefaultPlan, nil)
+	velocity := ingestion.NewVelocityDetector(nil, time.Minute, 30, 10, time.Second)
+	conversionTiming := ingestion.NewConversionTimingDetector(10 * time.Second)
+
+	request := func(ip string) *http.Request {
+		r := httptest.NewRequest("GET", "/in", nil)
+		r.RemoteAddr = ip + ":5000"
+		return r.WithContext(context.WithValue(r.Context(), auth.OrganizationContextKey, &auth.OrganizationContext{OrganizationID: "org"}))
+	}
+
+	limiter.Check(request("203.0.113.7"))
+	if scope := limiter.Check(request("203.0.113.7")); scope != ratelimit.ScopeIP {
+		t.Fatalf("Check() before reload = %q, want %q", scope, ratelimit.ScopeIP)
+	}
+
+	writeConfig("free=100/0/0")
+	current = reloadConfig(current, limiter, velocity, conversionTiming)
+	if current.RateLimit.Plans != "free=100/0/0" {
+		t.Errorf("reloaded plans = %q, want free=100/0/0", current.RateLimit.Plans)
+	}
+	if scope := limiter.Check(request("203.0.113.7")); scope != "" {
+		t.Errorf("Check() after reload = %q, want allowed", scope)
+	}
+
+	// An invalid file keeps the plans in effect
+	writeConfig("free=1/x/0")
+	if kept := reloadConfig(current, limiter, velocity, conversionTiming); kept != current {
+		t.Error("reloadConfig() with invalid plans replaced the config")
+	}
+	limiter.Check(request("198.51.100.1"))
+	if scope := limiter.Check(request("198.51.100.1")); scope != "" {
+		t.Errorf("Check() after invalid reload = %q, want allowed", scope)
+	}
+}
@@ -0,0 +1,55 @@
+// Command postback-stub is a local HTTP receiver for testing outbound
+// postbacks. It logs every request and can fail a share of them to
+// exercise retries:
+//
+//	go run ./cmd/postback-stub -addr :9090 -fail-rate 0.5
+//
+// Point a campaign's outbound postback at http://localhost:9090/... and set
+// POSTBACK_FORWARD_ALLOW_PRIVATE=true on the ingress.
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	failRate := flag.Float64("fail-rate", 0, "share of requests answered with 503 (0-1)")
+	status := flag.Int("status", http.StatusOK, "status code of successful responses")
+	flag.Parse()
+
+	var received atomic.Int64
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n := received.Add(1)
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 64*1024))
+
+		code := *status
+		if rand.Float64() < *failRate {
+			code = http.StatusServiceUnavailable
+		}
+
+		slog.Info("postback received",
+			"n", n,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", r.URL.RawQuery,
+			"content_type", r.Header.Get("Content-Type"),
+			"body", string(body),
+			"response", code)
+
+		w.WriteHeader(code)
+		w.Write([]byte(http.StatusText(code)))
+	})
+
+	slog.Info("postback stub listening", "addr", *addr, "fail_rate", *failRate)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		slog.Error("server error", "error", err)
+		os.Exit(1)
+	}
+}
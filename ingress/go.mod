@@ -26,7 +26,19 @@ require (
 	// Utilities
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+	
+	// Metrics and tracing
+	github.com/prometheus/client_golang v1.19.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.24.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
 	
 	// Logging
 	golang.org/x/exp v0.0.0-20240222234643-814bf88cf225 // for slog
+	
+	// Testing
+	github.com/alicebob/miniredis/v2 v2.33.0
 )
\ No newline at end of file
@@ -0,0 +1,170 @@
+package attribution
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/ingestion"
+)
+
+// API exposes retroactive attribution over HTTP
+type API struct {
+	attributor *Attributor
+	routing    *ingestion.RoutingEngine
+}
+
+// NewAPI creates the attribution API
+func NewAPI(attributor *Attributor, routing *ingestion.RoutingEngine) *API {
+	return &API{attributor: attributor, routing: routing}
+}
+
+// Routes mounts the attribution endpoints:
+//
+//	POST /preview    volume a campaign's rules (or proposed rules) would attribute
+//	POST /runs       attribute a window's events to a campaign under a new version
+//	GET  /runs       list runs (?campaign_id=, ?limit=)
+func (a *API) Routes(r chi.Router) {
+	r.Post("/preview", a.preview)
+	r.Post("/runs", a.run)
+	r.Get("/runs", a.list)
+}
+
+// jobRequest selects the campaign and window of a job
+type jobRequest struct {
+	CampaignID string           `json:"campaign_id"`
+	From       string           `json:"from"` // RFC 3339
+	To         string           `json:"to"`
+	Rules      []ingestion.Rule `json:"rules,omitempty"` // preview only
+	Samples    *int             `json:"samples,omitempty"`
+}
+
+// decodeJob reads a job request and resolves its campaign and window
+func (a *API) decodeJob(w http.ResponseWriter, r *http.Request) (*jobRequest, *ingestion.Campaign, Window, bool) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return nil, nil, Window{}, false
+	}
+
+	var req jobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, nil, Window{}, false
+	}
+
+	var window Window
+	if err := window.From.UnmarshalText([]byte(req.From)); err != nil {
+		http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+		return nil, nil, Window{}, false
+	}
+	if err := window.To.UnmarshalText([]byte(req.To)); err != nil {
+		http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+		return nil, nil, Window{}, false
+	}
+	if err := window.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, Window{}, false
+	}
+
+	campaign := a.routing.GetCampaign(orgCtx.OrganizationID, req.CampaignID)
+	if campaign == nil {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return nil, nil, Window{}, false
+	}
+
+	return &req, campaign, window, true
+}
+
+// preview reports the volume a job would attribute without writing
+func (a *API) preview(w http.ResponseWriter, r *http.Request) {
+	req, campaign, window, ok := a.decodeJob(w, r)
+	if !ok {
+		return
+	}
+
+	samples := 10
+	if req.Samples != nil {
+		if *req.Samples < 0 || *req.Samples > 100 {
+			http.Error(w, "samples must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		samples = *req.Samples
+	}
+
+	preview, err := a.attributor.Preview(r.Context(), campaign, req.Rules, window, samples)
+	if err != nil {
+		a.fail(w, r, err, "Failed to preview attribution")
+		return
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// run attributes events to a campaign
+func (a *API) run(w http.ResponseWriter, r *http.Request) {
+	req, campaign, window, ok := a.decodeJob(w, r)
+	if !ok {
+		return
+	}
+	if req.Rules != nil {
+		http.Error(w, "Runs use the campaign's saved rules", http.StatusBadRequest)
+		return
+	}
+
+	run, err := a.attributor.Run(r.Context(), campaign, window)
+	if err != nil {
+		a.fail(w, r, err, "Failed to run attribution")
+		return
+	}
+	writeJSON(w, http.StatusCreated, run)
+}
+
+// list returns the organization's runs
+func (a *API) list(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 100
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := a.attributor.Runs(r.Context(), orgCtx.OrganizationID, query.Get("campaign_id"), limit)
+	if err != nil {
+		a.fail(w, r, err, "Failed to list attribution runs")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"runs": runs})
+}
+
+// fail writes the error response of a job
+func (a *API) fail(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Attribution is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	slog.ErrorContext(r.Context(), "attribution request failed", "error", err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
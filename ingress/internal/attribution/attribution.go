@@ -0,0 +1,425 @@
+// Package attribution applies campaign rules to stored events, so campaigns
+// created after traffic arrived can claim it. Results are written to a
+// versioned table; events are never mutated.
+package attribution
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/orchard9/trellis/ingress/internal/ingestion"
+	"github.com/orchard9/trellis/ingress/internal/rules"
+)
+
+// ErrNoWarehouse is returned when ClickHouse is not configured
+var ErrNoWarehouse = errors.New("clickhouse is not configured")
+
+// Run states
+const (
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+)
+
+// Match reasons of attributed events
+const (
+	ReasonRecorded = "recorded" // the event was recorded against the campaign at ingest
+	ReasonRules    = "rules"    // the campaign's rules match the event
+)
+
+// Attributor runs retroactive attribution jobs
+type Attributor struct {
+	clickhouse clickhouse.Conn
+	routing    *ingestion.RoutingEngine
+}
+
+// Window is the event time range a job covers, from inclusive to exclusive
+type Window struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Validate checks the window
+func (w Window) Validate() error {
+	if w.From.IsZero() || w.To.IsZero() || !w.From.Before(w.To) {
+		return errors.New("from must be before to")
+	}
+	return nil
+}
+
+// Preview is the volume a campaign's rules would attribute, without writing
+type Preview struct {
+	CampaignID string       `json:"campaign_id"`
+	Window     Window       `json:"window"`
+	Matched    uint64       `json:"matched"`  // events that would be attributed
+	Recorded   uint64       `json:"recorded"` // of those, recorded against the campaign at ingest
+	ByRules    uint64       `json:"by_rules"` // of those, matched by the rules
+	Visitors   uint64       `json:"visitors"`
+	Rules      []RuleVolume `json:"rules"`
+	Samples    []string     `json:"samples"` // event IDs
+}
+
+// RuleVolume is how many events in the window a single rule matches
+type RuleVolume struct {
+	ingestion.Rule
+	Matched uint64 `json:"matched"`
+}
+
+// Run is a versioned attribution job; Version is a unique run ID
+type Run struct {
+	OrganizationID string           `json:"organization_id"`
+	CampaignID     string           `json:"campaign_id"`
+	Version        string           `json:"version"`
+	Rules          []ingestion.Rule `json:"rules"`
+	RulesHash      string           `json:"rules_hash"`
+	Window         Window           `json:"window"`
+	State          string           `json:"state"`
+	Matched        uint64           `json:"matched"`
+	Error          string           `json:"error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// NewAttributor creates an attributor; ch may be nil, in which case every
+// job fails with ErrNoWarehouse
+func NewAttributor(ch clickhouse.Conn, routing *ingestion.RoutingEngine) *Attributor {
+	return &Attributor{clickhouse: ch, routing: routing}
+}
+
+// RulesHash identifies a rule set so runs can be compared with current rules
+func RulesHash(rules []ingestion.Rule) string {
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// matchQuery is the shared source of every job: the organization's clicks
+// in the window that were recorded against the campaign or match its rules.
+// The select list is written between the WITH clause and FROM.
+type matchQuery struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+// newMatchQuery starts a query over events with rule_score bound to the
+// campaign's score expression
+func (a *Attributor) newMatchQuery(campaign *ingestion.Campaign, ruleSet []ingestion.Rule) *matchQuery {
+	timezone := a.routing.OrganizationSettings(campaign.OrganizationID).Timezone
+	score := rules.CompileSet(ruleSet).ScoreSQL(ingestion.EventColumns(timezone))
+
+	q := &matchQuery{}
+	q.sql.WriteString("WITH " + score.SQL + " AS rule_score, ifNull(campaign_id, '') = ? AS recorded\n")
+	q.args = append(q.args, score.Args...)
+	q.args = append(q.args, campaign.OrganizationID+"/"+campaign.CampaignID)
+	return q
+}
+
+// selectList writes the select list and its arguments
+func (q *matchQuery) selectList(sql string, args ...interface{}) *matchQuery {
+	q.sql.WriteString("SELECT " + sql + "\n")
+	q.args = append(q.args, args...)
+	return q
+}
+
+// from writes the filters; extra is an additional condition
+func (q *matchQuery) from(organizationID string, window Window, extra string, args ...interface{}) *matchQuery {
+	q.sql.WriteString(`FROM events
+WHERE organization_id = ?
+  AND event_type = 'click'
+  AND event_time >= ? AND event_time < ?
+  AND (recorded OR rule_score > 0)` + "\n")
+	q.args = append(q.args, organizationID, window.From, window.To)
+	if extra != "" {
+		q.sql.WriteString("  AND " + extra + "\n")
+		q.args = append(q.args, args...)
+	}
+	return q
+}
+
+// Preview reports what attributing the rules to the campaign would match.
+// ruleSet overrides the campaign's own when non-nil, to try changes first.
+func (a *Attributor) Preview(ctx context.Context, campaign *ingestion.Campaign, ruleSet []ingestion.Rule, window Window, samples int) (*Preview, error) {
+	if a.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+	if ruleSet == nil {
+		ruleSet = campaign.Rules
+	}
+
+	columns := ingestion.EventColumns(a.routing.OrganizationSettings(campaign.OrganizationID).Timezone)
+	preview := &Preview{
+		CampaignID: campaign.CampaignID,
+		Window:     window,
+		Rules:      make([]RuleVolume, len(ruleSet)),
+		Samples:    []string{},
+	}
+
+	// One countIf per rule, so the volume of each is visible
+	list := "count(), countIf(recorded), countIf(rule_score > 0), uniqExact(user_id)"
+	var listArgs []interface{}
+	for i, rule := range ruleSet {
+		condition := rules.Compile(rule)
+		expr := condition.SQL(columns)
+		list += fmt.Sprintf(", countIf(%s) AS rule_%d", expr.SQL, i)
+		listArgs = append(listArgs, expr.Args...)
+		preview.Rules[i].Rule = rule
+	}
+
+	q := a.newMatchQuery(campaign, ruleSet).selectList(list, listArgs...).from(campaign.OrganizationID, window, "")
+	dest := []interface{}{&preview.Matched, &preview.Recorded, &preview.ByRules, &preview.Visitors}
+	for i := range preview.Rules {
+		dest = append(dest, &preview.Rules[i].Matched)
+	}
+	if err := a.clickhouse.QueryRow(ctx, q.sql.String(), q.args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to preview attribution: %w", err)
+	}
+
+	if samples > 0 {
+		q := a.newMatchQuery(campaign, ruleSet).selectList("toString(event_id)").from(campaign.OrganizationID, window, "")
+		q.sql.WriteString("ORDER BY event_time DESC\nLIMIT ?")
+		q.args = append(q.args, samples)
+
+		rows, err := a.clickhouse.Query(ctx, q.sql.String(), q.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample attribution: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var eventID string
+			if err := rows.Scan(&eventID); err != nil {
+				return nil, fmt.Errorf("failed to scan sample: %w", err)
+			}
+			preview.Samples = append(preview.Samples, eventID)
+		}
+	}
+
+	return preview, nil
+}
+
+// Run attributes the window's events to the campaign under a new version.
+// Earlier versions stay in place; readers use the latest completed one.
+func (a *Attributor) Run(ctx context.Context, campaign *ingestion.Campaign, window Window) (*Run, error) {
+	if a.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+
+	now := time.Now()
+	run := &Run{
+		OrganizationID: campaign.OrganizationID,
+		CampaignID:     campaign.CampaignID,
+		Version:        uuid.New().String(),
+		Rules:          campaign.Rules,
+		RulesHash:      RulesHash(campaign.Rules),
+		Window:         window,
+		State:          StateRunning,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := a.saveRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	slog.Info("attribution run started",
+		"organization_id", run.OrganizationID,
+		"campaign_id", run.CampaignID,
+		"version", run.Version)
+
+	q := a.newMatchQuery(campaign, campaign.Rules).selectList(`
+			organization_id, ?, ?, event_id, event_time, click_id,
+			if(recorded, ?, ?), rule_score, now64(3)`,
+		campaign.CampaignID, run.Version, ReasonRecorded, ReasonRules).
+		from(campaign.OrganizationID, window, "")
+	insert := `
+		INSERT INTO campaign_attributions (
+			organization_id, campaign_id, version, event_id, event_time,
+			click_id, match_reason, score, attributed_at
+		)
+	` + q.sql.String()
+
+	runErr := a.clickhouse.Exec(ctx, insert, q.args...)
+	if runErr == nil {
+		runErr = a.clickhouse.QueryRow(ctx, `
+			SELECT count()
+			FROM campaign_attributions
+			WHERE organization_id = ? AND campaign_id = ? AND version = ?
+		`, run.OrganizationID, run.CampaignID, run.Version).Scan(&run.Matched)
+	}
+
+	run.State = StateCompleted
+	if runErr != nil {
+		run.State = StateFailed
+		run.Error = runErr.Error()
+	}
+	run.UpdatedAt = time.Now()
+	if err := a.saveRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	if runErr != nil {
+		return run, fmt.Errorf("failed to attribute events: %w", runErr)
+	}
+
+	slog.Info("attribution run completed",
+		"organization_id", run.OrganizationID,
+		"campaign_id", run.CampaignID,
+		"version", run.Version,
+		"matched", run.Matched)
+	return run, nil
+}
+
+// saveRun stores the run's current state
+func (a *Attributor) saveRun(ctx context.Context, run *Run) error {
+	rulesJSON, err := json.Marshal(run.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rules: %w", err)
+	}
+
+	err = a.clickhouse.Exec(ctx, `
+		INSERT INTO attribution_runs (
+			organization_id, campaign_id, version, rules, rules_hash,
+			window_from, window_to, state, matched, error, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		run.OrganizationID,
+		run.CampaignID,
+		run.Version,
+		string(rulesJSON),
+		run.RulesHash,
+		run.Window.From,
+		run.Window.To,
+		run.State,
+		run.Matched,
+		run.Error,
+		run.CreatedAt,
+		run.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save attribution run: %w", err)
+	}
+	return nil
+}
+
+// Runs lists an organization's attribution runs, newest first; campaignID
+// narrows them to one campaign when non-empty
+func (a *Attributor) Runs(ctx context.Context, organizationID, campaignID string, limit int) ([]Run, error) {
+	if a.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+
+	rows, err := a.clickhouse.Query(ctx, `
+		SELECT
+			organization_id, campaign_id, version, rules, rules_hash,
+			window_from, window_to, state, matched, error, created_at, updated_at
+		FROM attribution_runs FINAL
+		WHERE organization_id = ?
+		  AND (? = '' OR campaign_id = ?)
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, organizationID, campaignID, campaignID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attribution runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		var run Run
+		var rulesJSON string
+		err := rows.Scan(
+			&run.OrganizationID,
+			&run.CampaignID,
+			&run.Version,
+			&rulesJSON,
+			&run.RulesHash,
+			&run.Window.From,
+			&run.Window.To,
+			&run.State,
+			&run.Matched,
+			&run.Error,
+			&run.CreatedAt,
+			&run.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attribution run: %w", err)
+		}
+		if err := json.Unmarshal([]byte(rulesJSON), &run.Rules); err != nil {
+			slog.Warn("invalid attribution run rules", "campaign_id", run.CampaignID, "error", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Watch re-runs completed attributions whose campaign rules changed since,
+// over the same window start up to now, every interval until ctx is done
+func (a *Attributor) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.clickhouse == nil {
+				continue
+			}
+			if err := a.rerunStale(ctx); err != nil {
+				slog.Error("failed to re-run stale attributions", "error", err)
+			}
+		}
+	}
+}
+
+// rerunStale re-runs the latest completed run of each campaign whose
+// current rules hash differs from the run's
+func (a *Attributor) rerunStale(ctx context.Context) error {
+	rows, err := a.clickhouse.Query(ctx, `
+		SELECT organization_id, campaign_id, argMax(rules_hash, created_at), argMax(window_from, created_at)
+		FROM attribution_runs FINAL
+		WHERE state = 'completed'
+		GROUP BY organization_id, campaign_id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query attribution runs: %w", err)
+	}
+
+	type stale struct {
+		campaign *ingestion.Campaign
+		from     time.Time
+	}
+	var pending []stale
+	for rows.Next() {
+		var organizationID, campaignID, hash string
+		var from time.Time
+		if err := rows.Scan(&organizationID, &campaignID, &hash, &from); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attribution run: %w", err)
+		}
+		campaign := a.routing.GetCampaign(organizationID, campaignID)
+		if campaign == nil || RulesHash(campaign.Rules) == hash {
+			continue
+		}
+		pending = append(pending, stale{campaign: campaign, from: from})
+	}
+	rows.Close()
+
+	for _, s := range pending {
+		if _, err := a.Run(ctx, s.campaign, Window{From: s.from, To: time.Now()}); err != nil {
+			slog.Error("failed to re-run attribution",
+				"organization_id", s.campaign.OrganizationID,
+				"campaign_id", s.campaign.CampaignID,
+				"error", err)
+		}
+	}
+	return nil
+}
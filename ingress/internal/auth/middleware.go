@@ -8,10 +8,16 @@ import (
 	"log/slog"
 
 	wardenv1 "github.com/orchard9/warden/api/gen/go/warden/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
+var tracer = otel.Tracer("github.com/orchard9/trellis/ingress/internal/auth")
+
 // OrganizationContext holds organization information for the request
 type OrganizationContext struct {
 	OrganizationID   string
@@ -97,17 +103,21 @@ func (w *WardenClient) validateAPIKey(ctx context.Context, apiKey string) (*Orga
 	grpcCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+apiKey)
 
 	// Validate API key and get account information
-	validateResp, err := w.authClient.ValidateApiKey(grpcCtx, &wardenv1.ValidateApiKeyRequest{
+	spanCtx, span := startWardenSpan(grpcCtx, "AuthService/ValidateApiKey")
+	validateResp, err := w.authClient.ValidateApiKey(spanCtx, &wardenv1.ValidateApiKeyRequest{
 		ApiKey: apiKey,
 	})
+	endWardenSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get organization information for the account
-	orgResp, err := w.orgClient.GetAccountOrganizations(grpcCtx, &wardenv1.GetAccountOrganizationsRequest{
+	spanCtx, span = startWardenSpan(grpcCtx, "OrganizationService/GetAccountOrganizations")
+	orgResp, err := w.orgClient.GetAccountOrganizations(spanCtx, &wardenv1.GetAccountOrganizationsRequest{
 		AccountId: validateResp.AccountId,
 	})
+	endWardenSpan(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +139,25 @@ func (w *WardenClient) validateAPIKey(ctx context.Context, apiKey string) (*Orga
 	}, nil
 }
 
+// startWardenSpan starts a client span for a Warden gRPC call
+func startWardenSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "warden."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.method", method),
+		))
+}
+
+// endWardenSpan records the call's error, if any, and ends the span
+func endWardenSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // GetOrganizationContext extracts organization context from request context
 func GetOrganizationContext(ctx context.Context) (*OrganizationContext, bool) {
 	orgCtx, ok := ctx.Value(OrganizationContextKey).(*OrganizationContext)
@@ -0,0 +1,182 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// contextKey stores the resolved client address in the request context
+type contextKey struct{}
+
+// Resolver determines the client address of a request. Forwarding headers
+// are only honoured when the immediate peer is a trusted proxy, and the
+// forwarding chain is walked from the right so a client cannot spoof its
+// address by prepending entries.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting the given proxy CIDRs or addresses
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, value := range trustedProxies {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			addr = addr.Unmap()
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// ClientIP returns the client address of a request. The Forwarded header
+// (RFC 7239) takes precedence over X-Forwarded-For, which takes precedence
+// over X-Real-IP. The zero Addr is returned if RemoteAddr is unparseable.
+func (r *Resolver) ClientIP(req *http.Request) netip.Addr {
+	peer, ok := ParseHost(req.RemoteAddr)
+	if !ok {
+		return netip.Addr{}
+	}
+	if !r.isTrusted(peer) {
+		return peer
+	}
+
+	var chain []string
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		chain = forwardedFor(values)
+	} else if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	} else if value := req.Header.Get("X-Real-IP"); value != "" {
+		chain = []string{value}
+	}
+
+	// Walk right to left; the first untrusted hop is the client. An
+	// unparseable hop (e.g. "unknown") cannot be trusted past, so the
+	// last trusted proxy is reported instead.
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := ParseHost(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware resolves the client address once per request, stores it in
+// the context and rewrites RemoteAddr so request logging shows the client.
+// It replaces chi's RealIP middleware, which trusts headers from anyone.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if addr := r.ClientIP(req); addr.IsValid() {
+			req = req.WithContext(context.WithValue(req.Context(), contextKey{}, addr))
+			req.RemoteAddr = addr.String()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// FromContext returns the client address resolved by Middleware
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(contextKey{}).(netip.Addr)
+	return addr, ok
+}
+
+// ParseHost parses an address with an optional port, as found in
+// RemoteAddr and forwarding headers: "1.2.3.4", "1.2.3.4:80", "::1",
+// "[::1]" and "[::1]:1234". IPv4-mapped IPv6 addresses are unmapped.
+func ParseHost(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if value == "" {
+		return netip.Addr{}, false
+	}
+
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = value[1 : len(value)-1]
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// ipv6ClientBits is the IPv6 prefix treated as a single client. Hosts rotate
+// privacy addresses within their /64, so keying on the full address would
+// let one device look like many.
+const ipv6ClientBits = 64
+
+// ClientKey identifies a client network for dedup, velocity and rate limit
+// keys: the address itself for IPv4 and its /64 for IPv6. Returns "" for
+// the zero Addr.
+func ClientKey(addr netip.Addr) string {
+	addr = addr.Unmap()
+	switch {
+	case !addr.IsValid():
+		return ""
+	case addr.Is4():
+		return addr.String()
+	}
+	prefix, err := addr.WithZone("").Prefix(ipv6ClientBits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// isTrusted reports whether addr is a trusted proxy
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor extracts the for= node of every element of RFC 7239
+// Forwarded headers, in order. Elements without for= yield an empty node.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					node = strings.TrimSpace(val)
+				}
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,139 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.1", "::ffff:172.16.0.0/108", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string][]string
+		want    string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer headers ignored", "203.0.113.7:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		{"trusted peer without headers", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"x-forwarded-for", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"rightmost untrusted hop", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.3"}}, "198.51.100.1"},
+		{"spoofed prefix ignored", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"10.9.9.9, 198.51.100.1"}}, "198.51.100.1"},
+		{"repeated headers concatenate", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1, 10.0.0.3"}}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}}, "10.0.0.4"},
+		{"single trusted address", "192.0.2.1:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"mapped trusted range", "[::ffff:172.16.0.9]:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"ipv6 peer", "[fd00::1]:5000", map[string][]string{"X-Forwarded-For": {"2001:db8::1"}}, "2001:db8::1"},
+		{"hop with port", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1:4444"}}, "198.51.100.1"},
+		{"malformed hop stops walk", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1, unknown, 10.0.0.3"}}, "10.0.0.3"},
+		{"malformed header", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"garbage"}}, "10.0.0.2"},
+		{"empty header", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {""}}, "10.0.0.2"},
+		{"forwarded", "10.0.0.2:5000", map[string][]string{"Forwarded": {"for=198.51.100.1;proto=https"}}, "198.51.100.1"},
+		{"forwarded bracketed ipv6 with port", "10.0.0.2:5000", map[string][]string{"Forwarded": {`for="[2001:db8::1]:4711"`}}, "2001:db8::1"},
+		{"forwarded chain", "10.0.0.2:5000", map[string][]string{"Forwarded": {"for=1.1.1.1, for=198.51.100.1", "for=10.0.0.3"}}, "198.51.100.1"},
+		{"forwarded obfuscated node", "10.0.0.2:5000", map[string][]string{"Forwarded": {"for=_hidden, for=10.0.0.3"}}, "10.0.0.3"},
+		{"forwarded element without for", "10.0.0.2:5000", map[string][]string{"Forwarded": {"for=198.51.100.1, proto=https"}}, "10.0.0.2"},
+		{"forwarded wins over x-forwarded-for", "10.0.0.2:5000", map[string][]string{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, "198.51.100.1"},
+		{"x-real-ip", "10.0.0.2:5000", map[string][]string{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"x-forwarded-for wins over x-real-ip", "10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}}, "198.51.100.1"},
+		{"unparseable remote addr", "nonsense", nil, "invalid IP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			req.Header = http.Header(tt.headers)
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+			if got := resolver.ClientIP(req).String(); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResolverRejectsInvalidProxies(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0"} {
+		if _, err := NewResolver([]string{value}); err == nil {
+			t.Errorf("NewResolver(%q) error = nil, want an error", value)
+		}
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"1.2.3.4", "1.2.3.4", true},
+		{"1.2.3.4:80", "1.2.3.4", true},
+		{"::1", "::1", true},
+		{"[::1]", "::1", true},
+		{"[::1]:1234", "::1", true},
+		{`"[2001:db8::1]:80"`, "2001:db8::1", true},
+		{"::ffff:1.2.3.4", "1.2.3.4", true},
+		{" 1.2.3.4 ", "1.2.3.4", true},
+		{"", "", false},
+		{"unknown", "", false},
+		{"[::1", "", false},
+		{"1.2.3.4:port", "", false},
+	}
+
+	for _, tt := range tests {
+		addr, ok := ParseHost(tt.value)
+		if ok != tt.ok || (ok && addr.String() != tt.want) {
+			t.Errorf("ParseHost(%q) = %s, %t, want %s, %t", tt.value, addr, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	tests := []struct {
+		addr netip.Addr
+		want string
+	}{
+		{netip.MustParseAddr("203.0.113.7"), "203.0.113.7"},
+		{netip.MustParseAddr("::ffff:203.0.113.7"), "203.0.113.7"},
+		{netip.MustParseAddr("2001:db8:1:2:3:4:5:6"), "2001:db8:1:2::/64"},
+		{netip.MustParseAddr("fe80::1%eth0"), "fe80::/64"},
+		{netip.Addr{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := ClientKey(tt.addr); got != tt.want {
+			t.Errorf("ClientKey(%s) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v", err)
+	}
+
+	var got netip.Addr
+	var remote string
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+		remote = r.RemoteAddr
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.String() != "198.51.100.1" || remote != "198.51.100.1" {
+		t.Errorf("context address = %s, RemoteAddr = %s, want 198.51.100.1", got, remote)
+	}
+}
@@ -0,0 +1,111 @@
+package ingestion
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Attribute namespaces used by routing rules and fraud checks
+const (
+	AttrParamPrefix   = "param."
+	AttrHeaderPrefix  = "header."
+
+	AttrIPListPrefix  = "ip.list."
+	AttrClickIDPrefix = "click_id."
+
+	AttrClickID        = "click_id"
+	AttrIP             = "ip"
+	AttrIPVersion      = "ip.version"
+	AttrUserAgent      = "ua"
+	AttrGeoCountry     = "geo.country"
+	AttrGeoCity        = "geo.city"
+	AttrDeviceType     = "device.type"
+	AttrDeviceOS       = "device.os"
+	AttrDeviceBrowser  = "device.browser"
+	AttrReferrerURL    = "referrer.url"
+	AttrReferrerDomain = "referrer.domain"
+	AttrSource         = "attribution.source"
+	AttrMedium         = "attribution.medium"
+	AttrVisitorID      = "visitor.id"
+	AttrVisitorReturn  = "visitor.is_returning"
+	AttrBotIsBot       = "bot.is_bot"
+	AttrBotName        = "bot.name"
+)
+
+// Attributes is the unified request attribute namespace, built once per
+// request and shared by routing, fraud checks and the stored Event.
+// Keys look like "param.source", "header.referer", "ip" or "geo.country";
+// IP list membership appears as "ip.list.<name>" = "true" and network click
+// IDs as "click_id.<name>".
+type Attributes map[string]string
+
+// NewAttributes builds the attribute namespace from a captured event.
+// The event's Enriched data must already be populated.
+func NewAttributes(event *Event) Attributes {
+	raw := event.RawRequest
+	attrs := make(Attributes, len(raw.Params)+len(raw.Headers)+8)
+
+	for key, values := range raw.Params {
+		if len(values) > 0 {
+			attrs[AttrParamPrefix+key] = values[0]
+		}
+	}
+	for key, value := range raw.Headers {
+		attrs[AttrHeaderPrefix+strings.ToLower(key)] = value
+	}
+
+	attrs.set(AttrClickID, event.ClickID)
+	for name, id := range event.ClickIDs {
+		attrs[AttrClickIDPrefix+name] = id
+	}
+
+	attrs.set(AttrIP, ipString(raw.IP))
+	if raw.IP.IsValid() {
+		attrs[AttrIPVersion] = ipVersion(raw.IP)
+	}
+	attrs.set(AttrUserAgent, raw.Headers["user-agent"])
+
+	enriched := event.Enriched
+	attrs.set(AttrGeoCountry, enriched.Country)
+	attrs.set(AttrGeoCity, enriched.City)
+	attrs.set(AttrDeviceType, enriched.DeviceType)
+	attrs.set(AttrDeviceOS, enriched.OS)
+	attrs.set(AttrDeviceBrowser, enriched.Browser)
+	attrs.set(AttrReferrerURL, enriched.Referrer)
+	attrs.set(AttrReferrerDomain, enriched.ReferrerDomain)
+	attrs.set(AttrSource, enriched.Source)
+	attrs.set(AttrMedium, enriched.Medium)
+	attrs[AttrBotIsBot] = strconv.FormatBool(enriched.IsBot)
+	attrs.set(AttrBotName, enriched.BotName)
+	for _, list := range enriched.IPLists {
+		attrs[AttrIPListPrefix+list] = "true"
+	}
+
+	attrs.set(AttrVisitorID, event.UserID)
+	if event.UserID != "" {
+		attrs[AttrVisitorReturn] = strconv.FormatBool(event.IsReturning)
+	}
+
+	return attrs
+}
+
+// Get resolves a rule field. Fields without a known namespace are treated
+// as query parameters so existing rules like {"field": "source"} keep
+// matching param.source.
+func (a Attributes) Get(field string) (string, bool) {
+	if value, ok := a[field]; ok {
+		return value, true
+	}
+	if strings.Contains(field, ".") {
+		return "", false
+	}
+	value, ok := a[AttrParamPrefix+field]
+	return value, ok
+}
+
+// set stores non-empty values only, so missing data never matches a rule
+func (a Attributes) set(key, value string) {
+	if value != "" {
+		a[key] = value
+	}
+}
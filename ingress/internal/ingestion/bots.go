@@ -0,0 +1,285 @@
+package ingestion
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bot categories
+const (
+	BotCategoryCrawler = "crawler" // search engine crawlers
+	BotCategoryPreview = "preview" // link unfurlers (Slack, Facebook, ...)
+	BotCategoryMonitor = "monitor" // uptime and SEO monitors
+	BotCategoryTool    = "tool"    // generic HTTP libraries and scrapers
+)
+
+// BotPattern matches a bot by user agent substring
+type BotPattern struct {
+	Name     string
+	Pattern  string // lowercase user agent substring
+	Category string
+
+	// VerifyDomains are reverse DNS suffixes a genuine crawler resolves to.
+	// When set, claims are verified and spoofed user agents are reported.
+	VerifyDomains []string
+}
+
+// BotResult is the outcome of bot detection for a request
+type BotResult struct {
+	IsBot    bool
+	Name     string
+	Category string
+	Verified bool // reverse DNS confirmed the claimed crawler
+	Spoofed  bool // user agent claims a verifiable crawler but DNS disagrees
+}
+
+// Resolver performs DNS lookups; *net.Resolver satisfies it and tests can stub it
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// defaultBotPatterns covers the most common crawlers and link unfurlers
+var defaultBotPatterns = []BotPattern{
+	{Name: "googlebot", Pattern: "googlebot", Category: BotCategoryCrawler, VerifyDomains: []string{".googlebot.com", ".google.com"}},
+	{Name: "google-adsbot", Pattern: "adsbot-google", Category: BotCategoryCrawler, VerifyDomains: []string{".googlebot.com", ".google.com"}},
+	{Name: "bingbot", Pattern: "bingbot", Category: BotCategoryCrawler, VerifyDomains: []string{".search.msn.com"}},
+	{Name: "applebot", Pattern: "applebot", Category: BotCategoryCrawler, VerifyDomains: []string{".applebot.apple.com"}},
+	{Name: "yandexbot", Pattern: "yandexbot", Category: BotCategoryCrawler, VerifyDomains: []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	{Name: "duckduckbot", Pattern: "duckduckbot", Category: BotCategoryCrawler},
+	{Name: "baiduspider", Pattern: "baiduspider", Category: BotCategoryCrawler, VerifyDomains: []string{".baidu.com", ".baidu.jp"}},
+	{Name: "facebook", Pattern: "facebookexternalhit", Category: BotCategoryPreview},
+	{Name: "facebook", Pattern: "facebookcatalog", Category: BotCategoryPreview},
+	{Name: "slack", Pattern: "slackbot", Category: BotCategoryPreview},
+	{Name: "slack", Pattern: "slack-imgproxy", Category: BotCategoryPreview},
+	{Name: "twitter", Pattern: "twitterbot", Category: BotCategoryPreview},
+	{Name: "linkedin", Pattern: "linkedinbot", Category: BotCategoryPreview},
+	{Name: "discord", Pattern: "discordbot", Category: BotCategoryPreview},
+	{Name: "telegram", Pattern: "telegrambot", Category: BotCategoryPreview},
+	{Name: "whatsapp", Pattern: "whatsapp", Category: BotCategoryPreview},
+	{Name: "skype", Pattern: "skypeuripreview", Category: BotCategoryPreview},
+	{Name: "pinterest", Pattern: "pinterestbot", Category: BotCategoryPreview},
+	{Name: "microsoft-preview", Pattern: "microsoftpreview", Category: BotCategoryPreview},
+	{Name: "ahrefs", Pattern: "ahrefsbot", Category: BotCategoryMonitor},
+	{Name: "semrush", Pattern: "semrushbot", Category: BotCategoryMonitor},
+	{Name: "pingdom", Pattern: "pingdom", Category: BotCategoryMonitor},
+	{Name: "uptimerobot", Pattern: "uptimerobot", Category: BotCategoryMonitor},
+	{Name: "generic-bot", Pattern: "bot/", Category: BotCategoryTool},
+	{Name: "generic-crawler", Pattern: "crawler", Category: BotCategoryTool},
+	{Name: "generic-spider", Pattern: "spider", Category: BotCategoryTool},
+}
+
+// BotDetector identifies known bots from their user agent and verifies
+// claimed search crawlers with forward-confirmed reverse DNS
+type BotDetector struct {
+	patterns atomic.Pointer[[]BotPattern]
+	resolver Resolver
+	timeout  time.Duration
+
+	mu           sync.Mutex
+	verification map[string]verificationEntry // name|ip -> result
+}
+
+// verificationEntry caches a reverse DNS verification outcome
+type verificationEntry struct {
+	verified bool
+	expires  time.Time
+}
+
+// Reverse DNS outcomes are cached per IP, bounded to keep memory flat
+const (
+	verificationTTL        = time.Hour
+	maxVerificationEntries = 100000
+)
+
+// NewBotDetector creates a detector with the built-in patterns.
+// A nil resolver uses net.DefaultResolver.
+func NewBotDetector(resolver Resolver, timeout time.Duration) *BotDetector {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	d := &BotDetector{
+		resolver:     resolver,
+		timeout:      timeout,
+		verification: make(map[string]verificationEntry),
+	}
+	patterns := append([]BotPattern(nil), defaultBotPatterns...)
+	d.patterns.Store(&patterns)
+	return d
+}
+
+// LoadFile replaces the custom patterns with those in a list file, keeping
+// the built-in ones. Each non-comment line is
+//
+//	pattern|name|category|verify.domain,other.domain
+//
+// where everything after the pattern is optional. Patterns are
+// case-insensitive user agent substrings, as in the IAB spiders and bots
+// list, and take precedence over the built-in ones.
+func (d *BotDetector) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open bot list: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []BotPattern
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "|")
+		pattern := BotPattern{
+			Pattern:  strings.ToLower(strings.TrimSpace(fields[0])),
+			Category: BotCategoryTool,
+		}
+		if pattern.Pattern == "" {
+			return fmt.Errorf("bot list line %d: empty pattern", lineNo)
+		}
+		pattern.Name = pattern.Pattern
+		if len(fields) > 1 && strings.TrimSpace(fields[1]) != "" {
+			pattern.Name = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+			pattern.Category = strings.TrimSpace(fields[2])
+		}
+		if len(fields) > 3 {
+			for _, domain := range strings.Split(fields[3], ",") {
+				if domain = strings.TrimSpace(domain); domain != "" {
+					pattern.VerifyDomains = append(pattern.VerifyDomains, "."+strings.TrimPrefix(strings.ToLower(domain), "."))
+				}
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read bot list: %w", err)
+	}
+
+	patterns = append(patterns, defaultBotPatterns...)
+	d.patterns.Store(&patterns)
+	return nil
+}
+
+// Detect classifies a request by user agent and client IP
+func (d *BotDetector) Detect(ctx context.Context, userAgent, ip string) BotResult {
+	if userAgent == "" {
+		return BotResult{}
+	}
+	ua := strings.ToLower(userAgent)
+
+	for _, pattern := range *d.patterns.Load() {
+		if !strings.Contains(ua, pattern.Pattern) {
+			continue
+		}
+
+		result := BotResult{
+			IsBot:    true,
+			Name:     pattern.Name,
+			Category: pattern.Category,
+		}
+		if len(pattern.VerifyDomains) > 0 && ip != "" {
+			verified, ok := d.verify(ctx, pattern, ip)
+			switch {
+			case !ok:
+				// DNS unavailable; trust the user agent rather than block real crawlers
+			case verified:
+				result.Verified = true
+			default:
+				// Claims to be a crawler but isn't: treat as a (suspicious) human request
+				return BotResult{Name: pattern.Name, Spoofed: true}
+			}
+		}
+		return result
+	}
+
+	return BotResult{}
+}
+
+// verify performs forward-confirmed reverse DNS for a claimed crawler.
+// ok is false when DNS could not answer in time.
+func (d *BotDetector) verify(ctx context.Context, pattern BotPattern, ip string) (verified, ok bool) {
+	cacheKey := pattern.Name + "|" + ip
+	now := time.Now()
+
+	d.mu.Lock()
+	entry, cached := d.verification[cacheKey]
+	d.mu.Unlock()
+	if cached && now.Before(entry.expires) {
+		return entry.verified, true
+	}
+
+	dnsCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	verified, err := d.reverseConfirm(dnsCtx, pattern.VerifyDomains, ip)
+	if err != nil {
+		return false, false
+	}
+
+	d.mu.Lock()
+	if len(d.verification) >= maxVerificationEntries {
+		d.verification = make(map[string]verificationEntry)
+	}
+	d.verification[cacheKey] = verificationEntry{verified: verified, expires: now.Add(verificationTTL)}
+	d.mu.Unlock()
+
+	return verified, true
+}
+
+// reverseConfirm checks that ip reverse-resolves into one of domains and that
+// the hostname resolves back to ip. A lookup error is only returned for
+// transient failures; "no such host" counts as not verified.
+func (d *BotDetector) reverseConfirm(ctx context.Context, domains []string, ip string) (bool, error) {
+	names, err := d.resolver.LookupAddr(ctx, ip)
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+
+	for _, name := range names {
+		host := strings.TrimSuffix(strings.ToLower(name), ".")
+		if !hasAnySuffix(host, domains) {
+			continue
+		}
+
+		addrs, err := d.resolver.LookupHost(ctx, host)
+		if err != nil && !isNotFound(err) {
+			return false, err
+		}
+		for _, addr := range addrs {
+			if addr == ip {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isNotFound reports whether a DNS error is a definitive negative answer
+func isNotFound(err error) bool {
+	dnsErr, ok := err.(*net.DNSError)
+	return ok && dnsErr.IsNotFound
+}
+
+// hasAnySuffix reports whether host ends with any of suffixes
+func hasAnySuffix(host string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+const googlebotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+// fakeResolver answers DNS lookups from maps and counts calls
+type fakeResolver struct {
+	ptr     map[string][]string
+	hosts   map[string][]string
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	names, ok := r.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestBotDetectorVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver *fakeResolver
+		want     BotResult
+	}{
+		{
+			name: "verified",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+				hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+			},
+			want: BotResult{IsBot: true, Name: "googlebot", Category: BotCategoryCrawler, Verified: true},
+		},
+		{
+			name: "forward mismatch",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+				hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"203.0.113.9"}},
+			},
+			want: BotResult{Name: "googlebot", Spoofed: true},
+		},
+		{
+			name: "reverse outside domains",
+			resolver: &fakeResolver{
+				ptr:   map[string][]string{"66.249.66.1": {"host.attacker.example."}},
+				hosts: map[string][]string{"host.attacker.example": {"66.249.66.1"}},
+			},
+			want: BotResult{Name: "googlebot", Spoofed: true},
+		},
+		{
+			name:     "no reverse record",
+			resolver: &fakeResolver{},
+			want:     BotResult{Name: "googlebot", Spoofed: true},
+		},
+		{
+			name:     "lookup error trusts user agent",
+			resolver: &fakeResolver{err: errors.New("i/o timeout")},
+			want:     BotResult{IsBot: true, Name: "googlebot", Category: BotCategoryCrawler},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewBotDetector(tt.resolver, time.Second)
+			got := d.Detect(context.Background(), googlebotUA, "66.249.66.1")
+			if got != tt.want {
+				t.Errorf("Detect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotDetectorCachesVerification(t *testing.T) {
+	resolver := &fakeResolver{
+		ptr:   map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+		hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+	}
+	d := NewBotDetector(resolver, time.Second)
+
+	first := d.Detect(context.Background(), googlebotUA, "66.249.66.1")
+	lookups := resolver.lookups
+	second := d.Detect(context.Background(), googlebotUA, "66.249.66.1")
+
+	if !first.Verified || !second.Verified {
+		t.Fatalf("Detect() verified = %t, %t, want true, true", first.Verified, second.Verified)
+	}
+	if resolver.lookups != lookups {
+		t.Errorf("cached verification made %d more lookups", resolver.lookups-lookups)
+	}
+}
+
+func TestBotDetectorDoesNotCacheLookupErrors(t *testing.T) {
+	resolver := &fakeResolver{err: errors.New("i/o timeout")}
+	d := NewBotDetector(resolver, time.Second)
+
+	d.Detect(context.Background(), googlebotUA, "66.249.66.1")
+	resolver.err = nil
+	resolver.ptr = map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}}
+	resolver.hosts = map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}}
+
+	if got := d.Detect(context.Background(), googlebotUA, "66.249.66.1"); !got.Verified {
+		t.Errorf("Detect() after transient error = %+v, want verified", got)
+	}
+}
+
+func TestBotDetectorUnknownUserAgent(t *testing.T) {
+	resolver := &fakeResolver{}
+	d := NewBotDetector(resolver, time.Second)
+
+	if got := d.Detect(context.Background(), "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0)", "66.249.66.1"); got != (BotResult{}) {
+		t.Errorf("Detect() = %+v, want no bot", got)
+	}
+	if resolver.lookups != 0 {
+		t.Errorf("unknown user agent made %d lookups", resolver.lookups)
+	}
+}
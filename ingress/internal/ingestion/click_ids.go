@@ -0,0 +1,107 @@
+package ingestion
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TrellisClickIDParam is the destination parameter carrying the canonical click ID by default
+const TrellisClickIDParam = "trellis_click_id"
+
+// ClickIDMapping maps a request parameter carrying a click ID to a name in
+// the event's click ID map. Source limits the mapping to traffic from one
+// attribution source (utm_source); empty applies to all traffic.
+type ClickIDMapping struct {
+	Param  string `json:"param"`
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+}
+
+// DefaultClickIDMappings are the ad network and affiliate click ID
+// parameters recognized for every organization, after its own mappings
+var DefaultClickIDMappings = []ClickIDMapping{
+	// Ad networks
+	{Param: "gclid", Name: "gclid"},
+	{Param: "gbraid", Name: "gbraid"},
+	{Param: "wbraid", Name: "wbraid"},
+	{Param: "dclid", Name: "dclid"},
+	{Param: "fbclid", Name: "fbclid"},
+	{Param: "ttclid", Name: "ttclid"},
+	{Param: "msclkid", Name: "msclkid"},
+	{Param: "twclid", Name: "twclid"},
+	{Param: "li_fat_id", Name: "li_fat_id"},
+	{Param: "epik", Name: "epik"},
+	{Param: "ScCid", Name: "sccid"},
+	{Param: "rdt_cid", Name: "rdt_cid"},
+	{Param: "yclid", Name: "yclid"},
+
+	// Affiliate networks passing their own click ID
+	{Param: "click_id", Name: "click_id"},
+	{Param: "clickid", Name: "click_id"},
+	{Param: "cid", Name: "click_id"},
+	{Param: "transaction_id", Name: "click_id"},
+	{Param: "tid", Name: "click_id"},
+}
+
+// Validate checks a click ID mapping
+func (m ClickIDMapping) Validate() error {
+	if m.Param == "" || m.Name == "" {
+		return fmt.Errorf("click ID mapping needs a param and a name")
+	}
+	if strings.Trim(m.Name, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return fmt.Errorf("invalid click ID name %q", m.Name)
+	}
+	return nil
+}
+
+// extractClickIDs collects the click IDs a request carries, keyed by
+// mapping name. The organization's mappings are tried before the defaults
+// and the first mapping to fill a name wins. primary is the first click ID
+// found, used to deduplicate clicks by provided click ID.
+func extractClickIDs(mappings []ClickIDMapping, source string, params url.Values) (ids map[string]string, primary string) {
+	for _, list := range [][]ClickIDMapping{mappings, DefaultClickIDMappings} {
+		for _, m := range list {
+			if m.Source != "" && !strings.EqualFold(m.Source, source) {
+				continue
+			}
+			value := params.Get(m.Param)
+			if value == "" {
+				continue
+			}
+			if _, ok := ids[m.Name]; ok {
+				continue
+			}
+			if ids == nil {
+				ids = make(map[string]string)
+				primary = value
+			}
+			ids[m.Name] = value
+		}
+	}
+	return ids, primary
+}
+
+// appendClickID adds the canonical click ID to a destination URL under
+// param, unless param is empty or the destination already sets it
+func appendClickID(destination, param, clickID string) string {
+	if param == "" {
+		return destination
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	if parsed.Query().Has(param) {
+		return destination
+	}
+
+	// Append without re-encoding so the destination's own query is kept as is
+	added := url.QueryEscape(param) + "=" + url.QueryEscape(clickID)
+	if parsed.RawQuery == "" {
+		parsed.RawQuery = added
+	} else {
+		parsed.RawQuery += "&" + added
+	}
+	return parsed.String()
+}
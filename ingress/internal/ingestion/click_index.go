@@ -0,0 +1,90 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNoIndex is returned by lookups when Redis is not configured
+var ErrNoIndex = errors.New("click index is not configured")
+
+// ClickIndex remembers when clicks happened and which campaign they were
+// routed to, so conversions can be validated and attributed. Without Redis
+// nothing is remembered and lookups fail with ErrNoIndex.
+type ClickIndex struct {
+	redis   *redis.Client
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// ClickRecord is what the index knows about a click
+type ClickRecord struct {
+	Time       time.Time
+	CampaignID string     // bare campaign ID, empty if no campaign matched
+	Params     url.Values // click parameters kept for outbound postbacks
+}
+
+// NewClickIndex creates a click index keeping clicks for ttl
+func NewClickIndex(redisClient *redis.Client, ttl, timeout time.Duration) *ClickIndex {
+	return &ClickIndex{
+		redis:   redisClient,
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+// Record stores the click time, campaign and kept parameters for an organization's click ID
+func (c *ClickIndex) Record(ctx context.Context, organizationID, clickID string, at time.Time, campaignID string, params url.Values) error {
+	if c.redis == nil {
+		return nil
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	key := fmt.Sprintf("clicktime:%s:%s", organizationID, clickID)
+	value := fmt.Sprintf("%d|%s|%s", at.UnixMilli(), campaignID, params.Encode())
+	if err := c.redis.Set(redisCtx, key, value, c.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to record click time: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the stored click for an organization's click ID
+func (c *ClickIndex) Lookup(ctx context.Context, organizationID, clickID string) (ClickRecord, bool, error) {
+	if c.redis == nil {
+		return ClickRecord{}, false, ErrNoIndex
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	key := fmt.Sprintf("clicktime:%s:%s", organizationID, clickID)
+	value, err := c.redis.Get(redisCtx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return ClickRecord{}, false, nil
+	}
+	if err != nil {
+		return ClickRecord{}, false, fmt.Errorf("failed to look up click time: %w", err)
+	}
+
+	// Older entries hold only the timestamp, or no parameters
+	ms, rest, _ := strings.Cut(value, "|")
+	millis, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return ClickRecord{}, false, fmt.Errorf("invalid click index entry: %w", err)
+	}
+	campaignID, encoded, _ := strings.Cut(rest, "|")
+	params, err := url.ParseQuery(encoded)
+	if err != nil {
+		return ClickRecord{}, false, fmt.Errorf("invalid click index entry: %w", err)
+	}
+	return ClickRecord{Time: time.UnixMilli(millis), CampaignID: campaignID, Params: params}, true, nil
+}
@@ -0,0 +1,111 @@
+package ingestion
+
+import (
+	"strings"
+
+	"github.com/orchard9/trellis/ingress/internal/rules"
+)
+
+// storedIP is the client IP as live routing sees it: IPv4 unmapped, and
+// missing when the address was dropped or never captured
+const storedIP = `if(ip = toIPv6('::') OR ip = toIPv6('::ffff:0.0.0.0'), '', replaceRegexpOne(toString(ip), '^::ffff:', ''))`
+
+// EventColumns maps rule fields to the events table, so stored events can
+// be matched with the same rules as live traffic. Time fields are read in
+// timezone; fields the table doesn't store are missing.
+func EventColumns(timezone string) rules.Columns {
+	return func(field string) (rules.Column, bool) {
+		switch field {
+		case FieldHourOfDay:
+			return timeColumn("toString(toHour(", "))", timezone), true
+		case FieldDayOfWeek:
+			return timeColumn("arrayElement(['monday', 'tuesday', 'wednesday', 'thursday', 'friday', 'saturday', 'sunday'], toDayOfWeek(", "))", timezone), true
+		case FieldDate:
+			return timeColumn("toString(toDate(", "))", timezone), true
+		case FieldTimeOfDay:
+			return timeColumn("formatDateTime(", ", '%H:%i')", timezone), true
+
+		case AttrClickID:
+			return rawColumn("click_id"), true
+		case AttrIP:
+			return rawColumn(storedIP), true
+		case AttrIPVersion:
+			return rawColumn("if(" + storedIP + " = '', '', toString(ip_version))"), true
+		case AttrUserAgent:
+			return rawColumn("headers['user-agent']"), true
+		case AttrGeoCountry:
+			return rawColumn("ifNull(toString(country), '')"), true
+		case AttrGeoCity:
+			return rawColumn("ifNull(city, '')"), true
+		case AttrDeviceType:
+			return rawColumn("ifNull(device_type, '')"), true
+		case AttrDeviceOS:
+			return rawColumn("ifNull(os, '')"), true
+		case AttrDeviceBrowser:
+			return rawColumn("ifNull(browser, '')"), true
+		case AttrReferrerURL:
+			return rawColumn("ifNull(referrer, '')"), true
+		case AttrReferrerDomain:
+			return rawColumn("ifNull(referrer_domain, '')"), true
+		case AttrSource:
+			return rawColumn("ifNull(source, '')"), true
+		case AttrMedium:
+			return rawColumn("ifNull(medium, '')"), true
+		case AttrVisitorID:
+			return rawColumn("user_id"), true
+		case AttrVisitorReturn:
+			return rawColumn("if(user_id = '', '', if(is_returning = 1, 'true', 'false'))"), true
+		case AttrBotIsBot:
+			return rawColumn("if(ifNull(is_bot, 0) = 1, 'true', 'false')"), true
+		case AttrBotName:
+			return rawColumn("ifNull(bot_name, '')"), true
+		}
+
+		if name, ok := strings.CutPrefix(field, AttrParamPrefix); ok {
+			return paramColumn(name), true
+		}
+		if name, ok := strings.CutPrefix(field, AttrHeaderPrefix); ok {
+			return keyedColumn("headers[?]", strings.ToLower(name)), true
+		}
+		if name, ok := strings.CutPrefix(field, AttrClickIDPrefix); ok {
+			return keyedColumn("click_ids[?]", name), true
+		}
+		if name, ok := strings.CutPrefix(field, AttrIPListPrefix); ok {
+			return keyedColumn("if(has(ip_lists, ?), 'true', '')", name), true
+		}
+
+		// Fields without a namespace are query parameters, as in Attributes.Get
+		if !strings.Contains(field, ".") {
+			return paramColumn(field), true
+		}
+		return rules.Column{}, false
+	}
+}
+
+// rawColumn is a column read by a fixed expression
+func rawColumn(sql string) rules.Column {
+	return rules.Column{Value: rules.Expr{SQL: sql}}
+}
+
+// keyedColumn is a column read by an expression taking one bound key
+func keyedColumn(sql, key string) rules.Column {
+	return rules.Column{Value: rules.Expr{SQL: sql, Args: []interface{}{key}}}
+}
+
+// timeColumn is a virtual time field computed from event_time in timezone
+func timeColumn(before, after, timezone string) rules.Column {
+	return rules.Column{Value: rules.Expr{
+		SQL:  before + "toTimeZone(event_time, ?)" + after,
+		Args: []interface{}{timezone},
+	}}
+}
+
+// paramColumn reads the first value of a query parameter from raw_params;
+// a parameter given with an empty value is present, as live
+func paramColumn(name string) rules.Column {
+	present := rules.Expr{SQL: "JSONLength(raw_params, ?) > 0", Args: []interface{}{name}}
+	return rules.Column{
+		Value:   rules.Expr{SQL: "JSONExtractString(raw_params, ?, 1)", Args: []interface{}{name}},
+		Present: &present,
+	}
+}
@@ -0,0 +1,155 @@
+package ingestion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DedupPolicy describes how duplicates are detected for a click
+type DedupPolicy struct {
+	Window time.Duration
+	Key    string // click_id, ip_ua or visitor
+}
+
+// Deduplicator detects duplicate clicks using Redis, falling back to an
+// in-process window when Redis is unavailable so duplicates are still
+// caught on a single replica
+type Deduplicator struct {
+	redis   *redis.Client
+	timeout time.Duration
+
+	mu    sync.Mutex
+	local map[string]time.Time // key -> expiry
+}
+
+// NewDeduplicator creates a deduplicator with the given Redis operation timeout
+func NewDeduplicator(redisClient *redis.Client, timeout time.Duration) *Deduplicator {
+	d := &Deduplicator{
+		redis:   redisClient,
+		timeout: timeout,
+		local:   make(map[string]time.Time),
+	}
+
+	// Periodically drop expired fallback entries
+	go d.sweepLocal()
+
+	return d
+}
+
+// dedupPolicy resolves the effective policy: campaign overrides organization
+func dedupPolicy(settings *OrganizationSettings, campaign *Campaign) DedupPolicy {
+	policy := DedupPolicy{
+		Window: settings.DedupWindow(),
+		Key:    settings.DedupKey,
+	}
+	if campaign != nil {
+		if campaign.DedupWindowSeconds > 0 {
+			policy.Window = time.Duration(campaign.DedupWindowSeconds) * time.Second
+		}
+		if campaign.DedupKey != "" {
+			policy.Key = campaign.DedupKey
+		}
+	}
+	return policy
+}
+
+// dedupIdentity builds the identity part of the dedup key for an event.
+// Returns "" when the event has nothing to deduplicate on.
+func dedupIdentity(policy DedupPolicy, event *Event, providedClickID string) string {
+	switch policy.Key {
+	case DedupKeyVisitor:
+		if event.UserID != "" {
+			return "visitor:" + event.UserID
+		}
+	case DedupKeyClickID:
+		// Minted click IDs are unique by construction, so fall back to ip_ua
+		if providedClickID != "" {
+			return "click:" + providedClickID
+		}
+	}
+
+	ua := event.RawRequest.Headers["user-agent"]
+	client := clientip.ClientKey(event.RawRequest.IP)
+	if client == "" && ua == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(client + "|" + ua))
+	return "ipua:" + hex.EncodeToString(sum[:12])
+}
+
+// IsDuplicate records the click and reports whether it was already seen
+// within the policy window. The scope separates per-campaign windows.
+func (d *Deduplicator) IsDuplicate(ctx context.Context, organizationID, scope, identity string, window time.Duration) bool {
+	if identity == "" || window <= 0 {
+		return false
+	}
+
+	ctx, span := tracer.Start(ctx, "dedup.IsDuplicate")
+	defer span.End()
+
+	// Organization-scoped Redis key
+	key := fmt.Sprintf("dedup:%s:%s:%s", organizationID, scope, identity)
+
+	// Without Redis the local map is the only store
+	if d.redis == nil {
+		duplicate := d.isDuplicateLocal(key, window)
+		span.SetAttributes(attribute.Bool("dedup.fallback", true), attribute.Bool("dedup.duplicate", duplicate))
+		return duplicate
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	// SetNX returns true if key was set (not duplicate)
+	ok, err := d.redis.SetNX(redisCtx, key, 1, window).Result()
+	if err != nil {
+		slog.Warn("redis dedup check failed, using local fallback", "error", err, "organization_id", organizationID)
+		span.RecordError(err)
+		duplicate := d.isDuplicateLocal(key, window)
+		span.SetAttributes(attribute.Bool("dedup.fallback", true), attribute.Bool("dedup.duplicate", duplicate))
+		return duplicate
+	}
+
+	span.SetAttributes(attribute.Bool("dedup.duplicate", !ok))
+	return !ok
+}
+
+// isDuplicateLocal is the in-process fallback used when Redis fails or
+// isn't configured
+func (d *Deduplicator) isDuplicateLocal(key string, window time.Duration) bool {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if expiry, ok := d.local[key]; ok && now.Before(expiry) {
+		return true
+	}
+	d.local[key] = now.Add(window)
+	return false
+}
+
+// sweepLocal removes expired fallback entries
+func (d *Deduplicator) sweepLocal() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		d.mu.Lock()
+		for key, expiry := range d.local {
+			if now.After(expiry) {
+				delete(d.local, key)
+			}
+		}
+		d.mu.Unlock()
+	}
+}
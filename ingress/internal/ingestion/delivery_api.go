@@ -0,0 +1,134 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+// DeliveryAPI exposes the outbound postback delivery log and replays
+type DeliveryAPI struct {
+	forwarder *Forwarder
+}
+
+// NewDeliveryAPI creates the delivery API
+func NewDeliveryAPI(forwarder *Forwarder) *DeliveryAPI {
+	return &DeliveryAPI{forwarder: forwarder}
+}
+
+// Routes mounts the delivery endpoints:
+//
+//	GET  /                          latest state per delivery (?postback_id=, ?state=, ?limit=)
+//	GET  /{delivery_id}             every attempt of a delivery
+//	POST /{delivery_id}/replay      send a delivery again
+func (a *DeliveryAPI) Routes(r chi.Router) {
+	r.Get("/", a.list)
+	r.Get("/{delivery_id}", a.get)
+	r.Post("/{delivery_id}/replay", a.replay)
+}
+
+// list returns the organization's deliveries
+func (a *DeliveryAPI) list(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 100
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := a.forwarder.Deliveries(r.Context(), orgCtx.OrganizationID, query.Get("postback_id"), query.Get("state"), limit)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Delivery log is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to list deliveries", "error", err, "organization_id", orgCtx.OrganizationID)
+		http.Error(w, "Failed to list deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+// get returns a delivery's attempts
+func (a *DeliveryAPI) get(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	deliveryID := chi.URLParam(r, "delivery_id")
+	attempts, err := a.forwarder.Attempts(r.Context(), orgCtx.OrganizationID, deliveryID)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Delivery log is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to load delivery", "error", err, "delivery_id", deliveryID)
+		http.Error(w, "Failed to load delivery", http.StatusInternalServerError)
+		return
+	}
+	if len(attempts) == 0 {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"delivery_id": deliveryID,
+		"attempts":    attempts,
+	})
+}
+
+// replay queues a delivery again, e.g. after the traffic source fixed an outage
+func (a *DeliveryAPI) replay(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	deliveryID := chi.URLParam(r, "delivery_id")
+	delivery, err := a.forwarder.Replay(r.Context(), orgCtx.OrganizationID, deliveryID)
+	switch {
+	case errors.Is(err, ErrDeliveryNotFound):
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrDeliveryInProgress):
+		http.Error(w, "Delivery is still queued", http.StatusConflict)
+		return
+	case errors.Is(err, ErrForwardingDisabled), errors.Is(err, ErrNoWarehouse):
+		http.Error(w, "Replay is unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		slog.Error("failed to replay delivery", "error", err, "delivery_id", deliveryID)
+		http.Error(w, "Failed to replay delivery", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
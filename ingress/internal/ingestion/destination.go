@@ -0,0 +1,237 @@
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strings"
+)
+
+// Destination macros besides attribute names such as {param.sub1} or {geo.country}
+const (
+	MacroVariant    = "variant"
+	MacroVisitorID  = "visitor_id"
+	MacroCampaignID = "campaign_id"
+)
+
+// destinationMacroPrefixes are the attribute namespaces usable in destination templates
+var destinationMacroPrefixes = []string{AttrParamPrefix, AttrClickIDPrefix}
+
+// destinationMacros are the exact names usable in destination templates
+var destinationMacros = map[string]bool{
+	MacroVariant:       true,
+	MacroVisitorID:     true,
+	MacroCampaignID:    true,
+	AttrClickID:        true,
+	AttrGeoCountry:     true,
+	AttrGeoCity:        true,
+	AttrDeviceType:     true,
+	AttrDeviceOS:       true,
+	AttrDeviceBrowser:  true,
+	AttrReferrerDomain: true,
+	AttrSource:         true,
+	AttrMedium:         true,
+	AttrVisitorID:      true,
+}
+
+// Variant is a weighted alternative destination of a campaign
+type Variant struct {
+	Name           string `json:"name"`
+	DestinationURL string `json:"destination_url"`
+	Weight         int    `json:"weight"`
+}
+
+// ValidateDestinations checks a campaign's destination templates, variants
+// and parameter lists
+func (c *Campaign) ValidateDestinations() error {
+	if err := validateDestinationTemplate(c.DestinationURL); err != nil {
+		return err
+	}
+
+	total := 0
+	names := make(map[string]bool, len(c.Variants))
+	for _, v := range c.Variants {
+		if v.Name == "" || names[v.Name] {
+			return fmt.Errorf("variant names must be unique and non-empty")
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %q has a negative weight", v.Name)
+		}
+		total += v.Weight
+		if v.DestinationURL != "" {
+			if err := validateDestinationTemplate(v.DestinationURL); err != nil {
+				return fmt.Errorf("variant %q: %w", v.Name, err)
+			}
+		}
+	}
+	if len(c.Variants) > 0 && total == 0 {
+		return errors.New("variant weights must not all be zero")
+	}
+
+	for _, name := range append(append([]string{}, c.ForwardParams...), c.BlockParams...) {
+		if strings.TrimSuffix(name, "*") == "" {
+			return fmt.Errorf("invalid parameter pattern %q", name)
+		}
+	}
+	return nil
+}
+
+// validateDestinationTemplate checks that a destination uses known macros
+// and is a valid http(s) URL once they are filled in
+func validateDestinationTemplate(tmpl string) error {
+	for _, name := range templateMacros(tmpl) {
+		if !isDestinationMacro(name) {
+			return fmt.Errorf("unknown macro {%s} in destination", name)
+		}
+	}
+	if strings.Count(tmpl, "{") != strings.Count(tmpl, "}") {
+		return fmt.Errorf("unbalanced braces in destination %q", tmpl)
+	}
+
+	sample := expandMacros(tmpl, func(string) (string, bool) { return "x", true }, escapeQuery)
+	parsed, err := url.Parse(sample)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid destination URL %q", tmpl)
+	}
+	return nil
+}
+
+// isDestinationMacro reports whether name may be used in a destination template
+func isDestinationMacro(name string) bool {
+	if destinationMacros[name] {
+		return true
+	}
+	for _, prefix := range destinationMacroPrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickVariant chooses a campaign variant by weight. Visitors are bucketed
+// by a hash of their ID so they keep seeing the same variant.
+func (c *Campaign) pickVariant(visitorID string) *Variant {
+	total := 0
+	for _, v := range c.Variants {
+		total += v.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	var bucket int
+	if visitorID != "" {
+		h := fnv.New32a()
+		h.Write([]byte(c.CampaignID + "|" + visitorID))
+		bucket = int(h.Sum32() % uint32(total))
+	} else {
+		bucket = rand.Intn(total)
+	}
+
+	for i := range c.Variants {
+		bucket -= c.Variants[i].Weight
+		if bucket < 0 {
+			return &c.Variants[i]
+		}
+	}
+	return nil
+}
+
+// paramForwarded reports whether an incoming parameter may be appended to
+// the destination: it must match the allow list (if any) and neither deny
+// list. The campaign's allow list replaces the organization's. Patterns
+// ending in * match by prefix.
+func (c *Campaign) paramForwarded(settings *OrganizationSettings, name string) bool {
+	allow := c.ForwardParams
+	if len(allow) == 0 {
+		allow = settings.ForwardParams
+	}
+	if len(allow) > 0 && !matchesParamPattern(allow, name) {
+		return false
+	}
+	return !matchesParamPattern(c.BlockParams, name) && !matchesParamPattern(settings.BlockParams, name)
+}
+
+// matchesParamPattern reports whether name matches any pattern
+func matchesParamPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// buildDestinationURL renders the destination template of a campaign or
+// its variant from the request attributes, then appends the forwarded
+// incoming parameters when the campaign appends params. Parameters set by
+// the template win over incoming ones of the same name.
+func (re *RoutingEngine) buildDestinationURL(campaign *Campaign, variant *Variant, settings *OrganizationSettings, params map[string][]string, attrs Attributes) string {
+	tmpl := campaign.DestinationURL
+	variantName := ""
+	if variant != nil {
+		variantName = variant.Name
+		if variant.DestinationURL != "" {
+			tmpl = variant.DestinationURL
+		}
+	}
+
+	value := func(name string) (string, bool) {
+		switch name {
+		case MacroVariant:
+			return variantName, true
+		case MacroVisitorID:
+			return attrs[AttrVisitorID], true
+		case MacroCampaignID:
+			return campaign.CampaignID, true
+		}
+		if !isDestinationMacro(name) {
+			return "", false
+		}
+		return attrs[name], true
+	}
+
+	// Path values are path-escaped, query and fragment values query-escaped
+	path, rawQuery, hasQuery := strings.Cut(tmpl, "?")
+	destination := expandMacros(path, value, url.PathEscape)
+	if hasQuery {
+		destination += "?" + expandMacros(rawQuery, value, escapeQuery)
+	}
+
+	if !campaign.AppendParams || len(params) == 0 {
+		return destination
+	}
+
+	parsedURL, err := url.Parse(destination)
+	if err != nil {
+		slog.Warn("invalid destination URL", "url", destination, "error", err)
+		return destination
+	}
+
+	query := parsedURL.Query()
+	appended := false
+	for name, values := range params {
+		if query.Has(name) || !campaign.paramForwarded(settings, name) {
+			continue
+		}
+		for _, value := range values {
+			query.Add(name, value)
+		}
+		appended = true
+	}
+	if !appended {
+		return destination
+	}
+
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String()
+}
@@ -0,0 +1,112 @@
+package ingestion
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Headers set by CDNs and load balancers carrying the client's country
+var countryHeaders = []string{"cf-ipcountry", "x-appengine-country", "x-country-code", "cloudfront-viewer-country"}
+
+// Headers set by CDNs and load balancers carrying the client's city
+var cityHeaders = []string{"x-appengine-city", "cloudfront-viewer-city"}
+
+// enrichRequest derives lightweight enrichment from the captured request.
+// It only uses data already on the request so it is cheap enough for the
+// redirect path; heavier enrichment happens in the warehouse.
+func enrichRequest(raw RawRequest) EnrichedData {
+	enriched := EnrichedData{
+		Country:  strings.ToUpper(firstHeader(raw.Headers, countryHeaders)),
+		City:     firstHeader(raw.Headers, cityHeaders),
+		Referrer: raw.Headers["referer"],
+		Source:   firstParam(raw.Params, "utm_source", "source"),
+		Medium:   firstParam(raw.Params, "utm_medium", "medium"),
+	}
+
+	// "XX" and "T1" are placeholders some CDNs use for unknown and Tor
+	if len(enriched.Country) != 2 || enriched.Country == "XX" || enriched.Country == "T1" {
+		enriched.Country = ""
+	}
+
+	if enriched.Referrer != "" {
+		if parsed, err := url.Parse(enriched.Referrer); err == nil {
+			enriched.ReferrerDomain = strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+		}
+	}
+
+	enriched.DeviceType, enriched.OS, enriched.Browser = parseUserAgent(raw.Headers["user-agent"])
+
+	return enriched
+}
+
+// parseUserAgent classifies a user agent into device type, OS and browser family
+func parseUserAgent(ua string) (deviceType, os, browser string) {
+	if ua == "" {
+		return "", "", ""
+	}
+	lower := strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet"):
+		deviceType = "tablet"
+	case strings.Contains(lower, "android") && !strings.Contains(lower, "mobile"):
+		deviceType = "tablet"
+	case strings.Contains(lower, "mobile") || strings.Contains(lower, "iphone"):
+		deviceType = "mobile"
+	default:
+		deviceType = "desktop"
+	}
+
+	switch {
+	case strings.Contains(lower, "iphone") || strings.Contains(lower, "ipad") || strings.Contains(lower, "ios"):
+		os = "ios"
+	case strings.Contains(lower, "android"):
+		os = "android"
+	case strings.Contains(lower, "windows"):
+		os = "windows"
+	case strings.Contains(lower, "mac os") || strings.Contains(lower, "macintosh"):
+		os = "macos"
+	case strings.Contains(lower, "cros"):
+		os = "chromeos"
+	case strings.Contains(lower, "linux"):
+		os = "linux"
+	}
+
+	// Order matters: Edge and Opera also advertise Chrome, Chrome advertises Safari
+	switch {
+	case strings.Contains(lower, "edg/") || strings.Contains(lower, "edge/"):
+		browser = "edge"
+	case strings.Contains(lower, "opr/") || strings.Contains(lower, "opera"):
+		browser = "opera"
+	case strings.Contains(lower, "samsungbrowser"):
+		browser = "samsung"
+	case strings.Contains(lower, "firefox") || strings.Contains(lower, "fxios"):
+		browser = "firefox"
+	case strings.Contains(lower, "chrome") || strings.Contains(lower, "crios"):
+		browser = "chrome"
+	case strings.Contains(lower, "safari"):
+		browser = "safari"
+	}
+
+	return deviceType, os, browser
+}
+
+// firstHeader returns the first non-empty header among keys
+func firstHeader(headers map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := headers[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstParam returns the first non-empty query parameter among keys
+func firstParam(params map[string][]string, keys ...string) string {
+	for _, key := range keys {
+		if values := params[key]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package ingestion
+
+import (
+	"sort"
+	"time"
+)
+
+// Outcomes of a routing step
+const (
+	OutcomeMatched  = "matched"
+	OutcomeNotFound = "not_found"
+	OutcomeNotLive  = "not_live"
+	OutcomeNoMatch  = "no_match"
+	OutcomeShadow   = "shadow" // the campaign is in shadow mode
+)
+
+// RoutingTrace explains how a routing decision was reached
+type RoutingTrace struct {
+	OrganizationID string           `json:"organization_id"`
+	EvaluatedAt    time.Time        `json:"evaluated_at"` // in the organization's timezone
+	Reason         string           `json:"reason"`
+	CampaignID     string           `json:"campaign_id,omitempty"`
+	Variant        string           `json:"variant,omitempty"`
+	Destination    string           `json:"destination"`
+	Steps          []RoutingStep    `json:"steps"`
+	Candidates     []CandidateTrace `json:"candidates"`
+	Attributes     Attributes       `json:"attributes"`
+
+	rulesEvaluated bool
+}
+
+// RoutingStep is one stage of the routing fallback chain
+type RoutingStep struct {
+	Stage   string `json:"stage"` // a match reason
+	Outcome string `json:"outcome"`
+}
+
+// CandidateTrace is a campaign considered by rule matching
+type CandidateTrace struct {
+	CampaignID string      `json:"campaign_id"`
+	Name       string      `json:"name"`
+	Live       bool        `json:"live"`
+	Shadow     bool        `json:"shadow"`
+	Score      int         `json:"score"`
+	Winner     bool        `json:"winner"`
+	Rules      []RuleTrace `json:"rules"`
+}
+
+// RuleTrace is the evaluation of one campaign rule
+type RuleTrace struct {
+	Rule
+	Value   string `json:"value,omitempty"` // resolved request value
+	Present bool   `json:"present"`
+	Matched bool   `json:"matched"`
+}
+
+// Explain routes a request exactly like Route, at the given time, and
+// reports every step and candidate campaign of the organization
+func (re *RoutingEngine) Explain(organizationID, campaignID string, params map[string][]string, attrs Attributes, now time.Time) (*MatchResult, *RoutingTrace) {
+	trace := &RoutingTrace{
+		OrganizationID: organizationID,
+		EvaluatedAt:    now.In(re.OrganizationSettings(organizationID).Location()),
+		Attributes:     attrs,
+		Steps:          []RoutingStep{},
+		Candidates:     []CandidateTrace{},
+	}
+
+	match := re.route(organizationID, campaignID, params, attrs, now, trace)
+
+	// An explicit campaign wins before rules run; list the candidates anyway
+	if !trace.rulesEvaluated {
+		re.findBestMatch(organizationID, attrs, now, trace)
+	}
+
+	sort.Slice(trace.Candidates, func(i, j int) bool {
+		return trace.Candidates[i].CampaignID < trace.Candidates[j].CampaignID
+	})
+
+	trace.Reason = match.Reason
+	trace.Destination = match.Destination
+	if match.Campaign != nil {
+		trace.CampaignID = match.Campaign.CampaignID
+		if match.Reason == MatchReasonRules {
+			for i := range trace.Candidates {
+				trace.Candidates[i].Winner = trace.Candidates[i].CampaignID == trace.CampaignID
+			}
+		}
+	}
+	if match.Variant != nil {
+		trace.Variant = match.Variant.Name
+	}
+
+	return match, trace
+}
+
+// step records a routing stage; a nil trace records nothing
+func (t *RoutingTrace) step(stage, outcome string) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, RoutingStep{Stage: stage, Outcome: outcome})
+	if stage == MatchReasonRules {
+		t.rulesEvaluated = true
+	}
+}
+
+// candidate records a campaign considered by rule matching and returns the
+// entry its rules are recorded in; a nil trace returns nil
+func (t *RoutingTrace) candidate(campaign *Campaign) *CandidateTrace {
+	if t == nil {
+		return nil
+	}
+	t.Candidates = append(t.Candidates, CandidateTrace{
+		CampaignID: campaign.CampaignID,
+		Name:       campaign.Name,
+		Live:       campaign.isLiveAt(t.EvaluatedAt),
+		Shadow:     campaign.isShadowAt(t.EvaluatedAt),
+		Rules:      []RuleTrace{},
+	})
+	return &t.Candidates[len(t.Candidates)-1]
+}
+
+// rule records a rule evaluation; a nil candidate records nothing
+func (c *CandidateTrace) rule(rule Rule, attrs Attributes, now time.Time, matched bool) {
+	if c == nil {
+		return
+	}
+	value, present := ruleValue(rule.Field, attrs, now)
+	c.Rules = append(c.Rules, RuleTrace{Rule: rule, Value: value, Present: present, Matched: matched})
+}
@@ -0,0 +1,622 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Delivery states recorded in the delivery log
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Redis keys of the delivery queue
+const (
+	deliveryQueueKey  = "postback:deliveries"
+	deliveryKeyPrefix = "postback:delivery:"
+)
+
+// maxResponseLog caps the response body kept in the delivery log
+const maxResponseLog = 1024
+
+// ErrDeliveryInProgress is returned when replaying a delivery that is still queued
+var ErrDeliveryInProgress = errors.New("delivery is still in progress")
+
+// ErrDeliveryNotFound is returned for unknown deliveries
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// ErrForwardingDisabled is returned when replaying without a delivery queue
+var ErrForwardingDisabled = errors.New("outbound postback forwarding is not configured")
+
+// errPrivateDestination is returned when dialing a non-public address
+var errPrivateDestination = errors.New("destination address is not public")
+
+// claimDeliveries pops due deliveries off the queue by pushing them back a
+// lease period, so a delivery whose worker dies is picked up again
+var claimDeliveries = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+// Delivery is a rendered outbound postback request
+type Delivery struct {
+	DeliveryID     string            `json:"delivery_id"`
+	OrganizationID string            `json:"organization_id"`
+	PostbackID     string            `json:"postback_id"`
+	CampaignID     string            `json:"campaign_id"`
+	ClickID        string            `json:"click_id"`
+	Method         string            `json:"method"`
+	URL            string            `json:"url"`
+	ContentType    string            `json:"content_type,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Attempt        int               `json:"attempt"`   // attempts made so far
+	Remaining      int               `json:"remaining"` // attempts left before giving up
+}
+
+// DeliveryAttempt is a row of the delivery log
+type DeliveryAttempt struct {
+	DeliveryID    string            `json:"delivery_id"`
+	PostbackID    string            `json:"postback_id"`
+	CampaignID    string            `json:"campaign_id"`
+	ClickID       string            `json:"click_id"`
+	Attempt       int               `json:"attempt"`
+	State         string            `json:"state"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	StatusCode    int               `json:"status_code,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Response      string            `json:"response,omitempty"`
+	DurationMs    int64             `json:"duration_ms"`
+	AttemptedAt   time.Time         `json:"attempted_at"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+}
+
+// ForwarderConfig holds outbound delivery settings
+type ForwarderConfig struct {
+	MaxAttempts  int           // attempts before a delivery fails
+	Timeout      time.Duration // per-request timeout
+	Backoff      time.Duration // delay before the first retry, doubled per attempt
+	MaxBackoff   time.Duration // cap on the retry delay
+	Workers      int           // concurrent deliveries
+	AllowPrivate bool          // allow loopback and private destinations (local testing)
+}
+
+// Forwarder delivers outbound postbacks to traffic sources. Deliveries are
+// queued in Redis so they survive restarts and are shared across replicas,
+// retried with exponential backoff, and every attempt is logged to ClickHouse.
+// Without Redis nothing is forwarded; without ClickHouse nothing is logged.
+type Forwarder struct {
+	redis      *redis.Client
+	clickhouse clickhouse.Conn
+	metrics    Metrics
+	client     *http.Client
+	config     ForwarderConfig
+	lease      time.Duration
+}
+
+// NewForwarder creates an outbound postback forwarder
+func NewForwarder(redisClient *redis.Client, ch clickhouse.Conn, metrics Metrics, config ForwarderConfig) *Forwarder {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+
+	return &Forwarder{
+		redis:      redisClient,
+		clickhouse: ch,
+		metrics:    metrics,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, MaxIdleConnsPerHost: 10},
+			// Redirects are not followed so a destination can't bounce us elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		config: config,
+		lease:  2*config.Timeout + 30*time.Second,
+	}
+}
+
+// Enqueue renders a campaign's outbound postbacks triggered by a postback
+// and queues them for delivery
+func (f *Forwarder) Enqueue(ctx context.Context, campaign *Campaign, pb *Postback, click ClickRecord) {
+	if campaign == nil || f.redis == nil {
+		return
+	}
+
+	value := outboundValue(pb, click)
+	for i := range campaign.OutboundPostbacks {
+		outbound := &campaign.OutboundPostbacks[i]
+		if !outbound.triggersOn(pb.Status) {
+			continue
+		}
+
+		delivery := &Delivery{
+			DeliveryID:     uuid.New().String(),
+			OrganizationID: pb.OrganizationID,
+			PostbackID:     pb.PostbackID,
+			CampaignID:     campaign.CampaignID,
+			ClickID:        pb.ClickID,
+			Method:         strings.ToUpper(outbound.Method),
+			URL:            expandMacros(outbound.URL, value, escapeQuery),
+			ContentType:    outbound.ContentType,
+			Body:           expandMacros(outbound.Body, value, outbound.bodyEscape()),
+			Remaining:      f.config.MaxAttempts,
+		}
+		if delivery.Method == "" {
+			delivery.Method = http.MethodGet
+		}
+		if len(outbound.Headers) > 0 {
+			delivery.Headers = make(map[string]string, len(outbound.Headers))
+			for name, tmpl := range outbound.Headers {
+				delivery.Headers[name] = expandMacros(tmpl, value, escapeNone)
+			}
+		}
+
+		if err := f.schedule(ctx, delivery, time.Now()); err != nil {
+			slog.Error("failed to queue outbound postback", "error", err,
+				"organization_id", pb.OrganizationID,
+				"postback_id", pb.PostbackID)
+			continue
+		}
+		f.logAttempt(ctx, delivery, DeliveryAttempt{State: DeliveryPending, AttemptedAt: time.Now().UTC()})
+	}
+}
+
+// Replay queues a logged delivery again with a fresh retry budget
+func (f *Forwarder) Replay(ctx context.Context, organizationID, deliveryID string) (*Delivery, error) {
+	if f.redis == nil {
+		return nil, ErrForwardingDisabled
+	}
+
+	exists, err := f.redis.Exists(ctx, deliveryKeyPrefix+deliveryID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check delivery queue: %w", err)
+	}
+	if exists > 0 {
+		return nil, ErrDeliveryInProgress
+	}
+
+	attempts, err := f.Attempts(ctx, organizationID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	last := attempts[len(attempts)-1]
+
+	delivery := &Delivery{
+		DeliveryID:     deliveryID,
+		OrganizationID: organizationID,
+		PostbackID:     last.PostbackID,
+		CampaignID:     last.CampaignID,
+		ClickID:        last.ClickID,
+		Method:         last.Method,
+		URL:            last.URL,
+		ContentType:    last.ContentType,
+		Body:           last.Body,
+		Headers:        last.Headers,
+		Attempt:        last.Attempt,
+		Remaining:      f.config.MaxAttempts,
+	}
+	if err := f.schedule(ctx, delivery, time.Now()); err != nil {
+		return nil, err
+	}
+	f.logAttempt(ctx, delivery, DeliveryAttempt{State: DeliveryPending, AttemptedAt: time.Now().UTC()})
+	return delivery, nil
+}
+
+// Run delivers queued postbacks until ctx is cancelled. Cancellation stops
+// claiming; deliveries in flight run to completion, bounded by the request
+// timeout, and Run returns once they have.
+func (f *Forwarder) Run(ctx context.Context) {
+	if f.redis == nil {
+		slog.Warn("outbound postback forwarding disabled: no redis client")
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, f.config.Workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Deliveries outlive shutdown so a postback isn't cut off mid-request
+	deliveryCtx := context.WithoutCancel(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		ids, err := claimDeliveries.Run(ctx, f.redis, []string{deliveryQueueKey},
+			now.UnixMilli(), f.config.Workers, now.Add(f.lease).UnixMilli()).StringSlice()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				slog.Warn("failed to claim outbound postbacks", "error", err)
+			}
+			continue
+		}
+		if depth, err := f.redis.ZCard(ctx, deliveryQueueKey).Result(); err == nil {
+			f.metrics.SetQueueDepth(QueuePostbackDeliveries, int(depth))
+		}
+
+		for _, id := range ids {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(id string) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				f.deliver(deliveryCtx, id)
+			}(id)
+		}
+	}
+}
+
+// deliver makes one attempt at a claimed delivery and reschedules or finishes it
+func (f *Forwarder) deliver(ctx context.Context, deliveryID string) {
+	data, err := f.redis.Get(ctx, deliveryKeyPrefix+deliveryID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		f.redis.ZRem(ctx, deliveryQueueKey, deliveryID)
+		return
+	}
+	if err != nil {
+		slog.Warn("failed to load outbound postback", "error", err, "delivery_id", deliveryID)
+		return
+	}
+
+	var delivery Delivery
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		slog.Error("invalid queued outbound postback", "error", err, "delivery_id", deliveryID)
+		f.finish(ctx, deliveryID)
+		return
+	}
+
+	delivery.Attempt++
+	delivery.Remaining--
+	attempt := f.send(ctx, &delivery)
+
+	switch {
+	case attempt.State == DeliveryDelivered:
+		f.finish(ctx, deliveryID)
+	case attempt.State == DeliveryRetrying && delivery.Remaining > 0:
+		next := time.Now().Add(f.backoff(delivery.Attempt)).UTC()
+		attempt.NextAttemptAt = &next
+		if err := f.schedule(ctx, &delivery, next); err != nil {
+			slog.Error("failed to reschedule outbound postback", "error", err, "delivery_id", deliveryID)
+		}
+	default:
+		attempt.State = DeliveryFailed
+		f.finish(ctx, deliveryID)
+		slog.Warn("outbound postback failed",
+			"organization_id", delivery.OrganizationID,
+			"delivery_id", deliveryID,
+			"attempts", delivery.Attempt,
+			"status_code", attempt.StatusCode,
+			"error", attempt.Error)
+	}
+
+	f.logAttempt(ctx, &delivery, attempt)
+}
+
+// send performs the HTTP request of a delivery. Network errors, timeouts,
+// 408, 429 and 5xx responses are retried; other failures, including
+// non-public destinations, are permanent.
+func (f *Forwarder) send(ctx context.Context, delivery *Delivery) DeliveryAttempt {
+	start := time.Now()
+	attempt := DeliveryAttempt{AttemptedAt: start.UTC()}
+
+	var body io.Reader
+	if delivery.Body != "" {
+		body = strings.NewReader(delivery.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, delivery.Method, delivery.URL, body)
+	if err != nil {
+		attempt.State = DeliveryFailed
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("User-Agent", "Trellis-Postback/1.0")
+	if delivery.ContentType != "" {
+		req.Header.Set("Content-Type", delivery.ContentType)
+	}
+	for name, value := range delivery.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := f.client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.State = DeliveryRetrying
+		if errors.Is(err, errPrivateDestination) {
+			attempt.State = DeliveryFailed
+		}
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(response)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		attempt.State = DeliveryDelivered
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		attempt.State = DeliveryRetrying
+	default:
+		attempt.State = DeliveryFailed
+	}
+	return attempt
+}
+
+// schedule stores a delivery and queues it for due
+func (f *Forwarder) schedule(ctx context.Context, delivery *Delivery, due time.Time) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery: %w", err)
+	}
+
+	_, err = f.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, deliveryKeyPrefix+delivery.DeliveryID, data, 0)
+		pipe.ZAdd(ctx, deliveryQueueKey, redis.Z{Score: float64(due.UnixMilli()), Member: delivery.DeliveryID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	return nil
+}
+
+// finish removes a delivery from the queue
+func (f *Forwarder) finish(ctx context.Context, deliveryID string) {
+	_, err := f.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, deliveryQueueKey, deliveryID)
+		pipe.Del(ctx, deliveryKeyPrefix+deliveryID)
+		return nil
+	})
+	if err != nil {
+		slog.Warn("failed to remove outbound postback from queue", "error", err, "delivery_id", deliveryID)
+	}
+}
+
+// backoff returns the delay before retrying after the given attempt, with jitter
+func (f *Forwarder) backoff(attempt int) time.Duration {
+	delay := f.config.Backoff
+	for i := 1; i < attempt && delay < f.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > f.config.MaxBackoff {
+		delay = f.config.MaxBackoff
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// logAttempt writes a delivery log row
+func (f *Forwarder) logAttempt(ctx context.Context, delivery *Delivery, attempt DeliveryAttempt) {
+	if f.clickhouse == nil {
+		return
+	}
+
+	query := `
+		INSERT INTO postback_deliveries (
+			delivery_id, organization_id, postback_id, campaign_id, click_id,
+			attempt, state, method, url, content_type, body, headers,
+			status_code, error, response, duration_ms, attempted_at, next_attempt_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	err := f.clickhouse.Exec(ctx, query,
+		delivery.DeliveryID,
+		delivery.OrganizationID,
+		delivery.PostbackID,
+		delivery.CampaignID,
+		delivery.ClickID,
+		uint16(delivery.Attempt),
+		attempt.State,
+		delivery.Method,
+		delivery.URL,
+		delivery.ContentType,
+		delivery.Body,
+		delivery.Headers,
+		uint16(attempt.StatusCode),
+		attempt.Error,
+		attempt.Response,
+		uint32(attempt.DurationMs),
+		attempt.AttemptedAt,
+		attempt.NextAttemptAt,
+	)
+	if err != nil {
+		slog.Warn("failed to log outbound postback attempt", "error", err, "delivery_id", delivery.DeliveryID)
+	}
+}
+
+// Deliveries returns the latest state of an organization's deliveries,
+// newest first, optionally for one postback or in one state
+func (f *Forwarder) Deliveries(ctx context.Context, organizationID, postbackID, state string, limit int) ([]DeliveryAttempt, error) {
+	if f.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+
+	query := `
+		SELECT
+			delivery_id,
+			any(postback_id),
+			any(campaign_id),
+			any(click_id),
+			max(attempt),
+			argMax(state, attempted_at) AS latest_state,
+			any(method),
+			any(url),
+			argMax(status_code, attempted_at),
+			argMax(error, attempted_at),
+			max(attempted_at) AS last_attempt_at,
+			argMax(next_attempt_at, attempted_at)
+		FROM postback_deliveries
+		WHERE organization_id = ?
+		  AND (? = '' OR postback_id = ?)
+		GROUP BY delivery_id
+		HAVING ? = '' OR latest_state = ?
+		ORDER BY last_attempt_at DESC
+		LIMIT ?
+	`
+
+	rows, err := f.clickhouse.Query(ctx, query, organizationID, postbackID, postbackID, state, state, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []DeliveryAttempt{}
+	for rows.Next() {
+		var d DeliveryAttempt
+		var attempt, statusCode uint16
+		err := rows.Scan(
+			&d.DeliveryID,
+			&d.PostbackID,
+			&d.CampaignID,
+			&d.ClickID,
+			&attempt,
+			&d.State,
+			&d.Method,
+			&d.URL,
+			&statusCode,
+			&d.Error,
+			&d.AttemptedAt,
+			&d.NextAttemptAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		d.Attempt = int(attempt)
+		d.StatusCode = int(statusCode)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// Attempts returns the delivery log of one delivery, oldest first
+func (f *Forwarder) Attempts(ctx context.Context, organizationID, deliveryID string) ([]DeliveryAttempt, error) {
+	if f.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+
+	query := `
+		SELECT
+			delivery_id,
+			postback_id,
+			campaign_id,
+			click_id,
+			attempt,
+			state,
+			method,
+			url,
+			content_type,
+			body,
+			headers,
+			status_code,
+			error,
+			response,
+			duration_ms,
+			attempted_at,
+			next_attempt_at
+		FROM postback_deliveries
+		WHERE organization_id = ? AND delivery_id = ?
+		ORDER BY attempted_at
+	`
+
+	rows, err := f.clickhouse.Query(ctx, query, organizationID, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []DeliveryAttempt
+	for rows.Next() {
+		var a DeliveryAttempt
+		var attempt, statusCode uint16
+		var duration uint32
+		err := rows.Scan(
+			&a.DeliveryID,
+			&a.PostbackID,
+			&a.CampaignID,
+			&a.ClickID,
+			&attempt,
+			&a.State,
+			&a.Method,
+			&a.URL,
+			&a.ContentType,
+			&a.Body,
+			&a.Headers,
+			&statusCode,
+			&a.Error,
+			&a.Response,
+			&duration,
+			&a.AttemptedAt,
+			&a.NextAttemptAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery attempt: %w", err)
+		}
+		a.Attempt = int(attempt)
+		a.StatusCode = int(statusCode)
+		a.DurationMs = int64(duration)
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+// rejectPrivateAddress refuses connections to loopback, private, link-local
+// and other non-public addresses, so templates can't reach internal services
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return fmt.Errorf("%w: %s", errPrivateDestination, addr)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// deliveryLog is an in-memory postback_deliveries table. It implements the
+// insert and the attempts query of the forwarder; other calls panic.
+type deliveryLog struct {
+	driver.Conn
+
+	mu   sync.Mutex
+	rows [][]interface{} // insert arguments, in column order
+}
+
+func (l *deliveryLog) Exec(ctx context.Context, query string, args ...interface{}) error {
+	if !strings.Contains(query, "INSERT INTO postback_deliveries") {
+		return errors.New("unexpected exec")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rows = append(l.rows, args)
+	return nil
+}
+
+func (l *deliveryLog) Query(ctx context.Context, query string, args ...interface{}) (driver.Rows, error) {
+	if !strings.Contains(query, "WHERE organization_id = ? AND delivery_id = ?") {
+		return nil, errors.New("unexpected query")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Attempts selects every inserted column but organization_id
+	rows := &logRows{}
+	for _, row := range l.rows {
+		if row[1] == args[0] && row[0] == args[1] {
+			rows.rows = append(rows.rows, append([]interface{}{row[0]}, row[2:]...))
+		}
+	}
+	return rows, nil
+}
+
+// states returns the logged states of a delivery in order
+func (l *deliveryLog) states(deliveryID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var states []string
+	for _, row := range l.rows {
+		if row[0] == deliveryID {
+			states = append(states, row[6].(string))
+		}
+	}
+	return states
+}
+
+type logRows struct {
+	driver.Rows
+	rows [][]interface{}
+	next int
+}
+
+func (r *logRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *logRows) Scan(dest ...interface{}) error {
+	for i, value := range r.rows[r.next-1] {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (r *logRows) Close() error { return nil }
+func (r *logRows) Err() error   { return nil }
+
+// nopMetrics discards metrics
+type nopMetrics struct{}
+
+func (nopMetrics) RecordRedirect(time.Duration, string, string) {}
+func (nopMetrics) RecordEvent(string)                           {}
+func (nopMetrics) RecordDuplicate(string)                       {}
+func (nopMetrics) RecordFraud(string, string)                   {}
+func (nopMetrics) RecordPublishFailure(string)                  {}
+func (nopMetrics) SetQueueDepth(string, int)                    {}
+
+// stubSource is a traffic source answering postbacks with queued status codes
+type stubSource struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []string
+}
+
+func newStubSource(t *testing.T, statuses ...int) *stubSource {
+	s := &stubSource{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubSource) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+var testForwarderConfig = ForwarderConfig{
+	MaxAttempts:  3,
+	Timeout:      time.Second,
+	Backoff:      time.Minute,
+	MaxBackoff:   10 * time.Minute,
+	Workers:      1,
+	AllowPrivate: true,
+}
+
+func newTestForwarder(t *testing.T, config ForwarderConfig) (*Forwarder, *miniredis.Miniredis, *deliveryLog) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	log := &deliveryLog{}
+	return NewForwarder(client, log, nopMetrics{}, config), mr, log
+}
+
+// enqueueOne queues the campaign's outbound postback for an approved
+// conversion and returns its delivery ID
+func enqueueOne(t *testing.T, f *Forwarder, mr *miniredis.Miniredis, url string) string {
+	campaign := &Campaign{
+		CampaignID:        "summer",
+		OutboundPostbacks: []OutboundPostback{{URL: url + "/pb?cid={click_id}&v={value}"}},
+	}
+	value := 12.5
+	pb := &Postback{
+		PostbackID:     "pb-1",
+		OrganizationID: "org",
+		ClickID:        "click-1",
+		Status:         PostbackStatusApproved,
+		Value:          &value,
+	}
+	f.Enqueue(context.Background(), campaign, pb, ClickRecord{})
+
+	ids, err := mr.ZMembers(deliveryQueueKey)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("queued deliveries = %v, %v, want one", ids, err)
+	}
+	return ids[0]
+}
+
+// queued returns the due time of a queued delivery, or false if it isn't queued
+func queued(t *testing.T, mr *miniredis.Miniredis, deliveryID string) (time.Time, bool) {
+	if !mr.Exists(deliveryKeyPrefix + deliveryID) {
+		return time.Time{}, false
+	}
+	score, err := mr.ZScore(deliveryQueueKey, deliveryID)
+	if err != nil {
+		t.Fatalf("delivery %s stored but not in the queue: %v", deliveryID, err)
+	}
+	return time.UnixMilli(int64(score)), true
+}
+
+func TestForwarderDelivers(t *testing.T) {
+	source := newStubSource(t, http.StatusOK)
+	f, mr, log := newTestForwarder(t, testForwarderConfig)
+
+	id := enqueueOne(t, f, mr, source.URL)
+	f.deliver(context.Background(), id)
+
+	if got := source.received(); len(got) != 1 || got[0] != "/pb?cid=click-1&v=12.5" {
+		t.Errorf("source received %v, want one postback with the click ID and value", got)
+	}
+	if _, ok := queued(t, mr, id); ok {
+		t.Error("delivered postback is still queued")
+	}
+	if got, want := log.states(id), []string{DeliveryPending, DeliveryDelivered}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged states = %v, want %v", got, want)
+	}
+}
+
+func TestForwarderRetries(t *testing.T) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusRequestTimeout} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			source := newStubSource(t, status)
+			f, mr, log := newTestForwarder(t, testForwarderConfig)
+
+			id := enqueueOne(t, f, mr, source.URL)
+			before := time.Now()
+			f.deliver(context.Background(), id)
+
+			due, ok := queued(t, mr, id)
+			if !ok {
+				t.Fatal("retryable failure was not requeued")
+			}
+			if min, max := before.Add(time.Minute), time.Now().Add(time.Minute+12*time.Second); due.Before(min.Truncate(time.Millisecond)) || due.After(max) {
+				t.Errorf("retry due at %v, want between %v and %v", due, min, max)
+			}
+			if got, want := log.states(id), []string{DeliveryPending, DeliveryRetrying}; !reflect.DeepEqual(got, want) {
+				t.Errorf("logged states = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestForwarderPermanentFailure(t *testing.T) {
+	source := newStubSource(t, http.StatusBadRequest)
+	f, mr, log := newTestForwarder(t, testForwarderConfig)
+
+	id := enqueueOne(t, f, mr, source.URL)
+	f.deliver(context.Background(), id)
+
+	if _, ok := queued(t, mr, id); ok {
+		t.Error("permanently failed postback is still queued")
+	}
+	if got, want := log.states(id), []string{DeliveryPending, DeliveryFailed}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged states = %v, want %v", got, want)
+	}
+}
+
+func TestForwarderGivesUpAfterMaxAttempts(t *testing.T) {
+	source := newStubSource(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	config := testForwarderConfig
+	config.MaxAttempts = 2
+	f, mr, log := newTestForwarder(t, config)
+
+	id := enqueueOne(t, f, mr, source.URL)
+	f.deliver(context.Background(), id)
+	f.deliver(context.Background(), id)
+
+	if _, ok := queued(t, mr, id); ok {
+		t.Error("postback is still queued after its last attempt")
+	}
+	if got, want := log.states(id), []string{DeliveryPending, DeliveryRetrying, DeliveryFailed}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged states = %v, want %v", got, want)
+	}
+	if got := len(source.received()); got != 2 {
+		t.Errorf("source received %d postbacks, want 2", got)
+	}
+}
+
+func TestForwarderBackoff(t *testing.T) {
+	f := NewForwarder(nil, nil, nopMetrics{}, testForwarderConfig)
+
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute}, // capped
+		{9, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			// Jitter adds up to a fifth of the delay
+			if got := f.backoff(tt.attempt); got < tt.base || got > tt.base+tt.base/5 {
+				t.Fatalf("backoff(%d) = %v, want %v plus up to 20%%", tt.attempt, got, tt.base)
+			}
+		}
+	}
+}
+
+func TestForwarderReplay(t *testing.T) {
+	source := newStubSource(t, http.StatusBadRequest, http.StatusOK)
+	f, mr, log := newTestForwarder(t, testForwarderConfig)
+	ctx := context.Background()
+
+	id := enqueueOne(t, f, mr, source.URL)
+	if _, err := f.Replay(ctx, "org", id); !errors.Is(err, ErrDeliveryInProgress) {
+		t.Fatalf("Replay() of a queued delivery error = %v, want ErrDeliveryInProgress", err)
+	}
+
+	f.deliver(ctx, id)
+	delivery, err := f.Replay(ctx, "org", id)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if delivery.Remaining != testForwarderConfig.MaxAttempts || delivery.Attempt != 1 {
+		t.Errorf("replayed delivery attempt %d with %d remaining, want 1 with %d", delivery.Attempt, delivery.Remaining, testForwarderConfig.MaxAttempts)
+	}
+	if _, ok := queued(t, mr, id); !ok {
+		t.Fatal("replayed delivery is not queued")
+	}
+
+	f.deliver(ctx, id)
+	if got, want := log.states(id), []string{DeliveryPending, DeliveryFailed, DeliveryPending, DeliveryDelivered}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged states = %v, want %v", got, want)
+	}
+	if got := source.received(); len(got) != 2 || got[0] != got[1] {
+		t.Errorf("source received %v, want the same postback twice", got)
+	}
+
+	if _, err := f.Replay(ctx, "org", "unknown"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Replay() of an unknown delivery error = %v, want ErrDeliveryNotFound", err)
+	}
+	if _, err := f.Replay(ctx, "other-org", id); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("Replay() of another organization's delivery error = %v, want ErrDeliveryNotFound", err)
+	}
+}
+
+func TestForwarderWithoutClients(t *testing.T) {
+	f := NewForwarder(nil, nil, nopMetrics{}, testForwarderConfig)
+	ctx := context.Background()
+
+	campaign := &Campaign{OutboundPostbacks: []OutboundPostback{{URL: "https://example.com/pb"}}}
+	f.Enqueue(ctx, campaign, &Postback{Status: PostbackStatusApproved}, ClickRecord{})
+	f.logAttempt(ctx, &Delivery{}, DeliveryAttempt{})
+
+	if _, err := f.Replay(ctx, "org", "id"); !errors.Is(err, ErrForwardingDisabled) {
+		t.Errorf("Replay() error = %v, want ErrForwardingDisabled", err)
+	}
+	if _, err := f.Attempts(ctx, "org", "id"); !errors.Is(err, ErrNoWarehouse) {
+		t.Errorf("Attempts() error = %v, want ErrNoWarehouse", err)
+	}
+}
+
+func TestForwarderRunFinishesInFlightDeliveries(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-release:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+		}
+	}))
+	defer source.Close()
+
+	f, mr, log := newTestForwarder(t, testForwarderConfig)
+	id := enqueueOne(t, f, mr, source.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery was not claimed")
+	}
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Run() returned with a delivery in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the delivery finished")
+	}
+	if _, ok := queued(t, mr, id); ok {
+		t.Error("delivered postback is still queued")
+	}
+	if got, want := log.states(id), []string{DeliveryPending, DeliveryDelivered}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged states = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package ingestion
+
+import (
+	"context"
+	"time"
+
+	"github.com/orchard9/trellis/ingress/internal/ipintel"
+)
+
+// FraudAction is the routing decision derived from a fraud score
+type FraudAction string
+
+const (
+	FraudActionAllow    FraudAction = "allow"     // redirect normally
+	FraudActionSafePage FraudAction = "safe_page" // redirect to the organization's safe page
+	FraudActionBlock    FraudAction = "block"     // refuse the request
+)
+
+// FraudSignal is a single piece of fraud evidence contributed by a detector
+type FraudSignal struct {
+	Flag   string
+	Weight float32 // 0-1, how strongly the signal indicates fraud
+}
+
+// FraudInput is everything a detector may inspect
+type FraudInput struct {
+	Event    *Event
+	Attrs    Attributes
+	Settings *OrganizationSettings
+
+	// ClickTime is the time of the originating click for conversions, zero if unknown
+	ClickTime time.Time
+
+	// Bot is the outcome of known bot detection
+	Bot BotResult
+}
+
+// FraudDetector inspects a request and contributes fraud signals.
+// Detectors must be fast and must not fail the request; on internal
+// errors they simply return no signals.
+type FraudDetector interface {
+	Detect(ctx context.Context, in *FraudInput) []FraudSignal
+}
+
+// FraudVerdict is the combined result of a fraud chain evaluation
+type FraudVerdict struct {
+	Score  float32
+	Flags  []string
+	Action FraudAction
+}
+
+// FraudChain runs a list of detectors and combines their signals
+type FraudChain struct {
+	detectors []FraudDetector
+}
+
+// NewFraudChain creates a fraud chain from the given detectors
+func NewFraudChain(detectors ...FraudDetector) *FraudChain {
+	return &FraudChain{detectors: detectors}
+}
+
+// Evaluate runs all detectors and scores the request. Signal weights are
+// combined as independent probabilities (1 - Π(1 - w)) so the score stays
+// in [0, 1] and several weak signals add up to a strong one. Addresses on
+// the organization's allow list are trusted and not scored.
+func (c *FraudChain) Evaluate(ctx context.Context, in *FraudInput) FraudVerdict {
+	verdict := FraudVerdict{Action: FraudActionAllow}
+	for _, list := range in.Event.Enriched.IPLists {
+		if list == ipintel.ListOrgAllow {
+			return verdict
+		}
+	}
+	clean := float32(1)
+
+	for _, detector := range c.detectors {
+		for _, signal := range detector.Detect(ctx, in) {
+			verdict.Flags = append(verdict.Flags, signal.Flag)
+			clean *= 1 - clamp01(signal.Weight)
+		}
+	}
+	verdict.Score = 1 - clean
+
+	settings := in.Settings
+	switch {
+	case settings.FraudBlockThreshold > 0 && verdict.Score >= settings.FraudBlockThreshold:
+		verdict.Action = FraudActionBlock
+	case settings.FraudReviewThreshold > 0 && verdict.Score >= settings.FraudReviewThreshold && settings.SafePageURL != "":
+		verdict.Action = FraudActionSafePage
+	}
+
+	return verdict
+}
+
+// clamp01 limits a weight to [0, 1]
+func clamp01(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,274 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+	"github.com/orchard9/trellis/ingress/internal/ipintel"
+	"github.com/orchard9/trellis/ingress/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// DuplicateDetector flags clicks already marked as duplicates by the Deduplicator
+type DuplicateDetector struct {
+	Weight float32
+}
+
+// Detect implements FraudDetector
+func (d *DuplicateDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if !in.Event.IsDuplicate {
+		return nil
+	}
+	return []FraudSignal{{Flag: "duplicate_click", Weight: d.Weight}}
+}
+
+// SpoofedCrawlerDetector flags user agents claiming to be a search crawler
+// whose IP failed reverse DNS verification
+type SpoofedCrawlerDetector struct{}
+
+// Detect implements FraudDetector
+func (d *SpoofedCrawlerDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if !in.Bot.Spoofed {
+		return nil
+	}
+	return []FraudSignal{{Flag: "spoofed_crawler", Weight: 0.8}}
+}
+
+// headlessMarkers are user agent fragments of automation tools and headless browsers
+var headlessMarkers = []string{
+	"headlesschrome", "phantomjs", "puppeteer", "playwright", "selenium",
+	"webdriver", "electron", "python-requests", "python-urllib", "curl/",
+	"wget/", "go-http-client", "okhttp", "java/", "libwww-perl", "httpclient",
+}
+
+// UserAgentDetector flags missing and headless/automation user agents
+type UserAgentDetector struct{}
+
+// Detect implements FraudDetector
+func (d *UserAgentDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if in.Event.EventType == EventTypePostback {
+		return nil
+	}
+
+	ua := strings.ToLower(in.Attrs[AttrUserAgent])
+	if ua == "" {
+		return []FraudSignal{{Flag: "missing_user_agent", Weight: 0.5}}
+	}
+	for _, marker := range headlessMarkers {
+		if strings.Contains(ua, marker) {
+			return []FraudSignal{{Flag: "headless_user_agent", Weight: 0.7}}
+		}
+	}
+	return nil
+}
+
+// AcceptLanguageDetector flags browser traffic without an Accept-Language header,
+// which real browsers always send
+type AcceptLanguageDetector struct{}
+
+// Detect implements FraudDetector
+func (d *AcceptLanguageDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if in.Event.EventType == EventTypePostback {
+		return nil
+	}
+	if _, ok := in.Attrs[AttrHeaderPrefix+"accept-language"]; ok {
+		return nil
+	}
+	return []FraudSignal{{Flag: "missing_accept_language", Weight: 0.25}}
+}
+
+// ASNDetector flags traffic from datacenter and hosting autonomous systems.
+// The ASN is read from a header set by the edge (e.g. "X-Client-ASN").
+type ASNDetector struct {
+	header         string
+	datacenterASNs map[uint32]bool
+}
+
+// NewASNDetector creates a detector reading the ASN from header
+func NewASNDetector(header string, datacenterASNs []uint32) *ASNDetector {
+	asns := make(map[uint32]bool, len(datacenterASNs))
+	for _, asn := range datacenterASNs {
+		asns[asn] = true
+	}
+	return &ASNDetector{
+		header:         strings.ToLower(header),
+		datacenterASNs: asns,
+	}
+}
+
+// Detect implements FraudDetector
+func (d *ASNDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if d.header == "" || in.Event.EventType == EventTypePostback {
+		return nil
+	}
+	value := strings.TrimPrefix(strings.ToUpper(in.Attrs[AttrHeaderPrefix+d.header]), "AS")
+	if value == "" {
+		return nil
+	}
+	asn, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil
+	}
+	if d.datacenterASNs[uint32(asn)] {
+		return []FraudSignal{{Flag: "datacenter_asn", Weight: 0.6}}
+	}
+	return nil
+}
+
+// VelocityDetector flags IPs and visitors clicking faster than allowed.
+// Counters live in Redis so limits are shared across replicas; without a
+// client the detector reports nothing.
+type VelocityDetector struct {
+	redis         *redis.Client
+	window        time.Duration
+	maxPerIP      atomic.Int64
+	maxPerVisitor atomic.Int64
+	timeout       time.Duration
+}
+
+// NewVelocityDetector creates a velocity detector; a zero limit disables that check
+func NewVelocityDetector(redisClient *redis.Client, window time.Duration, maxPerIP, maxPerVisitor int64, timeout time.Duration) *VelocityDetector {
+	d := &VelocityDetector{
+		redis:   redisClient,
+		window:  window,
+		timeout: timeout,
+	}
+	d.SetLimits(maxPerIP, maxPerVisitor)
+	return d
+}
+
+// SetLimits changes the click limits per window, e.g. on config reload
+func (d *VelocityDetector) SetLimits(maxPerIP, maxPerVisitor int64) {
+	d.maxPerIP.Store(maxPerIP)
+	d.maxPerVisitor.Store(maxPerVisitor)
+}
+
+// Detect implements FraudDetector
+func (d *VelocityDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	event := in.Event
+	if event.EventType != EventTypeClick || d.redis == nil {
+		return nil
+	}
+
+	maxPerIP, maxPerVisitor := d.maxPerIP.Load(), d.maxPerVisitor.Load()
+
+	redisCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	var ipCount, visitorCount *redis.IntCmd
+	_, err := d.redis.Pipelined(redisCtx, func(pipe redis.Pipeliner) error {
+		if client := clientip.ClientKey(event.RawRequest.IP); maxPerIP > 0 && client != "" {
+			key := fmt.Sprintf("velocity:%s:ip:%s", event.OrganizationID, client)
+			ipCount = pipe.Incr(redisCtx, key)
+			pipe.ExpireNX(redisCtx, key, d.window)
+		}
+		if maxPerVisitor > 0 && event.UserID != "" {
+			key := fmt.Sprintf("velocity:%s:visitor:%s", event.OrganizationID, event.UserID)
+			visitorCount = pipe.Incr(redisCtx, key)
+			pipe.ExpireNX(redisCtx, key, d.window)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("velocity check failed", "error", err, "organization_id", event.OrganizationID)
+		return nil
+	}
+
+	var signals []FraudSignal
+	if ipCount != nil && ipCount.Val() > maxPerIP {
+		signals = append(signals, FraudSignal{Flag: "ip_velocity", Weight: 0.5})
+	}
+	if visitorCount != nil && visitorCount.Val() > maxPerVisitor {
+		signals = append(signals, FraudSignal{Flag: "visitor_velocity", Weight: 0.5})
+	}
+	return signals
+}
+
+// ConversionTimingDetector flags conversions arriving impossibly soon after
+// (or before) their click
+type ConversionTimingDetector struct {
+	minDelay atomic.Int64 // time.Duration
+}
+
+// NewConversionTimingDetector creates a detector flagging conversions faster than minDelay
+func NewConversionTimingDetector(minDelay time.Duration) *ConversionTimingDetector {
+	d := &ConversionTimingDetector{}
+	d.SetMinDelay(minDelay)
+	return d
+}
+
+// SetMinDelay changes the fastest plausible conversion, e.g. on config reload
+func (d *ConversionTimingDetector) SetMinDelay(minDelay time.Duration) {
+	d.minDelay.Store(int64(minDelay))
+}
+
+// Detect implements FraudDetector
+func (d *ConversionTimingDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	if in.Event.EventType != EventTypePostback || in.ClickTime.IsZero() {
+		return nil
+	}
+
+	delay := time.Unix(0, in.Event.Timestamp).Sub(in.ClickTime)
+	switch {
+	case delay < 0:
+		return []FraudSignal{{Flag: "conversion_before_click", Weight: 0.9}}
+	case delay < time.Duration(d.minDelay.Load()):
+		return []FraudSignal{{Flag: "fast_conversion", Weight: 0.6}}
+	}
+	return nil
+}
+
+// DefaultIPListWeights are the fraud weights of well-known IP lists
+var DefaultIPListWeights = map[string]float32{
+	"datacenter":        0.6,
+	"tor":               0.7,
+	"proxy":             0.6,
+	ipintel.ListOrgDeny: 1,
+}
+
+// IPReputationDetector flags clients on weighted IP lists (datacenter
+// ranges, Tor exits, organization deny lists). Global lists are ignored for
+// postbacks, which legitimately come from partner servers.
+type IPReputationDetector struct {
+	weights map[string]float32
+}
+
+// NewIPReputationDetector creates a detector with per-list weights; lists
+// without a weight do not contribute to the score
+func NewIPReputationDetector(weights map[string]float32) *IPReputationDetector {
+	return &IPReputationDetector{weights: weights}
+}
+
+// Detect implements FraudDetector
+func (d *IPReputationDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	var signals []FraudSignal
+	for _, list := range in.Event.Enriched.IPLists {
+		if list != ipintel.ListOrgDeny && in.Event.EventType == EventTypePostback {
+			continue
+		}
+		if weight, ok := d.weights[list]; ok {
+			signals = append(signals, FraudSignal{Flag: "ip_list_" + list, Weight: weight})
+		}
+	}
+	return signals
+}
+
+// RateLimitDetector flags requests that exceeded a rate limit but were let
+// through so the click still redirects. The flag carries no weight; limits
+// protect capacity and are not evidence of fraud on their own.
+type RateLimitDetector struct{}
+
+// Detect implements FraudDetector
+func (d *RateLimitDetector) Detect(ctx context.Context, in *FraudInput) []FraudSignal {
+	scope, ok := ratelimit.LimitedScope(ctx)
+	if !ok {
+		return nil
+	}
+	return []FraudSignal{{Flag: "rate_limited_" + scope, Weight: 0}}
+}
@@ -3,10 +3,14 @@ package ingestion
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"log/slog"
@@ -14,31 +18,73 @@ import (
 	"cloud.google.com/go/pubsub"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/orchard9/trellis/internal/auth"
-	"github.com/redis/go-redis/v9"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+	"github.com/orchard9/trellis/ingress/internal/ipintel"
+	"github.com/orchard9/trellis/ingress/internal/logging"
+	"github.com/orchard9/trellis/ingress/internal/partners"
+	"github.com/orchard9/trellis/ingress/internal/tracking"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/orchard9/trellis/ingress/internal/ingestion")
+
 // Handler manages traffic ingestion with organization awareness
 type Handler struct {
-	pubsub   *pubsub.Topic
-	redis    *redis.Client
-	routing  *RoutingEngine
-	metrics  *Metrics
+	pubsub    *pubsub.Topic
+	routing   *RoutingEngine
+	metrics   Metrics
+	tracker   *tracking.Tracker
+	sessions  *tracking.Sessionizer
+	ids       *tracking.IDGenerator
+	dedup     *Deduplicator
+	clicks    *ClickIndex
+	fraud     *FraudChain
+	bots      *BotDetector
+	ipintel   *ipintel.Intel
+	postbacks *PostbackStore
+	forwarder *Forwarder
+
+	// Events waiting on a publish result, reported as the publish queue depth
+	publishing atomic.Int64
 }
 
 // Event represents a traffic event with organization context
 type Event struct {
-	EventID        string            `json:"event_id"`
-	Timestamp      int64             `json:"timestamp"`
-	OrganizationID string            `json:"organization_id"`
-	ClickID        string            `json:"click_id"`
-	CampaignID     string            `json:"campaign_id,omitempty"`
-	RawRequest     RawRequest        `json:"raw_request"`
-	Enriched       EnrichedData      `json:"enriched,omitempty"`
-	FraudFlags     []string          `json:"fraud_flags,omitempty"`
-	FraudScore     float32           `json:"fraud_score,omitempty"`
+	EventID           string            `json:"event_id"`
+	Timestamp         int64             `json:"timestamp"`
+	OrganizationID    string            `json:"organization_id"`
+	EventType         string            `json:"event_type"`
+	ClickID           string            `json:"click_id"`            // canonical Trellis click ID
+	ClickIDs          map[string]string `json:"click_ids,omitempty"` // network click IDs by mapping name
+	UserID            string            `json:"user_id,omitempty"`
+	SessionID         string            `json:"session_id,omitempty"`
+	IsReturning       bool              `json:"is_returning,omitempty"`
+	SessionStartedAt  int64             `json:"session_started_at,omitempty"`
+	SessionEventIndex int               `json:"session_event_index,omitempty"`
+	LandingCampaignID string            `json:"landing_campaign_id,omitempty"`
+	CampaignID        string            `json:"campaign_id,omitempty"`
+	RawRequest        RawRequest        `json:"raw_request"`
+	Enriched          EnrichedData      `json:"enriched,omitempty"`
+	FraudFlags        []string          `json:"fraud_flags,omitempty"`
+	FraudScore        float32           `json:"fraud_score,omitempty"`
+	IsDuplicate       bool              `json:"is_duplicate,omitempty"`
+	Postback          *Postback         `json:"postback,omitempty"`
+	Routing           *RoutingDecision  `json:"routing,omitempty"` // clicks only
+	RetentionDays     int               `json:"retention_days,omitempty"`
 }
 
+// Event types
+const (
+	EventTypeClick    = "click"
+	EventTypePixel    = "pixel"
+	EventTypePostback = "postback"
+)
+
 // RawRequest contains the complete HTTP request information
 type RawRequest struct {
 	Method  string              `json:"method"`
@@ -46,31 +92,42 @@ type RawRequest struct {
 	Path    string              `json:"path"`
 	Headers map[string]string   `json:"headers"`
 	Body    json.RawMessage     `json:"body,omitempty"`
-	IP      string              `json:"ip"`
+	IP      netip.Addr          `json:"ip"`
 	Params  map[string][]string `json:"params"`
 }
 
 // EnrichedData contains processed information
 type EnrichedData struct {
-	Country         string  `json:"country,omitempty"`
-	City            string  `json:"city,omitempty"`
-	DeviceType      string  `json:"device_type,omitempty"`
-	OS              string  `json:"os,omitempty"`
-	Browser         string  `json:"browser,omitempty"`
-	IsBot           bool    `json:"is_bot,omitempty"`
-	Source          string  `json:"source,omitempty"`
-	Medium          string  `json:"medium,omitempty"`
-	Referrer        string  `json:"referrer,omitempty"`
-	ReferrerDomain  string  `json:"referrer_domain,omitempty"`
+	Country        string   `json:"country,omitempty"`
+	City           string   `json:"city,omitempty"`
+	DeviceType     string   `json:"device_type,omitempty"`
+	OS             string   `json:"os,omitempty"`
+	Browser        string   `json:"browser,omitempty"`
+	IsBot          bool     `json:"is_bot,omitempty"`
+	BotName        string   `json:"bot_name,omitempty"`
+	IPLists        []string `json:"ip_lists,omitempty"`
+	Source         string   `json:"source,omitempty"`
+	Medium         string   `json:"medium,omitempty"`
+	Referrer       string   `json:"referrer,omitempty"`
+	ReferrerDomain string   `json:"referrer_domain,omitempty"`
 }
 
 // NewHandler creates a new ingestion handler
-func NewHandler(pubsubTopic *pubsub.Topic, redisClient *redis.Client, routing *RoutingEngine, metrics *Metrics) *Handler {
+func NewHandler(pubsubTopic *pubsub.Topic, routing *RoutingEngine, metrics Metrics, tracker *tracking.Tracker, sessions *tracking.Sessionizer, ids *tracking.IDGenerator, dedup *Deduplicator, clicks *ClickIndex, fraud *FraudChain, bots *BotDetector, ipIntel *ipintel.Intel, postbacks *PostbackStore, forwarder *Forwarder) *Handler {
 	return &Handler{
-		pubsub:  pubsubTopic,
-		redis:   redisClient,
-		routing: routing,
-		metrics: metrics,
+		pubsub:    pubsubTopic,
+		routing:   routing,
+		metrics:   metrics,
+		tracker:   tracker,
+		sessions:  sessions,
+		ids:       ids,
+		dedup:     dedup,
+		clicks:    clicks,
+		fraud:     fraud,
+		bots:      bots,
+		ipintel:   ipIntel,
+		postbacks: postbacks,
+		forwarder: forwarder,
 	}
 }
 
@@ -86,69 +143,127 @@ func (h *Handler) HandleTraffic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create event with organization context
+	// Create event with organization context and a freshly minted click ID
 	event := &Event{
 		EventID:        uuid.New().String(),
 		Timestamp:      time.Now().UnixNano(),
 		OrganizationID: orgCtx.OrganizationID,
-		ClickID:        h.extractClickID(r),
+		EventType:      EventTypeClick,
+		ClickID:        h.ids.NextString(),
 		RawRequest: RawRequest{
 			Method:  r.Method,
 			URL:     r.URL.String(),
 			Path:    r.URL.Path,
 			Headers: h.flattenHeaders(r.Header),
-			Body:    h.readBody(r),
+			Body:    rawBody(h.readBody(r)),
 			IP:      h.getRealIP(r),
 			Params:  r.URL.Query(),
 		},
 	}
 
+	ctx = eventContext(ctx, event)
+
 	// Extract campaign ID from route (organization-scoped)
-	if campaignID := chi.URLParam(r, "campaign_id"); campaignID != "" {
-		event.CampaignID = fmt.Sprintf("%s/%s", orgCtx.OrganizationID, campaignID)
+	routeCampaignID := chi.URLParam(r, "campaign_id")
+	if routeCampaignID != "" {
+		event.CampaignID = fmt.Sprintf("%s/%s", orgCtx.OrganizationID, routeCampaignID)
 	}
 
-	// Async publish to Pub/Sub
-	go func(e *Event) {
-		publishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		data, err := json.Marshal(e)
-		if err != nil {
-			slog.Error("failed to marshal event", "error", err, "organization_id", e.OrganizationID)
-			return
-		}
-
-		result := h.pubsub.Publish(publishCtx, &pubsub.Message{
-			Data: data,
-			Attributes: map[string]string{
-				"event_id":        e.EventID,
-				"click_id":        e.ClickID,
-				"campaign_id":     e.CampaignID,
-				"organization_id": e.OrganizationID,
-			},
-		})
-
-		if _, err := result.Get(publishCtx); err != nil {
-			slog.Error("failed to publish event", 
-				"error", err, 
-				"event_id", e.EventID, 
-				"organization_id", e.OrganizationID)
-		}
-	}(event)
+	// Enrich once and classify known bots before anything stateful happens
+	bot, settings, providedClickID := h.classifyClick(ctx, event)
 
-	// Organization-scoped deduplication check
-	if h.isDuplicate(ctx, event.OrganizationID, event.ClickID) {
-		event.FraudFlags = append(event.FraudFlags, "duplicate_click")
+	// Known bots (link previews, crawlers) get a plain redirect without a
+	// visitor cookie, session, dedup or click index; they are stored flagged
+	if bot.IsBot {
+		match := h.routing.Route(ctx, event.OrganizationID, routeCampaignID, event.RawRequest.Params, NewAttributes(event))
+		stampRouting(event, match, match.Destination)
+		go h.publishEvent(ctx, event)
+		h.redirect(w, r, match.Destination)
+		return
 	}
 
-	// Get destination from organization-aware routing
-	destination := h.routing.GetDestination(event.OrganizationID, event.CampaignID, event.RawRequest.Params)
+	// Recognize returning visitors via the first-party cookie
+	h.identifyVisitor(w, r, event)
+
+	// Build the attribute namespace shared by routing and fraud checks
+	attrs := NewAttributes(event)
+
+	// Get destination from organization-aware routing, carrying the click ID
+	// so the advertiser can send it back in postbacks
+	match := h.routing.Route(ctx, event.OrganizationID, routeCampaignID, event.RawRequest.Params, attrs)
+	destination := clickDestination(match.Destination, settings, event.ClickID)
+	stampRouting(event, match, destination)
+
+	// Deduplicate and score before publishing so both outcomes are stored
+	h.checkDuplicate(ctx, event, settings, match.Campaign, providedClickID)
+	verdict := h.scoreFraud(ctx, event, attrs, settings, time.Time{}, bot)
+
+	// Assign the click to the visitor's session
+	h.sessionize(ctx, event)
+
+	// Async publish to Pub/Sub
+	go h.publishEvent(ctx, event)
+
+	// Remember the click so conversions can be checked against it
+	go h.recordClick(ctx, event, match.Campaign, providedClickID)
 
 	// Record metrics with organization context
 	h.metrics.RecordRedirect(time.Since(start), event.OrganizationID, event.CampaignID)
 
+	// Apply the organization's fraud policy; the event is stored either way
+	switch verdict.Action {
+	case FraudActionBlock:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	case FraudActionSafePage:
+		destination = settings.SafePageURL
+	}
+
 	// Perform redirect
+	h.redirect(w, r, destination)
+}
+
+// classifyClick enriches a click, classifies known bots and collects the
+// ad networks' own click IDs. It returns the bot verdict, the organization's
+// settings and the provided click ID. The explain API shares it so debug
+// routing sees the same attributes as live traffic.
+func (h *Handler) classifyClick(ctx context.Context, event *Event) (BotResult, *OrganizationSettings, string) {
+	event.Enriched = enrichRequest(event.RawRequest)
+	event.Enriched.IPLists = h.ipintel.Lookup(event.OrganizationID, event.RawRequest.IP)
+	bot := h.detectBot(ctx, event)
+
+	settings := h.routing.OrganizationSettings(event.OrganizationID)
+	var providedClickID string
+	event.ClickIDs, providedClickID = extractClickIDs(settings.ClickIDMappings, event.Enriched.Source, event.RawRequest.Params)
+
+	return bot, settings, providedClickID
+}
+
+// stampRouting records the routing decision on a click. The matched
+// campaign replaces the one from the URL path, which is kept when nothing
+// matched so clicks can be attributed to campaigns created later.
+func stampRouting(event *Event, match *MatchResult, destination string) {
+	event.Routing = match.Decision(destination)
+	if match.Campaign != nil {
+		event.CampaignID = fmt.Sprintf("%s/%s", event.OrganizationID, match.Campaign.CampaignID)
+	}
+}
+
+// clickDestination adds the click ID to a routed destination
+func clickDestination(destination string, settings *OrganizationSettings, clickID string) string {
+	if destination == "" {
+		return ""
+	}
+	return appendClickID(destination, settings.ClickIDParam, clickID)
+}
+
+// redirect sends the visitor to the destination; clicks that matched no
+// campaign in an organization without a default destination get a 404
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, destination string) {
+	if destination == "" {
+		http.Error(w, "No destination configured", http.StatusNotFound)
+		return
+	}
 	http.Redirect(w, r, destination, http.StatusFound)
 }
 
@@ -168,6 +283,7 @@ func (h *Handler) HandlePixel(w http.ResponseWriter, r *http.Request) {
 		EventID:        uuid.New().String(),
 		Timestamp:      time.Now().UnixNano(),
 		OrganizationID: orgCtx.OrganizationID,
+		EventType:      EventTypePixel,
 		ClickID:        h.extractClickID(r),
 		RawRequest: RawRequest{
 			Method:  "GET",
@@ -178,15 +294,23 @@ func (h *Handler) HandlePixel(w http.ResponseWriter, r *http.Request) {
 			Params:  r.URL.Query(),
 		},
 	}
+	ctx := eventContext(r.Context(), event)
+	event.Enriched = enrichRequest(event.RawRequest)
+	event.Enriched.IPLists = h.ipintel.Lookup(event.OrganizationID, event.RawRequest.IP)
+	if bot := h.detectBot(ctx, event); !bot.IsBot {
+		h.identifyVisitor(w, r, event)
+		h.sessionize(ctx, event)
+	}
 
 	// Async publish
-	go h.publishEvent(event)
+	go h.publishEvent(ctx, event)
 
 	// Serve 1x1 transparent gif
 	h.servePixel(w)
 }
 
-// HandlePostback processes postback/conversion tracking
+// HandlePostback processes postback/conversion tracking. The click must be
+// known for the organization, and transaction IDs are only recorded once.
 func (h *Handler) HandlePostback(w http.ResponseWriter, r *http.Request) {
 	orgCtx, ok := auth.GetOrganizationContext(r.Context())
 	if !ok {
@@ -194,10 +318,11 @@ func (h *Handler) HandlePostback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract postback parameters
-	clickID := r.URL.Query().Get("click_id")
-	if clickID == "" {
-		http.Error(w, "Missing click_id parameter", http.StatusBadRequest)
+	// Parse postback fields from the query string and body
+	body := h.readBody(r)
+	postback, err := parsePostback(r.URL.Query(), r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid postback: %v", err), http.StatusBadRequest)
 		return
 	}
 
@@ -206,82 +331,266 @@ func (h *Handler) HandlePostback(w http.ResponseWriter, r *http.Request) {
 		EventID:        uuid.New().String(),
 		Timestamp:      time.Now().UnixNano(),
 		OrganizationID: orgCtx.OrganizationID,
-		ClickID:        clickID,
+		EventType:      EventTypePostback,
+		ClickID:        postback.ClickID,
 		RawRequest: RawRequest{
 			Method:  r.Method,
 			URL:     r.URL.String(),
 			Path:    r.URL.Path,
 			Headers: h.flattenHeaders(r.Header),
-			Body:    h.readBody(r),
+			Body:    rawBody(body),
 			IP:      h.getRealIP(r),
 			Params:  r.URL.Query(),
 		},
 	}
 
+	event.Enriched.IPLists = h.ipintel.Lookup(event.OrganizationID, event.RawRequest.IP)
+
+	// Record which partner sent the postback
+	ctx := eventContext(r.Context(), event)
+	if partner, ok := partners.FromContext(ctx); ok {
+		postback.PartnerID = partner.PartnerID
+	}
+
+	// Validate the click and attribute the conversion to its campaign
+	click, found, err := h.clicks.Lookup(ctx, event.OrganizationID, postback.ClickID)
+	switch {
+	case errors.Is(err, ErrNoIndex):
+		// Without Redis clicks can't be validated; accept unvalidated
+	case err != nil:
+		// Accept unvalidated rather than lose the conversion
+		slog.WarnContext(ctx, "click lookup failed", "error", err)
+	case !found:
+		http.Error(w, "Unknown click_id", http.StatusNotFound)
+		return
+	case click.CampaignID != "":
+		postback.CampaignID = click.CampaignID
+		event.CampaignID = fmt.Sprintf("%s/%s", event.OrganizationID, click.CampaignID)
+	}
+
+	// Partners retry; an already recorded transaction is acknowledged, not stored again
+	postback.OrganizationID = event.OrganizationID
+	first, err := h.postbacks.ClaimTransaction(ctx, postback)
+	if err != nil {
+		slog.WarnContext(ctx, "transaction dedup failed", "error", err)
+		first = true
+	}
+	if !first {
+		h.metrics.RecordDuplicate(event.OrganizationID)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Duplicate"))
+		return
+	}
+
+	// Check conversion timing against the originating click
+	settings := h.routing.OrganizationSettings(event.OrganizationID)
+	verdict := h.scoreFraud(ctx, event, NewAttributes(event), settings, click.Time, BotResult{})
+
+	postback.PostbackID = uuid.New().String()
+	postback.ReceivedAt = time.Unix(0, event.Timestamp).UTC()
+	postback.EventID = event.EventID
+	postback.FraudScore = verdict.Score
+	postback.FraudFlags = verdict.Flags
+	event.Postback = postback
+
+	// Store synchronously so the partner retries if the write fails
+	if err := h.postbacks.Insert(ctx, postback); err != nil {
+		slog.ErrorContext(ctx, "failed to store postback", "error", err)
+		h.postbacks.ReleaseTransaction(ctx, postback)
+		http.Error(w, "Failed to record postback", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Notify the traffic source through the campaign's outbound postbacks
+	if postback.CampaignID != "" {
+		go h.forwardPostback(postback, click)
+	}
+
 	// Async publish
-	go h.publishEvent(event)
+	go h.publishEvent(ctx, event)
 
 	// Return success
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
-// isDuplicate checks for duplicate clicks within organization scope
-func (h *Handler) isDuplicate(ctx context.Context, organizationID, clickID string) bool {
-	if clickID == "" {
-		return false
-	}
-
-	// Organization-scoped Redis key
-	key := fmt.Sprintf("click:%s:%s", organizationID, clickID)
+// identifyVisitor stamps the visitor ID on the event and refreshes the cookie
+func (h *Handler) identifyVisitor(w http.ResponseWriter, r *http.Request, event *Event) {
+	visitor := h.tracker.Identify(r, event.OrganizationID)
+	event.UserID = visitor.ID
+	event.IsReturning = visitor.IsReturning
+	h.tracker.SetCookie(w, event.OrganizationID, visitor)
+}
 
-	// Use short context for Redis operation
-	redisCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+// sessionize stamps session information on the event. Failures only cost
+// the session fields; the event is still captured.
+func (h *Handler) sessionize(ctx context.Context, event *Event) {
+	sessionCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
 	defer cancel()
 
-	// SetNX returns true if key was set (not duplicate)
-	ok, err := h.redis.SetNX(redisCtx, key, 1, 5*time.Second).Result()
+	session, err := h.sessions.Track(sessionCtx, event.OrganizationID, event.UserID, event.CampaignID, time.Unix(0, event.Timestamp))
 	if err != nil {
-		// Log error but don't block redirect
-		slog.Warn("redis dedup check failed", "error", err, "organization_id", organizationID)
-		return false
+		slog.WarnContext(ctx, "session tracking failed", "error", err)
+		return
+	}
+
+	event.SessionID = session.ID
+	event.SessionStartedAt = session.StartedAt.UnixNano()
+	event.SessionEventIndex = session.EventIndex
+	event.LandingCampaignID = session.LandingCampaignID
+}
+
+// checkDuplicate applies the campaign or organization dedup policy and
+// records the outcome on the event
+func (h *Handler) checkDuplicate(ctx context.Context, event *Event, settings *OrganizationSettings, campaign *Campaign, providedClickID string) {
+	policy := dedupPolicy(settings, campaign)
+
+	// Campaigns with their own window deduplicate within the campaign only
+	scope := "org"
+	if campaign != nil && (campaign.DedupWindowSeconds > 0 || campaign.DedupKey != "") {
+		scope = campaign.CampaignID
+	}
+
+	identity := dedupIdentity(policy, event, providedClickID)
+	if h.dedup.IsDuplicate(ctx, event.OrganizationID, scope, identity, policy.Window) {
+		event.IsDuplicate = true
+		h.metrics.RecordDuplicate(event.OrganizationID)
+	}
+}
+
+// detectBot classifies known bots and marks them on the event
+func (h *Handler) detectBot(ctx context.Context, event *Event) BotResult {
+	bot := h.bots.Detect(ctx, event.RawRequest.Headers["user-agent"], ipString(event.RawRequest.IP))
+	if bot.IsBot {
+		event.Enriched.IsBot = true
+		event.Enriched.BotName = bot.Name
+	}
+	return bot
+}
+
+// scoreFraud runs the fraud chain and records its score and flags on the event
+func (h *Handler) scoreFraud(ctx context.Context, event *Event, attrs Attributes, settings *OrganizationSettings, clickTime time.Time, bot BotResult) FraudVerdict {
+	verdict := h.fraud.Evaluate(ctx, &FraudInput{
+		Event:     event,
+		Attrs:     attrs,
+		Settings:  settings,
+		ClickTime: clickTime,
+		Bot:       bot,
+	})
+
+	event.FraudScore = verdict.Score
+	event.FraudFlags = append(event.FraudFlags, verdict.Flags...)
+	for _, flag := range verdict.Flags {
+		h.metrics.RecordFraud(event.OrganizationID, flag)
+	}
+
+	return verdict
+}
+
+// recordClick stores the click time and campaign for conversion checks and
+// attribution, with the parameters its outbound postbacks need. The click is
+// indexed under the canonical click ID and, for partners that send back
+// their own, under the provided click ID.
+func (h *Handler) recordClick(ctx context.Context, event *Event, campaign *Campaign, providedClickID string) {
+	ctx = context.WithoutCancel(ctx)
+	campaignID := ""
+	var params url.Values
+	if campaign != nil {
+		campaignID = campaign.CampaignID
+		params = campaign.forwardedParams(event.RawRequest.Params)
+	}
+	at := time.Unix(0, event.Timestamp)
+	for _, clickID := range []string{event.ClickID, providedClickID} {
+		if clickID == "" {
+			continue
+		}
+		if err := h.clicks.Record(ctx, event.OrganizationID, clickID, at, campaignID, params); err != nil {
+			slog.WarnContext(ctx, "failed to record click", "error", err)
+		}
+	}
+}
+
+// forwardPostback queues the outbound postbacks of the conversion's campaign
+func (h *Handler) forwardPostback(postback *Postback, click ClickRecord) {
+	campaign := h.routing.GetCampaign(postback.OrganizationID, postback.CampaignID)
+	if campaign == nil || len(campaign.OutboundPostbacks) == 0 {
+		return
 	}
+	h.forwarder.Enqueue(context.Background(), campaign, postback, click)
+}
 
-	return !ok // Return true if key already existed (duplicate)
+// eventContext adds the event's identifiers to the context's log records
+func eventContext(ctx context.Context, event *Event) context.Context {
+	return logging.With(ctx, "organization_id", event.OrganizationID, "event_id", event.EventID)
 }
 
-// publishEvent publishes event to Pub/Sub
-func (h *Handler) publishEvent(event *Event) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// publishEvent publishes event to Pub/Sub. It outlives the request, so
+// only the request's trace is carried over from ctx, and the trace context
+// is injected into the message attributes for the worker to continue.
+// The organization's retention and PII policy apply to the published copy.
+func (h *Handler) publishEvent(ctx context.Context, event *Event) {
+	event = storedEvent(event, h.routing.OrganizationSettings(event.OrganizationID))
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
 	defer cancel()
 
+	ctx, span := tracer.Start(ctx, "pubsub.Publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "gcp_pubsub"),
+			attribute.String("event_id", event.EventID),
+			attribute.String("organization_id", event.OrganizationID),
+		))
+	defer span.End()
+
 	data, err := json.Marshal(event)
 	if err != nil {
-		slog.Error("failed to marshal event", "error", err, "organization_id", event.OrganizationID)
+		slog.ErrorContext(ctx, "failed to marshal event", "error", err)
 		return
 	}
 
+	h.metrics.SetQueueDepth(QueuePublish, int(h.publishing.Add(1)))
+	defer func() {
+		h.metrics.SetQueueDepth(QueuePublish, int(h.publishing.Add(-1)))
+	}()
+
+	attributes := map[string]string{
+		"event_id":        event.EventID,
+		"click_id":        event.ClickID,
+		"campaign_id":     event.CampaignID,
+		"organization_id": event.OrganizationID,
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(attributes))
+
 	result := h.pubsub.Publish(ctx, &pubsub.Message{
-		Data: data,
-		Attributes: map[string]string{
-			"event_id":        event.EventID,
-			"click_id":        event.ClickID,
-			"organization_id": event.OrganizationID,
-		},
+		Data:       data,
+		Attributes: attributes,
 	})
 
 	if _, err := result.Get(ctx); err != nil {
-		slog.Error("failed to publish event", 
-			"error", err, 
-			"event_id", event.EventID,
-			"organization_id", event.OrganizationID)
+		slog.ErrorContext(ctx, "failed to publish event", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		h.metrics.RecordPublishFailure(event.OrganizationID)
+		return
 	}
+	h.metrics.RecordEvent(event.OrganizationID)
 }
 
 // extractClickID extracts click ID from various parameter names
 func (h *Handler) extractClickID(r *http.Request) string {
-	// Try common parameter names
-	params := []string{"click_id", "clickid", "cid", "transaction_id", "tid"}
+	if id := h.requestClickID(r); id != "" {
+		return id
+	}
+
+	// Mint one if not found
+	return h.ids.NextString()
+}
+
+// requestClickID returns the click ID supplied on the request, if any
+func (h *Handler) requestClickID(r *http.Request) string {
+	// The canonical click ID comes first, then common parameter names
+	params := []string{TrellisClickIDParam, "click_id", "clickid", "cid", "transaction_id", "tid"}
 
 	for _, param := range params {
 		if id := r.URL.Query().Get(param); id != "" {
@@ -289,32 +598,17 @@ func (h *Handler) extractClickID(r *http.Request) string {
 		}
 	}
 
-	// Generate one if not found
-	return uuid.New().String()
+	return ""
 }
 
-// getRealIP extracts the real IP address from headers
-func (h *Handler) getRealIP(r *http.Request) string {
-	// Check X-Forwarded-For header
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Return first IP in the chain
-		if idx := strings.Index(xff, ","); idx != -1 {
-			return strings.TrimSpace(xff[:idx])
-		}
-		return xff
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// Fall back to RemoteAddr
-	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx != -1 {
-		return r.RemoteAddr[:idx]
+// getRealIP returns the client IP resolved by the trusted proxy middleware,
+// falling back to the connection's peer address
+func (h *Handler) getRealIP(r *http.Request) netip.Addr {
+	if addr, ok := clientip.FromContext(r.Context()); ok {
+		return addr
 	}
-
-	return r.RemoteAddr
+	addr, _ := clientip.ParseHost(r.RemoteAddr)
+	return addr
 }
 
 // flattenHeaders converts http.Header to map[string]string
@@ -329,7 +623,7 @@ func (h *Handler) flattenHeaders(headers http.Header) map[string]string {
 }
 
 // readBody reads and returns request body
-func (h *Handler) readBody(r *http.Request) json.RawMessage {
+func (h *Handler) readBody(r *http.Request) []byte {
 	if r.Body == nil {
 		return nil
 	}
@@ -343,6 +637,19 @@ func (h *Handler) readBody(r *http.Request) json.RawMessage {
 	// Reset body for potential future reads
 	r.Body = io.NopCloser(strings.NewReader(string(body)))
 
+	return body
+}
+
+// rawBody is a request body as stored on events: JSON as is, anything else,
+// such as a form-encoded postback, as a JSON string
+func rawBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if !json.Valid(body) {
+		quoted, _ := json.Marshal(string(body))
+		return quoted
+	}
 	return json.RawMessage(body)
 }
 
@@ -0,0 +1,58 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPostbackBodyPublishes(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        string // the body as it decodes from the published event
+	}{
+		{"json", "/postback", "application/json", `{"click_id":"1","status":"approved"}`, `{"click_id":"1","status":"approved"}`},
+		{"form", "/postback", "application/x-www-form-urlencoded", "click_id=1&status=approved", `"click_id=1&status=approved"`},
+		{"text", "/postback?click_id=1", "text/plain", "converted", `"converted"`},
+	}
+
+	h := &Handler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			body := h.readBody(r)
+			postback, err := parsePostback(r.URL.Query(), tt.contentType, body)
+			if err != nil {
+				t.Fatalf("parsePostback() error = %v", err)
+			}
+			if postback.ClickID != "1" {
+				t.Errorf("parsePostback() click_id = %q, want 1", postback.ClickID)
+			}
+
+			event := &Event{EventType: EventTypePostback, RawRequest: RawRequest{Body: rawBody(body)}}
+			data, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var decoded Event
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(decoded.RawRequest.Body, &got); err != nil {
+				t.Fatalf("published body %s does not decode: %v", decoded.RawRequest.Body, err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("published body = %v, want %v", got, want)
+			}
+		})
+	}
+}
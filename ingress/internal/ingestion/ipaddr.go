@@ -0,0 +1,21 @@
+package ingestion
+
+import (
+	"net/netip"
+)
+
+// ipString formats addr, returning "" for the zero Addr
+func ipString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+// ipVersion returns "4" or "6" for routing rules on the address family
+func ipVersion(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return "4"
+	}
+	return "6"
+}
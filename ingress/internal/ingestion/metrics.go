@@ -11,8 +11,16 @@ type Metrics interface {
 	RecordEvent(organizationID string)
 	RecordDuplicate(organizationID string)
 	RecordFraud(organizationID, fraudType string)
+	RecordPublishFailure(organizationID string)
+	SetQueueDepth(queue string, depth int)
 }
 
+// Queues reported through SetQueueDepth
+const (
+	QueuePublish            = "publish"             // events waiting on a Pub/Sub publish result
+	QueuePostbackDeliveries = "postback_deliveries" // outbound postbacks pending delivery
+)
+
 // SimpleMetrics provides basic logging-based metrics
 type SimpleMetrics struct{}
 
@@ -50,4 +58,18 @@ func (m *SimpleMetrics) RecordFraud(organizationID, fraudType string) {
 		"organization_id", organizationID,
 		"fraud_type", fraudType,
 	)
-}
\ No newline at end of file
+}
+// RecordPublishFailure logs a failed event publish
+func (m *SimpleMetrics) RecordPublishFailure(organizationID string) {
+	slog.Debug("event publish failed",
+		"organization_id", organizationID,
+	)
+}
+
+// SetQueueDepth logs a queue depth
+func (m *SimpleMetrics) SetQueueDepth(queue string, depth int) {
+	slog.Debug("queue depth",
+		"queue", queue,
+		"depth", depth,
+	)
+}
@@ -0,0 +1,172 @@
+package ingestion
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OutboundPostback is a campaign's template for notifying the traffic source
+// of a conversion. URL, body and header values may use the macros
+// {click_id}, {transaction_id}, {status}, {value}, {currency},
+// {campaign_id}, {postback_id}, {event_id}, {timestamp}, {click_timestamp}
+// and {param.NAME} for the original click's query parameters.
+type OutboundPostback struct {
+	Name        string            `json:"name,omitempty"`
+	URL         string            `json:"url"`
+	Method      string            `json:"method,omitempty"`       // GET (default) or POST
+	ContentType string            `json:"content_type,omitempty"` // body content type for POST
+	Body        string            `json:"body,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Statuses    []string          `json:"statuses,omitempty"` // postback statuses that trigger it; approved if empty
+}
+
+// outboundMacros are the macros available besides {param.NAME}
+var outboundMacros = map[string]bool{
+	"click_id":        true,
+	"transaction_id":  true,
+	"status":          true,
+	"value":           true,
+	"currency":        true,
+	"campaign_id":     true,
+	"postback_id":     true,
+	"event_id":        true,
+	"timestamp":       true,
+	"click_timestamp": true,
+}
+
+// Validate checks an outbound postback template
+func (o *OutboundPostback) Validate() error {
+	switch strings.ToUpper(o.Method) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return fmt.Errorf("unsupported method %q", o.Method)
+	}
+
+	// The URL must be valid once macros are filled in
+	sample := expandMacros(o.URL, func(name string) (string, bool) { return "x", true }, escapeQuery)
+	parsed, err := url.Parse(sample)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid outbound postback URL %q", o.URL)
+	}
+
+	if o.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(o.ContentType); err != nil {
+			return fmt.Errorf("invalid content type %q", o.ContentType)
+		}
+	}
+
+	for _, tmpl := range o.templates() {
+		for _, name := range templateMacros(tmpl) {
+			if !outboundMacros[name] && !strings.HasPrefix(name, macroParamPrefix) {
+				return fmt.Errorf("unknown macro {%s}", name)
+			}
+		}
+	}
+
+	for _, status := range o.Statuses {
+		switch status {
+		case PostbackStatusApproved, PostbackStatusPending, PostbackStatusRejected:
+		default:
+			return fmt.Errorf("invalid status %q", status)
+		}
+	}
+	return nil
+}
+
+// triggersOn reports whether a postback status triggers the template
+func (o *OutboundPostback) triggersOn(status string) bool {
+	if len(o.Statuses) == 0 {
+		return status == PostbackStatusApproved
+	}
+	for _, s := range o.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// templates returns every templated string of the postback
+func (o *OutboundPostback) templates() []string {
+	templates := []string{o.URL, o.Body}
+	for _, value := range o.Headers {
+		templates = append(templates, value)
+	}
+	return templates
+}
+
+// bodyEscape returns the escaping for values substituted into the body
+func (o *OutboundPostback) bodyEscape() func(string) string {
+	mediaType, _, _ := mime.ParseMediaType(o.ContentType)
+	switch mediaType {
+	case "application/json":
+		return escapeJSON
+	case "application/x-www-form-urlencoded":
+		return escapeQuery
+	default:
+		return escapeNone
+	}
+}
+
+// forwardedParams returns the click parameters a campaign's outbound
+// postbacks reference, so only those are kept with the click
+func (c *Campaign) forwardedParams(params url.Values) url.Values {
+	var kept url.Values
+	for i := range c.OutboundPostbacks {
+		for _, tmpl := range c.OutboundPostbacks[i].templates() {
+			for _, name := range templateMacros(tmpl) {
+				param, ok := strings.CutPrefix(name, macroParamPrefix)
+				if !ok || !params.Has(param) {
+					continue
+				}
+				if kept == nil {
+					kept = make(url.Values)
+				}
+				kept.Set(param, params.Get(param))
+			}
+		}
+	}
+	return kept
+}
+
+// outboundValue returns a macro's value for a postback and its click
+func outboundValue(pb *Postback, click ClickRecord) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if param, ok := strings.CutPrefix(name, macroParamPrefix); ok {
+			return click.Params.Get(param), true
+		}
+		switch name {
+		case "click_id":
+			return pb.ClickID, true
+		case "transaction_id":
+			return pb.TransactionID, true
+		case "status":
+			return pb.Status, true
+		case "value":
+			if pb.Value == nil {
+				return "", true
+			}
+			return strconv.FormatFloat(*pb.Value, 'f', -1, 64), true
+		case "currency":
+			return pb.Currency, true
+		case "campaign_id":
+			return pb.CampaignID, true
+		case "postback_id":
+			return pb.PostbackID, true
+		case "event_id":
+			return pb.EventID, true
+		case "timestamp":
+			return strconv.FormatInt(pb.ReceivedAt.Unix(), 10), true
+		case "click_timestamp":
+			if click.Time.IsZero() {
+				return "", true
+			}
+			return strconv.FormatInt(click.Time.Unix(), 10), true
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,281 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Postback statuses
+const (
+	PostbackStatusApproved = "approved"
+	PostbackStatusPending  = "pending"
+	PostbackStatusRejected = "rejected"
+)
+
+// postbackAliases maps accepted parameter names to postback fields, in order of preference
+var postbackAliases = map[string][]string{
+	"click_id":       {"click_id", "clickid", "cid", "trellis_click_id"},
+	"transaction_id": {"transaction_id", "txid", "tid", "order_id"},
+	"status":         {"status", "conversion_status"},
+	"value":          {"value", "payout", "amount", "revenue"},
+	"currency":       {"currency", "cur"},
+}
+
+// postbackStatuses normalizes status values sent by partners
+var postbackStatuses = map[string]string{
+	"":           PostbackStatusApproved,
+	"approved":   PostbackStatusApproved,
+	"approve":    PostbackStatusApproved,
+	"confirmed":  PostbackStatusApproved,
+	"success":    PostbackStatusApproved,
+	"1":          PostbackStatusApproved,
+	"pending":    PostbackStatusPending,
+	"hold":       PostbackStatusPending,
+	"2":          PostbackStatusPending,
+	"rejected":   PostbackStatusRejected,
+	"declined":   PostbackStatusRejected,
+	"reversed":   PostbackStatusRejected,
+	"chargeback": PostbackStatusRejected,
+	"3":          PostbackStatusRejected,
+}
+
+// Postback is a parsed conversion postback
+type Postback struct {
+	PostbackID     string            `json:"postback_id"`
+	ReceivedAt     time.Time         `json:"received_at"`
+	OrganizationID string            `json:"organization_id"`
+	EventID        string            `json:"event_id"`
+	PartnerID      string            `json:"partner_id,omitempty"` // sending partner, empty for API key postbacks
+	ClickID        string            `json:"click_id"`
+	TransactionID  string            `json:"transaction_id,omitempty"`
+	CampaignID     string            `json:"campaign_id,omitempty"` // attributed from the click
+	Status         string            `json:"status"`
+	Value          *float64          `json:"value,omitempty"`
+	Currency       string            `json:"currency,omitempty"`
+	CustomData     map[string]string `json:"custom_data,omitempty"`
+	FraudScore     float32           `json:"fraud_score,omitempty"`
+	FraudFlags     []string          `json:"fraud_flags,omitempty"`
+}
+
+// parsePostback reads postback fields from the query string and a JSON or
+// form encoded body; body values win over query values. Unrecognized
+// fields are kept as custom data.
+func parsePostback(params url.Values, contentType string, body []byte) (*Postback, error) {
+	fields := make(map[string]string)
+	for key, values := range params {
+		if len(values) > 0 {
+			fields[strings.ToLower(key)] = values[0]
+		}
+	}
+
+	if len(body) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "application/json":
+			var values map[string]interface{}
+			if err := json.Unmarshal(body, &values); err != nil {
+				return nil, fmt.Errorf("invalid JSON body: %w", err)
+			}
+			for key, value := range values {
+				fields[strings.ToLower(key)] = jsonFieldString(value)
+			}
+		case "application/x-www-form-urlencoded":
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				return nil, fmt.Errorf("invalid form body: %w", err)
+			}
+			for key, v := range values {
+				if len(v) > 0 {
+					fields[strings.ToLower(key)] = v[0]
+				}
+			}
+		}
+	}
+
+	pb := &Postback{
+		ClickID:       takeField(fields, "click_id"),
+		TransactionID: takeField(fields, "transaction_id"),
+	}
+	if pb.ClickID == "" {
+		return nil, errors.New("missing click_id")
+	}
+
+	status, ok := postbackStatuses[strings.ToLower(takeField(fields, "status"))]
+	if !ok {
+		return nil, errors.New("invalid status")
+	}
+	pb.Status = status
+
+	if raw := takeField(fields, "value"); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid value %q", raw)
+		}
+		pb.Value = &value
+	}
+
+	if currency := strings.ToUpper(takeField(fields, "currency")); currency != "" {
+		if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return nil, fmt.Errorf("invalid currency %q", currency)
+		}
+		pb.Currency = currency
+	}
+
+	if len(fields) > 0 {
+		pb.CustomData = fields
+	}
+	return pb, nil
+}
+
+// takeField removes and returns the first present alias of a postback field
+func takeField(fields map[string]string, name string) string {
+	var value string
+	for _, alias := range postbackAliases[name] {
+		if v, ok := fields[alias]; ok {
+			if value == "" {
+				value = strings.TrimSpace(v)
+			}
+			delete(fields, alias)
+		}
+	}
+	return value
+}
+
+// jsonFieldString renders a decoded JSON value as a flat string
+func jsonFieldString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// PostbackStore deduplicates postbacks by transaction ID and writes them to
+// ClickHouse. Without Redis every delivery is treated as the first; without
+// ClickHouse postbacks are not stored.
+type PostbackStore struct {
+	redis      *redis.Client
+	clickhouse clickhouse.Conn
+	dedupTTL   time.Duration
+	timeout    time.Duration
+}
+
+// NewPostbackStore creates a postback store remembering transaction IDs for dedupTTL
+func NewPostbackStore(redisClient *redis.Client, ch clickhouse.Conn, dedupTTL, timeout time.Duration) *PostbackStore {
+	return &PostbackStore{
+		redis:      redisClient,
+		clickhouse: ch,
+		dedupTTL:   dedupTTL,
+		timeout:    timeout,
+	}
+}
+
+// ClaimTransaction reports whether a postback's transaction is seen for the
+// first time with its status, so a later reversal of the same transaction
+// is still recorded. Postbacks without a transaction ID are never duplicates.
+func (s *PostbackStore) ClaimTransaction(ctx context.Context, pb *Postback) (bool, error) {
+	if pb.TransactionID == "" || s.redis == nil {
+		return true, nil
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	key := transactionKey(pb)
+	claimed, err := s.redis.SetNX(redisCtx, key, time.Now().UnixMilli(), s.dedupTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim transaction: %w", err)
+	}
+	return claimed, nil
+}
+
+// ReleaseTransaction forgets a claimed transaction so a retry can succeed
+func (s *PostbackStore) ReleaseTransaction(ctx context.Context, pb *Postback) {
+	if pb.TransactionID == "" || s.redis == nil {
+		return
+	}
+
+	redisCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	s.redis.Del(redisCtx, transactionKey(pb))
+}
+
+// transactionKey is the Redis key claiming a transaction and status
+func transactionKey(pb *Postback) string {
+	return fmt.Sprintf("postback:txn:%s:%s:%s", pb.OrganizationID, pb.TransactionID, pb.Status)
+}
+
+// Insert writes a postback row
+func (s *PostbackStore) Insert(ctx context.Context, pb *Postback) error {
+	if s.clickhouse == nil {
+		slog.WarnContext(ctx, "clickhouse is not configured, postback not stored", "postback_id", pb.PostbackID)
+		return nil
+	}
+
+	var customData *string
+	if len(pb.CustomData) > 0 {
+		data, err := json.Marshal(pb.CustomData)
+		if err != nil {
+			return fmt.Errorf("failed to marshal custom data: %w", err)
+		}
+		encoded := string(data)
+		customData = &encoded
+	}
+
+	var transactionID, currency *string
+	if pb.TransactionID != "" {
+		transactionID = &pb.TransactionID
+	}
+	if pb.Currency != "" {
+		currency = &pb.Currency
+	}
+
+	query := `
+		INSERT INTO postbacks (
+			postback_id, received_at, organization_id, event_id, partner_id,
+			click_id, transaction_id, campaign_id, status, value, currency,
+			custom_data, fraud_score, fraud_flags
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	err := s.clickhouse.Exec(ctx, query,
+		pb.PostbackID,
+		pb.ReceivedAt,
+		pb.OrganizationID,
+		pb.EventID,
+		pb.PartnerID,
+		pb.ClickID,
+		transactionID,
+		pb.CampaignID,
+		pb.Status,
+		pb.Value,
+		currency,
+		customData,
+		pb.FraudScore,
+		pb.FraudFlags,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert postback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClickIndexWithoutRedis(t *testing.T) {
+	index := NewClickIndex(nil, time.Hour, time.Second)
+
+	if err := index.Record(context.Background(), "org", "click", time.Now(), "camp", nil); err != nil {
+		t.Errorf("Record() error = %v, want nil", err)
+	}
+	if _, found, err := index.Lookup(context.Background(), "org", "click"); found || !errors.Is(err, ErrNoIndex) {
+		t.Errorf("Lookup() = %t, %v, want false, ErrNoIndex", found, err)
+	}
+}
+
+func TestPostbackStoreWithoutBackends(t *testing.T) {
+	store := NewPostbackStore(nil, nil, time.Hour, time.Second)
+	pb := &Postback{PostbackID: "pb", OrganizationID: "org", ClickID: "click", TransactionID: "tx", Status: PostbackStatusApproved}
+
+	for i := 0; i < 2; i++ {
+		first, err := store.ClaimTransaction(context.Background(), pb)
+		if err != nil || !first {
+			t.Errorf("ClaimTransaction() = %t, %v, want true, nil", first, err)
+		}
+	}
+	store.ReleaseTransaction(context.Background(), pb)
+	if err := store.Insert(context.Background(), pb); err != nil {
+		t.Errorf("Insert() error = %v, want nil", err)
+	}
+}
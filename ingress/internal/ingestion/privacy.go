@@ -0,0 +1,74 @@
+package ingestion
+
+import (
+	"net/netip"
+	"net/url"
+)
+
+// redactedValue replaces the values of redacted parameters
+const redactedValue = "[redacted]"
+
+// storedEvent returns the copy of an event that leaves the ingress, with the
+// organization's retention stamped and its PII policy applied. The original
+// is left untouched since request handling still reads it concurrently.
+func storedEvent(event *Event, settings *OrganizationSettings) *Event {
+	stored := *event
+	stored.RetentionDays = settings.RetentionDays
+	stored.RawRequest.IP = applyIPPolicy(event.RawRequest.IP, settings.PIIPolicy)
+
+	if len(settings.RedactParams) == 0 {
+		return &stored
+	}
+
+	params := make(map[string][]string, len(event.RawRequest.Params))
+	redacted := false
+	for name, values := range event.RawRequest.Params {
+		if matchesParamPattern(settings.RedactParams, name) {
+			values = []string{redactedValue}
+			redacted = true
+		}
+		params[name] = values
+	}
+	if !redacted {
+		return &stored
+	}
+	stored.RawRequest.Params = params
+
+	// The raw URL carries the same query string
+	if parsed, err := url.Parse(event.RawRequest.URL); err == nil {
+		query := parsed.Query()
+		for name := range query {
+			if matchesParamPattern(settings.RedactParams, name) {
+				query.Set(name, redactedValue)
+			}
+		}
+		parsed.RawQuery = query.Encode()
+		stored.RawRequest.URL = parsed.String()
+	}
+
+	return &stored
+}
+
+// applyIPPolicy truncates or drops a client IP according to the PII policy
+func applyIPPolicy(ip netip.Addr, policy string) netip.Addr {
+	if !ip.IsValid() {
+		return ip
+	}
+
+	switch policy {
+	case PIIPolicyDropIP:
+		if ip.Is4() || ip.Is4In6() {
+			return netip.IPv4Unspecified()
+		}
+		return netip.IPv6Unspecified()
+	case PIIPolicyTruncateIP:
+		bits := 48
+		if ip.Is4() || ip.Is4In6() {
+			ip, bits = ip.Unmap(), 24
+		}
+		if prefix, err := ip.Prefix(bits); err == nil {
+			return prefix.Addr()
+		}
+	}
+	return ip
+}
@@ -0,0 +1,156 @@
+package ingestion
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// otherOrganization labels organizations beyond the label limit
+const otherOrganization = "other"
+
+// PrometheusMetrics records ingestion metrics in a Prometheus registry.
+// Organization labels are capped at maxOrganizations distinct values; later
+// organizations are counted under "other" so label cardinality stays bounded.
+type PrometheusMetrics struct {
+	registry *prometheus.Registry
+
+	redirectDuration *prometheus.HistogramVec
+	events           *prometheus.CounterVec
+	duplicates       *prometheus.CounterVec
+	fraud            *prometheus.CounterVec
+	publishFailures  *prometheus.CounterVec
+	queueDepth       *prometheus.GaugeVec
+	overflow         prometheus.Counter
+
+	mu               sync.RWMutex
+	organizations    map[string]bool
+	maxOrganizations int
+}
+
+// NewPrometheusMetrics creates Prometheus metrics with their own registry
+func NewPrometheusMetrics(maxOrganizations int) *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		registry: prometheus.NewRegistry(),
+		redirectDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "redirect_duration_seconds",
+			Help:      "Time from request to redirect.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"organization_id"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "events_total",
+			Help:      "Events published to Pub/Sub.",
+		}, []string{"organization_id"}),
+		duplicates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "duplicates_total",
+			Help:      "Duplicate clicks and postbacks.",
+		}, []string{"organization_id"}),
+		fraud: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "fraud_flags_total",
+			Help:      "Fraud flags raised, by flag.",
+		}, []string{"organization_id", "fraud_type"}),
+		publishFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "publish_failures_total",
+			Help:      "Events that failed to publish to Pub/Sub.",
+		}, []string{"organization_id"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "queue_depth",
+			Help:      "Items waiting in internal queues.",
+		}, []string{"queue"}),
+		overflow: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "trellis",
+			Subsystem: "ingress",
+			Name:      "organization_label_overflow_total",
+			Help:      "Observations labeled \"other\" because the organization label limit was reached.",
+		}),
+		organizations:    make(map[string]bool),
+		maxOrganizations: maxOrganizations,
+	}
+
+	m.registry.MustRegister(
+		m.redirectDuration,
+		m.events,
+		m.duplicates,
+		m.fraud,
+		m.publishFailures,
+		m.queueDepth,
+		m.overflow,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RecordRedirect observes redirect latency
+func (m *PrometheusMetrics) RecordRedirect(duration time.Duration, organizationID, campaignID string) {
+	m.redirectDuration.WithLabelValues(m.organizationLabel(organizationID)).Observe(duration.Seconds())
+}
+
+// RecordEvent counts a published event
+func (m *PrometheusMetrics) RecordEvent(organizationID string) {
+	m.events.WithLabelValues(m.organizationLabel(organizationID)).Inc()
+}
+
+// RecordDuplicate counts a duplicate click or postback
+func (m *PrometheusMetrics) RecordDuplicate(organizationID string) {
+	m.duplicates.WithLabelValues(m.organizationLabel(organizationID)).Inc()
+}
+
+// RecordFraud counts a fraud flag
+func (m *PrometheusMetrics) RecordFraud(organizationID, fraudType string) {
+	m.fraud.WithLabelValues(m.organizationLabel(organizationID), fraudType).Inc()
+}
+
+// RecordPublishFailure counts an event that failed to publish
+func (m *PrometheusMetrics) RecordPublishFailure(organizationID string) {
+	m.publishFailures.WithLabelValues(m.organizationLabel(organizationID)).Inc()
+}
+
+// SetQueueDepth reports the number of items waiting in a queue
+func (m *PrometheusMetrics) SetQueueDepth(queue string, depth int) {
+	m.queueDepth.WithLabelValues(queue).Set(float64(depth))
+}
+
+// organizationLabel returns the label value for an organization, admitting
+// new organizations until the limit is reached
+func (m *PrometheusMetrics) organizationLabel(organizationID string) string {
+	m.mu.RLock()
+	known := m.organizations[organizationID]
+	m.mu.RUnlock()
+	if known {
+		return organizationID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.organizations[organizationID] {
+		return organizationID
+	}
+	if len(m.organizations) >= m.maxOrganizations {
+		m.overflow.Inc()
+		return otherOrganization
+	}
+	m.organizations[organizationID] = true
+	return organizationID
+}
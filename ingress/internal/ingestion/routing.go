@@ -5,13 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
-	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/dgraph-io/ristretto"
+	"github.com/orchard9/trellis/ingress/internal/rules"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RoutingEngine manages organization-aware campaign routing
@@ -19,40 +20,114 @@ type RoutingEngine struct {
 	clickhouse clickhouse.Conn
 	cache      *ristretto.Cache
 	mu         sync.RWMutex
-	campaigns  map[string]*Campaign // org_id/campaign_id -> Campaign
+	campaigns  map[string]*Campaign             // org_id/campaign_id -> Campaign
+	settings   map[string]*OrganizationSettings // org_id -> settings
+	defaults   OrganizationSettings
 }
 
 // Campaign represents a traffic routing campaign
 type Campaign struct {
-	OrganizationID  string    `json:"organization_id"`
-	CampaignID      string    `json:"campaign_id"`
-	Name            string    `json:"name"`
-	Status          string    `json:"status"`
-	Rules           []Rule    `json:"rules"`
-	DestinationURL  string    `json:"destination_url"`
-	AppendParams    bool      `json:"append_params"`
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	OrganizationID     string             `json:"organization_id"`
+	CampaignID         string             `json:"campaign_id"`
+	Name               string             `json:"name"`
+	Status             string             `json:"status"`
+	Rules              []Rule             `json:"rules"`
+	DestinationURL     string             `json:"destination_url"`
+	AppendParams       bool               `json:"append_params"`
+	StartsAt           *time.Time         `json:"starts_at,omitempty"`            // campaign activates at this time
+	EndsAt             *time.Time         `json:"ends_at,omitempty"`              // campaign expires at this time
+	DedupWindowSeconds int                `json:"dedup_window_seconds,omitempty"` // overrides organization window when > 0
+	DedupKey           string             `json:"dedup_key,omitempty"`            // overrides organization dedup key
+	Variants           []Variant          `json:"variants,omitempty"`             // weighted alternative destinations
+	ForwardParams      []string           `json:"forward_params,omitempty"`       // params appended to the destination; all if empty
+	BlockParams        []string           `json:"block_params,omitempty"`         // params never appended, e.g. secrets
+	OutboundPostbacks  []OutboundPostback `json:"outbound_postbacks,omitempty"`   // notify the traffic source of conversions
+	CreatedAt          time.Time          `json:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at"`
+
+	program *rules.Program // compiled Rules
 }
 
-// Rule defines campaign matching criteria
-type Rule struct {
-	Field     string      `json:"field"`      // source, medium, country, etc.
-	Operator  string      `json:"operator"`   // equals, contains, in, regex
-	Values    []string    `json:"values"`
-	Priority  int         `json:"priority"`   // higher priority rules match first
+// compileRules compiles the campaign's rules for routing; call it whenever
+// Rules change, before the campaign is shared
+func (c *Campaign) compileRules() {
+	c.program = rules.CompileSet(c.Rules)
+}
+
+// ruleProgram returns the compiled rules, compiling them for campaigns that
+// were never cached
+func (c *Campaign) ruleProgram() *rules.Program {
+	if c.program != nil {
+		return c.program
+	}
+	return rules.CompileSet(c.Rules)
 }
 
+// Campaign statuses loaded for routing
+const (
+	CampaignStatusActive = "active"
+	CampaignStatusShadow = "shadow" // evaluated on live traffic and recorded, never routed
+)
+
+// Rule defines campaign matching criteria
+type Rule = rules.Rule
+
 // MatchResult contains routing decision information
 type MatchResult struct {
 	Campaign    *Campaign
 	Matched     bool
-	Rule        *Rule
+	Rules       []int // indexes of the matched campaign rules, for rule matches
+	Score       int
+	Variant     *Variant
 	Destination string
+	Reason      string // explicit, rules, default or fallback
+	Shadow      []ShadowMatch
+}
+
+// RoutingDecision records on an event how its click was routed
+type RoutingDecision struct {
+	Reason          string        `json:"reason"`                     // explicit, rules, default or fallback
+	CampaignID      string        `json:"campaign_id,omitempty"`      // campaign that handled the click
+	CampaignVersion int64         `json:"campaign_version,omitempty"` // campaign updated_at, unix milliseconds
+	MatchedRules    []int         `json:"matched_rules,omitempty"`    // indexes into the campaign's rules
+	Score           int           `json:"score,omitempty"`
+	Variant         string        `json:"variant,omitempty"`
+	DestinationURL  string        `json:"destination_url,omitempty"` // empty when nothing was configured
+	Shadow          []ShadowMatch `json:"shadow,omitempty"`          // shadow campaigns that matched
+}
+
+// Decision summarizes the match for the event, with the destination the
+// visitor was sent to
+func (m *MatchResult) Decision(destination string) *RoutingDecision {
+	decision := &RoutingDecision{
+		Reason:         m.Reason,
+		MatchedRules:   m.Rules,
+		Score:          m.Score,
+		DestinationURL: destination,
+		Shadow:         m.Shadow,
+	}
+	if m.Campaign != nil {
+		decision.CampaignID = m.Campaign.CampaignID
+		if !m.Campaign.UpdatedAt.IsZero() {
+			decision.CampaignVersion = m.Campaign.UpdatedAt.UnixMilli()
+		}
+	}
+	if m.Variant != nil {
+		decision.Variant = m.Variant.Name
+	}
+	return decision
 }
 
+// Match reasons, in the order routing tries them
+const (
+	MatchReasonExplicit = "explicit" // campaign from the URL path
+	MatchReasonRules    = "rules"    // best scoring campaign rules
+	MatchReasonDefault  = "default"  // the organization's "default" campaign
+	MatchReasonFallback = "fallback" // the organization's default destination, if any
+)
+
 // NewRoutingEngine creates a new routing engine
-func NewRoutingEngine(ch clickhouse.Conn) (*RoutingEngine, error) {
+func NewRoutingEngine(ch clickhouse.Conn, defaults OrganizationSettings) (*RoutingEngine, error) {
 	// Create cache for routing rules
 	cache, err := ristretto.NewCache(&ristretto.Config{
 		NumCounters: 1000000,   // 10x expected entries
@@ -67,11 +142,20 @@ func NewRoutingEngine(ch clickhouse.Conn) (*RoutingEngine, error) {
 		clickhouse: ch,
 		cache:      cache,
 		campaigns:  make(map[string]*Campaign),
+		settings:   make(map[string]*OrganizationSettings),
+		defaults:   defaults,
 	}
 
-	// Load initial campaigns
-	if err := re.loadCampaigns(context.Background()); err != nil {
-		slog.Warn("failed to load initial campaigns", "error", err)
+	if ch != nil {
+		// Load initial campaigns
+		if err := re.loadCampaigns(context.Background()); err != nil {
+			slog.Warn("failed to load initial campaigns", "error", err)
+		}
+
+		// Load organization settings
+		if err := re.loadOrganizationSettings(context.Background()); err != nil {
+			slog.Warn("failed to load organization settings", "error", err)
+		}
 	}
 
 	// Start background campaign refresh
@@ -81,46 +165,130 @@ func NewRoutingEngine(ch clickhouse.Conn) (*RoutingEngine, error) {
 }
 
 // GetDestination determines the destination URL for a request
-func (re *RoutingEngine) GetDestination(organizationID, campaignID string, params map[string][]string) string {
+func (re *RoutingEngine) GetDestination(ctx context.Context, organizationID, campaignID string, params map[string][]string, attrs Attributes) string {
+	return re.Route(ctx, organizationID, campaignID, params, attrs).Destination
+}
+
+// Route determines the campaign and destination URL for a request.
+// campaignID is the bare campaign ID from the URL path, if any.
+func (re *RoutingEngine) Route(ctx context.Context, organizationID, campaignID string, params map[string][]string, attrs Attributes) *MatchResult {
+	_, span := tracer.Start(ctx, "routing.Route")
+	defer span.End()
+
+	match := re.route(organizationID, campaignID, params, attrs, time.Now(), nil)
+	if match.Campaign != nil {
+		span.SetAttributes(attribute.String("campaign_id", match.Campaign.CampaignID))
+	}
+	span.SetAttributes(attribute.Bool("routing.matched", match.Matched))
+	return match
+}
+
+// route is Route without tracing. When trace is non-nil every step and
+// candidate campaign evaluated is recorded in it.
+func (re *RoutingEngine) route(organizationID, campaignID string, params map[string][]string, attrs Attributes, now time.Time, trace *RoutingTrace) *MatchResult {
+	settings := re.OrganizationSettings(organizationID)
+
+	match, shadows := re.decide(organizationID, campaignID, settings, params, attrs, now, trace)
+	if len(shadows) > 0 {
+		match.Shadow = re.shadowMatches(shadows, match, settings, params, attrs)
+	}
+	return match
+}
+
+// decide walks the routing fallback chain, collecting the shadow campaigns
+// that matched along the way
+func (re *RoutingEngine) decide(organizationID, campaignID string, settings *OrganizationSettings, params map[string][]string, attrs Attributes, now time.Time, trace *RoutingTrace) (*MatchResult, []shadowCandidate) {
+	var shadows []shadowCandidate
+
 	// If campaign is explicitly specified, use it
 	if campaignID != "" {
 		key := fmt.Sprintf("%s/%s", organizationID, campaignID)
-		if campaign := re.getCampaign(key); campaign != nil && campaign.Status == "active" {
-			return re.buildDestinationURL(campaign, params)
+		campaign := re.getCampaign(key)
+		if campaign != nil && campaign.isLiveAt(now) {
+			trace.step(MatchReasonExplicit, OutcomeMatched)
+			variant := campaign.pickVariant(attrs[AttrVisitorID])
+			return &MatchResult{
+				Campaign:    campaign,
+				Matched:     true,
+				Variant:     variant,
+				Destination: re.buildDestinationURL(campaign, variant, settings, params, attrs),
+				Reason:      MatchReasonExplicit,
+			}, nil
+		}
+		switch {
+		case campaign == nil:
+			trace.step(MatchReasonExplicit, OutcomeNotFound)
+		case campaign.isShadowAt(now):
+			trace.step(MatchReasonExplicit, OutcomeShadow)
+			shadows = append(shadows, shadowCandidate{campaign: campaign, explicit: true})
+		default:
+			trace.step(MatchReasonExplicit, OutcomeNotLive)
 		}
 	}
 
 	// Otherwise, find best matching campaign
-	campaign := re.findBestMatch(organizationID, params)
+	campaign, ruleShadows := re.findBestMatch(organizationID, attrs, now, trace)
+	shadows = append(shadows, ruleShadows...)
 	if campaign != nil {
-		return re.buildDestinationURL(campaign, params)
+		trace.step(MatchReasonRules, OutcomeMatched)
+		variant := campaign.pickVariant(attrs[AttrVisitorID])
+		rules, score := re.matchedRules(campaign, attrs, now.In(settings.Location()))
+		return &MatchResult{
+			Campaign:    campaign,
+			Matched:     true,
+			Rules:       rules,
+			Score:       score,
+			Variant:     variant,
+			Destination: re.buildDestinationURL(campaign, variant, settings, params, attrs),
+			Reason:      MatchReasonRules,
+		}, shadows
 	}
+	trace.step(MatchReasonRules, OutcomeNoMatch)
 
 	// Default fallback - try to find default campaign for organization
 	defaultKey := fmt.Sprintf("%s/default", organizationID)
-	if defaultCampaign := re.getCampaign(defaultKey); defaultCampaign != nil {
-		return re.buildDestinationURL(defaultCampaign, params)
+	defaultCampaign := re.getCampaign(defaultKey)
+	if defaultCampaign != nil && defaultCampaign.isLiveAt(now) {
+		trace.step(MatchReasonDefault, OutcomeMatched)
+		variant := defaultCampaign.pickVariant(attrs[AttrVisitorID])
+		return &MatchResult{
+			Campaign:    defaultCampaign,
+			Variant:     variant,
+			Destination: re.buildDestinationURL(defaultCampaign, variant, settings, params, attrs),
+			Reason:      MatchReasonDefault,
+		}, shadows
+	}
+	if defaultCampaign != nil {
+		trace.step(MatchReasonDefault, OutcomeNotLive)
+	} else {
+		trace.step(MatchReasonDefault, OutcomeNotFound)
 	}
 
-	// Ultimate fallback
-	return "https://example.com/"
+	// Ultimate fallback: the organization's default destination, if any
+	if settings.DefaultDestinationURL == "" {
+		trace.step(MatchReasonFallback, OutcomeNotFound)
+		return &MatchResult{Reason: MatchReasonFallback}, shadows
+	}
+	trace.step(MatchReasonFallback, OutcomeMatched)
+	fallback := &Campaign{OrganizationID: organizationID, DestinationURL: settings.DefaultDestinationURL}
+	return &MatchResult{
+		Destination: re.buildDestinationURL(fallback, nil, settings, params, attrs),
+		Reason:      MatchReasonFallback,
+	}, shadows
 }
 
-// findBestMatch finds the best matching campaign for the given parameters
-func (re *RoutingEngine) findBestMatch(organizationID string, params map[string][]string) *Campaign {
+// findBestMatch finds the best matching campaign for the given request
+// attributes, and the shadow campaigns whose rules matched
+func (re *RoutingEngine) findBestMatch(organizationID string, attrs Attributes, now time.Time, trace *RoutingTrace) (*Campaign, []shadowCandidate) {
 	re.mu.RLock()
 	defer re.mu.RUnlock()
 
+	// Time-based rules are evaluated in the organization's timezone
+	local := now.In(re.organizationSettingsLocked(organizationID).Location())
+
 	var bestMatch *Campaign
 	var bestScore int
-
-	// Convert params to flat map for easier matching
-	flatParams := make(map[string]string)
-	for key, values := range params {
-		if len(values) > 0 {
-			flatParams[key] = values[0]
-		}
-	}
+	var shadows []shadowCandidate
 
 	// Check each campaign for this organization
 	for key, campaign := range re.campaigns {
@@ -129,95 +297,77 @@ func (re *RoutingEngine) findBestMatch(organizationID string, params map[string]
 			continue
 		}
 
-		if campaign.Status != "active" {
+		candidate := trace.candidate(campaign)
+
+		// Shadow campaigns are scored like live ones but never route
+		if campaign.isShadowAt(now) {
+			if score := re.calculateMatchScore(campaign, attrs, local, candidate); score > 0 {
+				shadows = append(shadows, shadowCandidate{campaign: campaign, score: score})
+			}
+			continue
+		}
+
+		if !campaign.isLiveAt(now) {
 			continue
 		}
 
-		score := re.calculateMatchScore(campaign, flatParams)
+		score := re.calculateMatchScore(campaign, attrs, local, candidate)
 		if score > bestScore {
 			bestMatch = campaign
 			bestScore = score
 		}
 	}
 
-	return bestMatch
+	return bestMatch, shadows
 }
 
-// calculateMatchScore calculates how well a campaign matches the parameters
-func (re *RoutingEngine) calculateMatchScore(campaign *Campaign, params map[string]string) int {
-	score := 0
+// calculateMatchScore calculates how well a campaign matches the request
+// attributes, recording each rule in candidate when it is non-nil
+func (re *RoutingEngine) calculateMatchScore(campaign *Campaign, attrs Attributes, now time.Time, candidate *CandidateTrace) int {
+	program := campaign.ruleProgram()
+	src := ruleSource{attrs: attrs, now: now}
+	if candidate == nil {
+		return program.Score(src)
+	}
 
-	for _, rule := range campaign.Rules {
-		if re.ruleMatches(rule, params) {
-			score += rule.Priority
+	score := 0
+	for i := range program.Terms {
+		term := &program.Terms[i]
+		matched := term.Condition.Match(src)
+		if matched {
+			score += term.Priority
 		}
+		candidate.rule(campaign.Rules[i], attrs, now, matched)
 	}
-
+	candidate.Score = score
 	return score
 }
 
-// ruleMatches checks if a rule matches the given parameters
-func (re *RoutingEngine) ruleMatches(rule Rule, params map[string]string) bool {
-	paramValue, exists := params[rule.Field]
-	if !exists {
-		return false
-	}
-
-	switch rule.Operator {
-	case "equals":
-		for _, value := range rule.Values {
-			if paramValue == value {
-				return true
-			}
-		}
-	case "contains":
-		for _, value := range rule.Values {
-			if strings.Contains(strings.ToLower(paramValue), strings.ToLower(value)) {
-				return true
-			}
-		}
-	case "in":
-		for _, value := range rule.Values {
-			if paramValue == value {
-				return true
-			}
-		}
-	case "prefix":
-		for _, value := range rule.Values {
-			if strings.HasPrefix(paramValue, value) {
-				return true
-			}
-		}
-	}
-
-	return false
+// matchedRules returns the indexes of the campaign rules matching the
+// request and their total score
+func (re *RoutingEngine) matchedRules(campaign *Campaign, attrs Attributes, now time.Time) ([]int, int) {
+	return campaign.ruleProgram().Matched(ruleSource{attrs: attrs, now: now})
 }
 
-// buildDestinationURL creates the final destination URL with optional parameter appending
-func (re *RoutingEngine) buildDestinationURL(campaign *Campaign, params map[string][]string) string {
-	baseURL := campaign.DestinationURL
-
-	if !campaign.AppendParams || len(params) == 0 {
-		return baseURL
-	}
-
-	// Parse base URL
-	parsedURL, err := url.Parse(baseURL)
-	if err != nil {
-		slog.Warn("invalid destination URL", "url", baseURL, "error", err)
-		return baseURL
+// ruleValue resolves the request value a rule field refers to.
+// Virtual time fields are resolved from now, which must already be in the
+// organization's timezone.
+func ruleValue(field string, attrs Attributes, now time.Time) (string, bool) {
+	if value, ok := timeFieldValue(field, now); ok {
+		return value, true
 	}
+	return attrs.Get(field)
+}
 
-	// Add parameters
-	query := parsedURL.Query()
-	for key, values := range params {
-		for _, value := range values {
-			query.Add(key, value)
-		}
-	}
+// ruleSource resolves rule fields for the evaluator
+type ruleSource struct {
+	attrs Attributes
+	now   time.Time
+}
 
-	parsedURL.RawQuery = query.Encode()
-	return parsedURL.String()
+// Lookup returns the request value of a rule field
+func (s ruleSource) Lookup(field string) (string, bool) {
+	return ruleValue(field, s.attrs, s.now)
 }
 
 // getCampaign retrieves a campaign from cache or database
@@ -244,10 +394,19 @@ func (re *RoutingEngine) loadCampaigns(ctx context.Context) error {
 			rules,
 			destination_url,
 			append_params,
+			starts_at,
+			ends_at,
+			dedup_window_seconds,
+			dedup_key,
+			variants,
+			forward_params,
+			block_params,
+			outbound_postbacks,
 			created_at,
 			updated_at
 		FROM campaigns 
-		WHERE status = 'active'
+		WHERE status IN ('active', 'shadow')
+		  AND (ends_at IS NULL OR ends_at > now64(3))
 		ORDER BY organization_id, campaign_id
 	`
 
@@ -261,7 +420,8 @@ func (re *RoutingEngine) loadCampaigns(ctx context.Context) error {
 
 	for rows.Next() {
 		var campaign Campaign
-		var rulesJSON string
+		var rulesJSON, variantsJSON, outboundJSON string
+		var dedupWindow uint32
 
 		err := rows.Scan(
 			&campaign.OrganizationID,
@@ -271,6 +431,14 @@ func (re *RoutingEngine) loadCampaigns(ctx context.Context) error {
 			&rulesJSON,
 			&campaign.DestinationURL,
 			&campaign.AppendParams,
+			&campaign.StartsAt,
+			&campaign.EndsAt,
+			&dedupWindow,
+			&campaign.DedupKey,
+			&variantsJSON,
+			&campaign.ForwardParams,
+			&campaign.BlockParams,
+			&outboundJSON,
 			&campaign.CreatedAt,
 			&campaign.UpdatedAt,
 		)
@@ -278,6 +446,7 @@ func (re *RoutingEngine) loadCampaigns(ctx context.Context) error {
 			slog.Warn("failed to scan campaign row", "error", err)
 			continue
 		}
+		campaign.DedupWindowSeconds = int(dedupWindow)
 
 		// Parse rules JSON
 		if err := json.Unmarshal([]byte(rulesJSON), &campaign.Rules); err != nil {
@@ -286,6 +455,21 @@ func (re *RoutingEngine) loadCampaigns(ctx context.Context) error {
 				"error", err)
 			continue
 		}
+		campaign.compileRules()
+		if variantsJSON != "" {
+			if err := json.Unmarshal([]byte(variantsJSON), &campaign.Variants); err != nil {
+				slog.Warn("failed to parse campaign variants",
+					"campaign_id", campaign.CampaignID,
+					"error", err)
+			}
+		}
+		if outboundJSON != "" {
+			if err := json.Unmarshal([]byte(outboundJSON), &campaign.OutboundPostbacks); err != nil {
+				slog.Warn("failed to parse campaign outbound postbacks",
+					"campaign_id", campaign.CampaignID,
+					"error", err)
+			}
+		}
 
 		key := fmt.Sprintf("%s/%s", campaign.OrganizationID, campaign.CampaignID)
 		campaigns[key] = &campaign
@@ -308,10 +492,16 @@ func (re *RoutingEngine) refreshCampaigns() {
 	for {
 		select {
 		case <-ticker.C:
+			if re.clickhouse == nil {
+				continue
+			}
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			if err := re.loadCampaigns(ctx); err != nil {
 				slog.Error("failed to refresh campaigns", "error", err)
 			}
+			if err := re.loadOrganizationSettings(ctx); err != nil {
+				slog.Error("failed to refresh organization settings", "error", err)
+			}
 			cancel()
 		}
 	}
@@ -319,16 +509,33 @@ func (re *RoutingEngine) refreshCampaigns() {
 
 // CreateCampaign creates a new campaign in the database
 func (re *RoutingEngine) CreateCampaign(ctx context.Context, campaign *Campaign) error {
+	if err := campaign.ValidateDestinations(); err != nil {
+		return err
+	}
 	rulesJSON, err := json.Marshal(campaign.Rules)
 	if err != nil {
 		return fmt.Errorf("failed to marshal rules: %w", err)
 	}
+	variantsJSON, err := json.Marshal(campaign.Variants)
+	if err != nil {
+		return fmt.Errorf("failed to marshal variants: %w", err)
+	}
+	outboundJSON, err := marshalOutboundPostbacks(campaign.OutboundPostbacks)
+	if err != nil {
+		return err
+	}
+
+	// The cached campaign carries the stored timestamps, which version
+	// the routing decisions recorded on events
+	now := time.Now().UTC().Truncate(time.Millisecond)
 
 	query := `
 		INSERT INTO campaigns (
 			organization_id, campaign_id, name, status, rules, 
-			destination_url, append_params, created_by
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			destination_url, append_params, starts_at, ends_at,
+			dedup_window_seconds, dedup_key, variants, forward_params,
+			block_params, outbound_postbacks, created_by, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	err = re.clickhouse.Exec(ctx, query,
@@ -339,7 +546,17 @@ func (re *RoutingEngine) CreateCampaign(ctx context.Context, campaign *Campaign)
 		string(rulesJSON),
 		campaign.DestinationURL,
 		campaign.AppendParams,
+		campaign.StartsAt,
+		campaign.EndsAt,
+		uint32(campaign.DedupWindowSeconds),
+		campaign.DedupKey,
+		string(variantsJSON),
+		campaign.ForwardParams,
+		campaign.BlockParams,
+		outboundJSON,
 		"api", // created_by - could be extracted from auth context
+		now,
+		now,
 	)
 
 	if err != nil {
@@ -347,6 +564,8 @@ func (re *RoutingEngine) CreateCampaign(ctx context.Context, campaign *Campaign)
 	}
 
 	// Update local cache
+	campaign.CreatedAt, campaign.UpdatedAt = now, now
+	campaign.compileRules()
 	key := fmt.Sprintf("%s/%s", campaign.OrganizationID, campaign.CampaignID)
 	re.mu.Lock()
 	re.campaigns[key] = campaign
@@ -357,10 +576,21 @@ func (re *RoutingEngine) CreateCampaign(ctx context.Context, campaign *Campaign)
 
 // UpdateCampaign updates an existing campaign
 func (re *RoutingEngine) UpdateCampaign(ctx context.Context, campaign *Campaign) error {
+	if err := campaign.ValidateDestinations(); err != nil {
+		return err
+	}
 	rulesJSON, err := json.Marshal(campaign.Rules)
 	if err != nil {
 		return fmt.Errorf("failed to marshal rules: %w", err)
 	}
+	variantsJSON, err := json.Marshal(campaign.Variants)
+	if err != nil {
+		return fmt.Errorf("failed to marshal variants: %w", err)
+	}
+	outboundJSON, err := marshalOutboundPostbacks(campaign.OutboundPostbacks)
+	if err != nil {
+		return err
+	}
 
 	query := `
 		ALTER TABLE campaigns UPDATE 
@@ -369,16 +599,36 @@ func (re *RoutingEngine) UpdateCampaign(ctx context.Context, campaign *Campaign)
 			rules = ?, 
 			destination_url = ?, 
 			append_params = ?, 
-			updated_at = now64(3)
+			starts_at = ?,
+			ends_at = ?,
+			dedup_window_seconds = ?,
+			dedup_key = ?,
+			variants = ?,
+			forward_params = ?,
+			block_params = ?,
+			outbound_postbacks = ?,
+			updated_at = ?
 		WHERE organization_id = ? AND campaign_id = ?
 	`
 
+	// The cached campaign must carry the stored version
+	updatedAt := time.Now().UTC().Truncate(time.Millisecond)
+
 	err = re.clickhouse.Exec(ctx, query,
 		campaign.Name,
 		campaign.Status,
 		string(rulesJSON),
 		campaign.DestinationURL,
 		campaign.AppendParams,
+		campaign.StartsAt,
+		campaign.EndsAt,
+		uint32(campaign.DedupWindowSeconds),
+		campaign.DedupKey,
+		string(variantsJSON),
+		campaign.ForwardParams,
+		campaign.BlockParams,
+		outboundJSON,
+		updatedAt,
 		campaign.OrganizationID,
 		campaign.CampaignID,
 	)
@@ -388,6 +638,8 @@ func (re *RoutingEngine) UpdateCampaign(ctx context.Context, campaign *Campaign)
 	}
 
 	// Update local cache
+	campaign.UpdatedAt = updatedAt
+	campaign.compileRules()
 	key := fmt.Sprintf("%s/%s", campaign.OrganizationID, campaign.CampaignID)
 	re.mu.Lock()
 	re.campaigns[key] = campaign
@@ -419,6 +671,25 @@ func (re *RoutingEngine) DeleteCampaign(ctx context.Context, organizationID, cam
 	return nil
 }
 
+// GetCampaign returns an organization's campaign by its bare ID, or nil
+func (re *RoutingEngine) GetCampaign(organizationID, campaignID string) *Campaign {
+	return re.getCampaign(fmt.Sprintf("%s/%s", organizationID, campaignID))
+}
+
+// marshalOutboundPostbacks validates and encodes a campaign's outbound postbacks
+func marshalOutboundPostbacks(outbound []OutboundPostback) (string, error) {
+	for i := range outbound {
+		if err := outbound[i].Validate(); err != nil {
+			return "", fmt.Errorf("invalid outbound postback %d: %w", i, err)
+		}
+	}
+	data, err := json.Marshal(outbound)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal outbound postbacks: %w", err)
+	}
+	return string(data), nil
+}
+
 // GetOrganizationCampaigns returns all campaigns for an organization
 func (re *RoutingEngine) GetOrganizationCampaigns(organizationID string) []*Campaign {
 	re.mu.RLock()
@@ -0,0 +1,202 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+// RoutingAPI exposes routing diagnostics
+type RoutingAPI struct {
+	handler *Handler
+}
+
+// NewRoutingAPI creates the routing API on top of the ingestion handler so
+// explained requests go through the same enrichment and routing as clicks
+func NewRoutingAPI(handler *Handler) *RoutingAPI {
+	return &RoutingAPI{handler: handler}
+}
+
+// Routes mounts the routing endpoints:
+//
+//	POST /explain                  route a synthetic click and report how it was decided
+//	GET  /shadow/{campaign_id}     compare a shadow campaign with actual routing (?from=, ?to=, ?samples=)
+func (a *RoutingAPI) Routes(r chi.Router) {
+	r.Post("/explain", a.explain)
+	r.Get("/shadow/{campaign_id}", a.shadow)
+}
+
+// explainRequest is a synthetic click
+type explainRequest struct {
+	CampaignID  string            `json:"campaign_id"` // as in /in/{campaign_id}
+	Params      map[string]string `json:"params"`
+	Headers     map[string]string `json:"headers"`
+	IP          string            `json:"ip"`
+	UserAgent   string            `json:"user_agent"`
+	VisitorID   string            `json:"visitor_id"`
+	IsReturning bool              `json:"is_returning"`
+	Time        *time.Time        `json:"time"` // defaults to now
+}
+
+// explainResponse is the routing trace plus the redirect a click would get
+type explainResponse struct {
+	*RoutingTrace
+	RedirectURL string `json:"redirect_url"` // empty answers 404
+	IsBot       bool   `json:"is_bot"`
+	BotName     string `json:"bot_name,omitempty"`
+}
+
+// explain routes a synthetic click without recording anything
+func (a *RoutingAPI) explain(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	orgCtx, ok := auth.GetOrganizationContext(ctx)
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	var req explainRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var ip netip.Addr
+	if req.IP != "" {
+		parsed, err := netip.ParseAddr(req.IP)
+		if err != nil {
+			http.Error(w, "Invalid ip", http.StatusBadRequest)
+			return
+		}
+		ip = parsed
+	}
+
+	now := time.Now()
+	if req.Time != nil {
+		now = *req.Time
+	}
+
+	headers := make(map[string]string, len(req.Headers)+1)
+	for name, value := range req.Headers {
+		headers[strings.ToLower(name)] = value
+	}
+	if req.UserAgent != "" {
+		headers["user-agent"] = req.UserAgent
+	}
+	params := make(url.Values, len(req.Params))
+	for name, value := range req.Params {
+		params.Set(name, value)
+	}
+
+	path := "/in"
+	if req.CampaignID != "" {
+		path += "/" + req.CampaignID
+	}
+
+	event := &Event{
+		EventID:        uuid.New().String(),
+		Timestamp:      now.UnixNano(),
+		OrganizationID: orgCtx.OrganizationID,
+		EventType:      EventTypeClick,
+		ClickID:        a.handler.ids.NextString(),
+		UserID:         req.VisitorID,
+		IsReturning:    req.IsReturning,
+		RawRequest: RawRequest{
+			Method:  http.MethodGet,
+			URL:     path + "?" + params.Encode(),
+			Path:    path,
+			Headers: headers,
+			IP:      ip,
+			Params:  params,
+		},
+	}
+
+	bot, settings, _ := a.handler.classifyClick(ctx, event)
+
+	// Bots are routed before visitor identification, like live traffic
+	if bot.IsBot {
+		event.UserID = ""
+		event.IsReturning = false
+	}
+
+	match, trace := a.handler.routing.Explain(event.OrganizationID, req.CampaignID, params, NewAttributes(event), now)
+
+	redirectURL := match.Destination
+	if !bot.IsBot {
+		redirectURL = clickDestination(match.Destination, settings, event.ClickID)
+	}
+
+	writeJSON(w, http.StatusOK, &explainResponse{
+		RoutingTrace: trace,
+		RedirectURL:  redirectURL,
+		IsBot:        bot.IsBot,
+		BotName:      bot.Name,
+	})
+}
+
+// shadow compares a shadow campaign's would-be routing with actual routing,
+// over the last 24 hours unless from and to (RFC 3339) are given
+func (a *RoutingAPI) shadow(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now()
+	if raw := query.Get("to"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if raw := query.Get("from"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	samples := 20
+	if raw := query.Get("samples"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 100 {
+			http.Error(w, "samples must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+		samples = n
+	}
+
+	campaignID := chi.URLParam(r, "campaign_id")
+	report, err := a.handler.routing.ShadowReport(r.Context(), orgCtx.OrganizationID, campaignID, from, to, samples)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Shadow reports are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to build shadow report", "error", err, "campaign_id", campaignID)
+		http.Error(w, "Failed to build shadow report", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,344 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Dedup key strategies
+const (
+	DedupKeyClickID = "click_id" // provided click ID, falling back to ip_ua
+	DedupKeyIPUA    = "ip_ua"    // client IP + user agent
+	DedupKeyVisitor = "visitor"  // trellis_uid visitor ID
+)
+
+// PII policies applied to stored events
+const (
+	PIIPolicyFull       = "full"        // store the client IP as received
+	PIIPolicyTruncateIP = "truncate_ip" // keep the /24 (IPv4) or /48 (IPv6) network
+	PIIPolicyDropIP     = "drop_ip"     // store the unspecified address
+)
+
+// Retention bounds in days
+const (
+	DefaultRetentionDays = 90
+	MaxRetentionDays     = 3650
+)
+
+// OrganizationSettings holds per-organization ingestion behaviour
+type OrganizationSettings struct {
+	OrganizationID string `json:"organization_id"`
+
+	// IANA timezone used for time-based routing rules
+	Timezone string `json:"timezone"`
+
+	// Duplicate click detection
+	DedupWindowSeconds int    `json:"dedup_window_seconds"`
+	DedupKey           string `json:"dedup_key"`
+
+	// Fraud policy: scores at or above ReviewThreshold go to SafePageURL,
+	// scores at or above BlockThreshold are blocked
+	FraudReviewThreshold float32 `json:"fraud_review_threshold"`
+	FraudBlockThreshold  float32 `json:"fraud_block_threshold"`
+	SafePageURL          string  `json:"safe_page_url,omitempty"`
+
+	// Rate limit plan (empty uses the default plan)
+	Plan string `json:"plan,omitempty"`
+
+	// Click ID parameters tried before the defaults, and the destination
+	// parameter carrying the canonical click ID (empty disables appending)
+	ClickIDMappings []ClickIDMapping `json:"click_id_mappings,omitempty"`
+	ClickIDParam    string           `json:"click_id_param"`
+
+	// Destination used when no campaign matches; renders like a campaign
+	// destination template. Empty answers unmatched clicks with 404.
+	DefaultDestinationURL string `json:"default_destination_url,omitempty"`
+
+	// Parameter forwarding policy for campaigns that append params:
+	// campaign allow lists replace ForwardParams, block lists add up
+	ForwardParams []string `json:"forward_params,omitempty"`
+	BlockParams   []string `json:"block_params,omitempty"`
+
+	// Stored event retention and PII handling; RedactParams values are
+	// replaced before events leave the ingress
+	RetentionDays int      `json:"retention_days"`
+	PIIPolicy     string   `json:"pii_policy"`
+	RedactParams  []string `json:"redact_params,omitempty"`
+
+	location *time.Location
+}
+
+// DefaultOrganizationSettings returns the settings used when an organization has none stored
+func DefaultOrganizationSettings() OrganizationSettings {
+	return OrganizationSettings{
+		Timezone:             "UTC",
+		DedupWindowSeconds:   5,
+		DedupKey:             DedupKeyClickID,
+		FraudReviewThreshold: 0.6,
+		FraudBlockThreshold:  0.9,
+		ClickIDParam:         TrellisClickIDParam,
+		RetentionDays:        DefaultRetentionDays,
+		PIIPolicy:            PIIPolicyFull,
+		location:             time.UTC,
+	}
+}
+
+// Location returns the organization's timezone
+func (s *OrganizationSettings) Location() *time.Location {
+	if s.location == nil {
+		return time.UTC
+	}
+	return s.location
+}
+
+// DedupWindow returns the duplicate click window
+func (s *OrganizationSettings) DedupWindow() time.Duration {
+	return time.Duration(s.DedupWindowSeconds) * time.Second
+}
+
+// Validate checks the settings and resolves the timezone
+func (s *OrganizationSettings) Validate() error {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil || s.Timezone == "" {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+
+	switch s.DedupKey {
+	case DedupKeyClickID, DedupKeyIPUA, DedupKeyVisitor:
+	default:
+		return fmt.Errorf("invalid dedup_key %q", s.DedupKey)
+	}
+	if s.DedupWindowSeconds < 0 || s.DedupWindowSeconds > 86400 {
+		return errors.New("dedup_window_seconds must be between 0 and 86400")
+	}
+
+	if s.FraudReviewThreshold < 0 || s.FraudReviewThreshold > 1 ||
+		s.FraudBlockThreshold < 0 || s.FraudBlockThreshold > 1 {
+		return errors.New("fraud thresholds must be between 0 and 1")
+	}
+	if s.FraudReviewThreshold > s.FraudBlockThreshold {
+		return errors.New("fraud_review_threshold must not exceed fraud_block_threshold")
+	}
+	if s.SafePageURL != "" {
+		parsed, err := url.Parse(s.SafePageURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid safe_page_url %q", s.SafePageURL)
+		}
+	}
+
+	for _, m := range s.ClickIDMappings {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.DefaultDestinationURL != "" {
+		if err := validateDestinationTemplate(s.DefaultDestinationURL); err != nil {
+			return fmt.Errorf("default_destination_url: %w", err)
+		}
+	}
+	for _, list := range [][]string{s.ForwardParams, s.BlockParams, s.RedactParams} {
+		for _, name := range list {
+			if strings.TrimSuffix(name, "*") == "" {
+				return fmt.Errorf("invalid parameter pattern %q", name)
+			}
+		}
+	}
+
+	if s.RetentionDays < 1 || s.RetentionDays > MaxRetentionDays {
+		return fmt.Errorf("retention_days must be between 1 and %d", MaxRetentionDays)
+	}
+	switch s.PIIPolicy {
+	case PIIPolicyFull, PIIPolicyTruncateIP, PIIPolicyDropIP:
+	default:
+		return fmt.Errorf("invalid pii_policy %q", s.PIIPolicy)
+	}
+
+	s.location = loc
+	return nil
+}
+
+// OrganizationSettings returns the organization's settings, falling back to defaults
+func (re *RoutingEngine) OrganizationSettings(organizationID string) *OrganizationSettings {
+	re.mu.RLock()
+	defer re.mu.RUnlock()
+	return re.organizationSettingsLocked(organizationID)
+}
+
+// organizationSettingsLocked is OrganizationSettings for callers holding re.mu
+func (re *RoutingEngine) organizationSettingsLocked(organizationID string) *OrganizationSettings {
+	if settings, ok := re.settings[organizationID]; ok {
+		return settings
+	}
+	defaults := re.defaults
+	defaults.OrganizationID = organizationID
+	return &defaults
+}
+
+// loadOrganizationSettings loads per-organization settings from ClickHouse
+func (re *RoutingEngine) loadOrganizationSettings(ctx context.Context) error {
+	query := `
+		SELECT
+			organization_id,
+			timezone,
+			dedup_window_seconds,
+			dedup_key,
+			fraud_review_threshold,
+			fraud_block_threshold,
+			safe_page_url,
+			plan,
+			click_id_mappings,
+			click_id_param,
+			default_destination_url,
+			forward_params,
+			block_params,
+			retention_days,
+			pii_policy,
+			redact_params
+		FROM organization_settings FINAL
+	`
+
+	rows, err := re.clickhouse.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query organization settings: %w", err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]*OrganizationSettings)
+
+	for rows.Next() {
+		s := re.defaults
+		var dedupWindow uint32
+		var retentionDays uint16
+		var mappingsJSON string
+		err := rows.Scan(
+			&s.OrganizationID,
+			&s.Timezone,
+			&dedupWindow,
+			&s.DedupKey,
+			&s.FraudReviewThreshold,
+			&s.FraudBlockThreshold,
+			&s.SafePageURL,
+			&s.Plan,
+			&mappingsJSON,
+			&s.ClickIDParam,
+			&s.DefaultDestinationURL,
+			&s.ForwardParams,
+			&s.BlockParams,
+			&retentionDays,
+			&s.PIIPolicy,
+			&s.RedactParams,
+		)
+		if err != nil {
+			slog.Warn("failed to scan organization settings row", "error", err)
+			continue
+		}
+		s.DedupWindowSeconds = int(dedupWindow)
+		s.RetentionDays = int(retentionDays)
+
+		if mappingsJSON != "" {
+			var mappings []ClickIDMapping
+			if err := json.Unmarshal([]byte(mappingsJSON), &mappings); err != nil {
+				slog.Warn("invalid organization click ID mappings",
+					"organization_id", s.OrganizationID,
+					"error", err)
+			}
+			for _, m := range mappings {
+				if err := m.Validate(); err != nil {
+					slog.Warn("skipping invalid click ID mapping",
+						"organization_id", s.OrganizationID,
+						"error", err)
+					continue
+				}
+				s.ClickIDMappings = append(s.ClickIDMappings, m)
+			}
+		}
+
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			slog.Warn("invalid organization timezone",
+				"organization_id", s.OrganizationID,
+				"timezone", s.Timezone,
+				"error", err)
+			loc = time.UTC
+		}
+		s.location = loc
+
+		if s.DefaultDestinationURL != "" {
+			if err := validateDestinationTemplate(s.DefaultDestinationURL); err != nil {
+				slog.Warn("ignoring invalid default destination",
+					"organization_id", s.OrganizationID,
+					"error", err)
+				s.DefaultDestinationURL = ""
+			}
+		}
+
+		settings[s.OrganizationID] = &s
+	}
+
+	re.mu.Lock()
+	re.settings = settings
+	re.mu.Unlock()
+
+	return nil
+}
+
+// SaveOrganizationSettings validates and stores an organization's settings,
+// replacing the cached copy so they apply immediately on this replica
+func (re *RoutingEngine) SaveOrganizationSettings(ctx context.Context, settings *OrganizationSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	if re.clickhouse != nil {
+		mappingsJSON, err := json.Marshal(settings.ClickIDMappings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal click ID mappings: %w", err)
+		}
+
+		query := `
+			INSERT INTO organization_settings (
+				organization_id, timezone, dedup_window_seconds, dedup_key,
+				fraud_review_threshold, fraud_block_threshold, safe_page_url,
+				plan, click_id_mappings, click_id_param, default_destination_url,
+				forward_params, block_params, retention_days, pii_policy,
+				redact_params
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		err = re.clickhouse.Exec(ctx, query,
+			settings.OrganizationID,
+			settings.Timezone,
+			uint32(settings.DedupWindowSeconds),
+			settings.DedupKey,
+			settings.FraudReviewThreshold,
+			settings.FraudBlockThreshold,
+			settings.SafePageURL,
+			settings.Plan,
+			string(mappingsJSON),
+			settings.ClickIDParam,
+			settings.DefaultDestinationURL,
+			settings.ForwardParams,
+			settings.BlockParams,
+			uint16(settings.RetentionDays),
+			settings.PIIPolicy,
+			settings.RedactParams,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save organization settings: %w", err)
+		}
+	}
+
+	stored := *settings
+	re.mu.Lock()
+	re.settings[settings.OrganizationID] = &stored
+	re.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+// SettingsAPI exposes the organization's ingestion settings
+type SettingsAPI struct {
+	routing *RoutingEngine
+}
+
+// NewSettingsAPI creates the settings API
+func NewSettingsAPI(routing *RoutingEngine) *SettingsAPI {
+	return &SettingsAPI{routing: routing}
+}
+
+// Routes mounts the settings endpoints:
+//
+//	GET /    current settings, defaults included
+//	PUT /    update settings; omitted fields keep their current value
+func (a *SettingsAPI) Routes(r chi.Router) {
+	r.Get("/", a.get)
+	r.Put("/", a.update)
+}
+
+// get returns the organization's settings
+func (a *SettingsAPI) get(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.routing.OrganizationSettings(orgCtx.OrganizationID))
+}
+
+// update merges the request into the current settings and stores them
+func (a *SettingsAPI) update(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	// Decode over a copy whose slices don't share the cached arrays
+	settings := *a.routing.OrganizationSettings(orgCtx.OrganizationID)
+	settings.ClickIDMappings = slices.Clone(settings.ClickIDMappings)
+	settings.ForwardParams = slices.Clone(settings.ForwardParams)
+	settings.BlockParams = slices.Clone(settings.BlockParams)
+	settings.RedactParams = slices.Clone(settings.RedactParams)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&settings); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	settings.OrganizationID = orgCtx.OrganizationID
+
+	if err := settings.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.routing.SaveOrganizationSettings(r.Context(), &settings); err != nil {
+		slog.ErrorContext(r.Context(), "failed to save organization settings", "error", err, "organization_id", orgCtx.OrganizationID)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &settings)
+}
@@ -0,0 +1,188 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoWarehouse is returned by reports when ClickHouse is not configured
+var ErrNoWarehouse = errors.New("clickhouse is not configured")
+
+// ShadowMatch is a shadow campaign that matched a click it did not route
+type ShadowMatch struct {
+	CampaignID     string `json:"campaign_id"`
+	Score          int    `json:"score"`
+	WouldWin       bool   `json:"would_win"`       // it would have routed the click if active
+	DestinationURL string `json:"destination_url"` // where it would have sent the click
+}
+
+// shadowCandidate is a shadow campaign matched during routing
+type shadowCandidate struct {
+	campaign *Campaign
+	score    int
+	explicit bool // named in the URL path
+}
+
+// shadowMatches resolves what the matched shadow campaigns would have done
+// against the actual decision. A shadow campaign named in the URL path
+// would have won outright; otherwise it needs to outscore the live rule
+// match, or just match when the click fell through to the defaults.
+func (re *RoutingEngine) shadowMatches(candidates []shadowCandidate, match *MatchResult, settings *OrganizationSettings, params map[string][]string, attrs Attributes) []ShadowMatch {
+	explicit := candidates[0].explicit
+	beat := 0
+	if match.Reason == MatchReasonRules {
+		beat = match.Score
+	}
+
+	shadows := make([]ShadowMatch, 0, len(candidates))
+	for _, c := range candidates {
+		// The explicit campaign's rules may have matched too; keep one entry
+		if explicit && !c.explicit && c.campaign == candidates[0].campaign {
+			shadows[0].Score = c.score
+			continue
+		}
+		variant := c.campaign.pickVariant(attrs[AttrVisitorID])
+		shadows = append(shadows, ShadowMatch{
+			CampaignID:     c.campaign.CampaignID,
+			Score:          c.score,
+			WouldWin:       c.explicit || (!explicit && c.score > beat),
+			DestinationURL: re.buildDestinationURL(c.campaign, variant, settings, params, attrs),
+		})
+	}
+	return shadows
+}
+
+// ShadowReport compares a shadow campaign's would-be routing with the
+// actual routing of an organization's clicks over a time window
+type ShadowReport struct {
+	CampaignID string          `json:"campaign_id"`
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Clicks     uint64          `json:"clicks"`    // all clicks of the organization
+	Matched    uint64          `json:"matched"`   // clicks the shadow campaign's rules matched
+	WouldWin   uint64          `json:"would_win"` // clicks it would have routed
+	Displaced  []ShadowRouting `json:"displaced"` // actual routing of the clicks it would have routed
+	Samples    []ShadowSample  `json:"samples"`
+}
+
+// ShadowRouting is a group of clicks by their actual routing
+type ShadowRouting struct {
+	CampaignID string `json:"campaign_id"` // empty for fallback routing
+	Reason     string `json:"reason"`
+	Clicks     uint64 `json:"clicks"`
+}
+
+// ShadowSample is a click the shadow campaign matched
+type ShadowSample struct {
+	EventID           string    `json:"event_id"`
+	EventTime         time.Time `json:"event_time"`
+	Reason            string    `json:"reason"`
+	CampaignID        string    `json:"campaign_id"`
+	DestinationURL    string    `json:"destination_url"`
+	ShadowDestination string    `json:"shadow_destination_url"`
+	ShadowScore       int32     `json:"shadow_score"`
+	ShadowWouldWin    bool      `json:"shadow_would_win"`
+}
+
+// ShadowReport builds the comparison for a shadow campaign from the events table
+func (re *RoutingEngine) ShadowReport(ctx context.Context, organizationID, campaignID string, from, to time.Time, samples int) (*ShadowReport, error) {
+	if re.clickhouse == nil {
+		return nil, ErrNoWarehouse
+	}
+
+	report := &ShadowReport{
+		CampaignID: campaignID,
+		From:       from,
+		To:         to,
+		Displaced:  []ShadowRouting{},
+		Samples:    []ShadowSample{},
+	}
+
+	const where = `
+		FROM events
+		WHERE organization_id = ?
+		  AND event_type = 'click'
+		  AND event_time >= ? AND event_time < ?
+	`
+	// Position of the campaign in the click's shadow matches, 0 if absent
+	const shadowIndex = `indexOf(shadow_matches.campaign_id, ?)`
+	const wouldWin = `(` + shadowIndex + ` > 0 AND shadow_matches.would_win[` + shadowIndex + `] = 1)`
+
+	totals := `
+		SELECT
+			count(),
+			countIf(` + shadowIndex + ` > 0),
+			countIf(` + wouldWin + `)
+	` + where
+	err := re.clickhouse.QueryRow(ctx, totals, campaignID, campaignID, campaignID, organizationID, from, to).
+		Scan(&report.Clicks, &report.Matched, &report.WouldWin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shadow totals: %w", err)
+	}
+
+	displaced := `
+		SELECT routed_campaign_id, routing_reason, count() AS clicks
+	` + where + `
+		  AND ` + wouldWin + `
+		GROUP BY routed_campaign_id, routing_reason
+		ORDER BY clicks DESC
+	`
+	rows, err := re.clickhouse.Query(ctx, displaced, organizationID, from, to, campaignID, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query displaced routing: %w", err)
+	}
+	for rows.Next() {
+		var r ShadowRouting
+		if err := rows.Scan(&r.CampaignID, &r.Reason, &r.Clicks); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan displaced routing: %w", err)
+		}
+		report.Displaced = append(report.Displaced, r)
+	}
+	rows.Close()
+
+	sampled := `
+		SELECT
+			toString(event_id),
+			event_time,
+			routing_reason,
+			routed_campaign_id,
+			destination_url,
+			shadow_matches.destination_url[` + shadowIndex + `],
+			shadow_matches.score[` + shadowIndex + `],
+			shadow_matches.would_win[` + shadowIndex + `]
+	` + where + `
+		  AND ` + shadowIndex + ` > 0
+		ORDER BY event_time DESC
+		LIMIT ?
+	`
+	rows, err = re.clickhouse.Query(ctx, sampled,
+		campaignID, campaignID, campaignID, organizationID, from, to, campaignID, samples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shadow samples: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s ShadowSample
+		var wouldWin uint8
+		err := rows.Scan(
+			&s.EventID,
+			&s.EventTime,
+			&s.Reason,
+			&s.CampaignID,
+			&s.DestinationURL,
+			&s.ShadowDestination,
+			&s.ShadowScore,
+			&wouldWin,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan shadow sample: %w", err)
+		}
+		s.ShadowWouldWin = wouldWin == 1
+		report.Samples = append(report.Samples, s)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,100 @@
+package ingestion
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// macroParamPrefix references a click query parameter in a template, e.g. {param.gclid}
+const macroParamPrefix = "param."
+
+// expandMacros replaces {name} placeholders in tmpl with their escaped
+// values. {name|default} uses default when the value is empty. Placeholders
+// value doesn't know, and braces that don't enclose a macro name (such as
+// JSON objects), are left as they are.
+func expandMacros(tmpl string, value func(name string) (string, bool), escape func(string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			break
+		}
+		name, fallback, end, ok := parseMacro(tmpl[start:])
+
+		b.WriteString(tmpl[:start])
+		if !ok {
+			b.WriteByte('{')
+			tmpl = tmpl[start+1:]
+			continue
+		}
+		if v, known := value(name); known {
+			if v == "" {
+				v = fallback
+			}
+			b.WriteString(escape(v))
+		} else {
+			b.WriteString(tmpl[start : start+end])
+		}
+		tmpl = tmpl[start+end:]
+	}
+	b.WriteString(tmpl)
+	return b.String()
+}
+
+// parseMacro parses a placeholder at the start of s, returning its name,
+// default and length
+func parseMacro(s string) (name, fallback string, length int, ok bool) {
+	end := 1
+	for end < len(s) && isMacroChar(s[end]) {
+		end++
+	}
+	if end == 1 || end == len(s) {
+		return "", "", 0, false
+	}
+	name = s[1:end]
+
+	if s[end] == '|' {
+		close := strings.IndexAny(s[end:], "{}")
+		if close < 0 || s[end+close] != '}' {
+			return "", "", 0, false
+		}
+		fallback = s[end+1 : end+close]
+		end += close
+	}
+	if s[end] != '}' {
+		return "", "", 0, false
+	}
+	return name, fallback, end + 1, true
+}
+
+// isMacroChar reports whether c may appear in a macro name
+func isMacroChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-'
+}
+
+// templateMacros returns the placeholder names used in tmpl
+func templateMacros(tmpl string) []string {
+	var names []string
+	expandMacros(tmpl, func(name string) (string, bool) {
+		names = append(names, name)
+		return "", false
+	}, func(s string) string { return s })
+	return names
+}
+
+// escapeQuery escapes a value for a URL query string
+func escapeQuery(s string) string {
+	return url.QueryEscape(s)
+}
+
+// escapeJSON escapes a value for use inside a JSON string literal
+func escapeJSON(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+// escapeNone leaves a value as it is
+func escapeNone(s string) string {
+	return s
+}
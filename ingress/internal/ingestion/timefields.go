@@ -0,0 +1,52 @@
+package ingestion
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Virtual rule fields derived from the request time in the organization's
+// timezone. They are namespaced so bare names stay query parameters.
+const (
+	FieldHourOfDay = "time.hour_of_day" // 0-23
+	FieldDayOfWeek = "time.day_of_week" // monday, tuesday, ...; between compares in week order
+	FieldDate      = "time.date"        // 2006-01-02
+	FieldTimeOfDay = "time.time_of_day" // 15:04
+)
+
+// timeFieldValue resolves a virtual time field for the given local time
+func timeFieldValue(field string, now time.Time) (string, bool) {
+	switch field {
+	case FieldHourOfDay:
+		return strconv.Itoa(now.Hour()), true
+	case FieldDayOfWeek:
+		return strings.ToLower(now.Weekday().String()), true
+	case FieldDate:
+		return now.Format("2006-01-02"), true
+	case FieldTimeOfDay:
+		return now.Format("15:04"), true
+	}
+	return "", false
+}
+
+// isLiveAt reports whether the campaign is active and inside its schedule
+func (c *Campaign) isLiveAt(now time.Time) bool {
+	return c.Status == CampaignStatusActive && c.inScheduleAt(now)
+}
+
+// isShadowAt reports whether the campaign is in shadow mode and inside its schedule
+func (c *Campaign) isShadowAt(now time.Time) bool {
+	return c.Status == CampaignStatusShadow && c.inScheduleAt(now)
+}
+
+// inScheduleAt reports whether now falls between the campaign's start and end
+func (c *Campaign) inScheduleAt(now time.Time) bool {
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return false
+	}
+	if c.EndsAt != nil && !now.Before(*c.EndsAt) {
+		return false
+	}
+	return true
+}
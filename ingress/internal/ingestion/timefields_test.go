@@ -0,0 +1,49 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRuleValueTimeFields(t *testing.T) {
+	now := time.Date(2024, 3, 14, 9, 26, 0, 0, time.UTC) // a Thursday
+	attrs := Attributes{
+		AttrParamPrefix + "date": "2024-01-01",
+		AttrParamPrefix + "hour": "5",
+	}
+
+	tests := []struct {
+		field string
+		want  string
+		found bool
+	}{
+		{"time.hour_of_day", "9", true},
+		{"time.day_of_week", "thursday", true},
+		{"time.date", "2024-03-14", true},
+		{"time.time_of_day", "09:26", true},
+		{"date", "2024-01-01", true}, // bare names are query parameters
+		{"hour", "5", true},
+		{"hour_of_day", "", false},
+		{"day_of_week", "", false},
+	}
+
+	for _, tt := range tests {
+		got, found := ruleValue(tt.field, attrs, now)
+		if got != tt.want || found != tt.found {
+			t.Errorf("ruleValue(%q) = %q, %t, want %q, %t", tt.field, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestEventColumnsTimeFields(t *testing.T) {
+	columns := EventColumns("UTC")
+	for _, field := range []string{"date", "hour", "hour_of_day"} {
+		column, ok := columns(field)
+		if !ok || column.Value.SQL != "JSONExtractString(raw_params, ?, 1)" {
+			t.Errorf("EventColumns(%q) = %q, want a query parameter", field, column.Value.SQL)
+		}
+	}
+	if column, ok := columns(FieldHourOfDay); !ok || column.Value.SQL != "toString(toHour(toTimeZone(event_time, ?)))" {
+		t.Errorf("EventColumns(%q) = %q, want the event hour", FieldHourOfDay, column.Value.SQL)
+	}
+}
@@ -0,0 +1,156 @@
+package ipintel
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+// API exposes organization allow and deny list management over HTTP
+type API struct {
+	intel *Intel
+}
+
+// NewAPI creates the IP list API
+func NewAPI(intel *Intel) *API {
+	return &API{intel: intel}
+}
+
+// Routes mounts the IP list endpoints:
+//
+//	GET    /                 list entries (optionally ?kind=allow|deny)
+//	POST   /                 add an entry {"kind","cidr","note"}
+//	DELETE /{kind}?cidr=...  remove an entry
+//	GET    /lookup?ip=...    show which lists an address matches
+func (a *API) Routes(r chi.Router) {
+	r.Get("/", a.list)
+	r.Post("/", a.add)
+	r.Delete("/{kind}", a.remove)
+	r.Get("/lookup", a.lookup)
+}
+
+// list returns the organization's entries
+func (a *API) list(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	entries := []Entry{}
+	for _, entry := range a.intel.Entries(orgCtx.OrganizationID) {
+		if kind == "" || entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+// add adds an entry to the organization's allow or deny list
+func (a *API) add(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	var entry Entry
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&entry); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	entry.OrganizationID = orgCtx.OrganizationID
+	entry.CreatedBy = orgCtx.AccountID
+
+	if entry.Kind != KindAllow && entry.Kind != KindDeny {
+		http.Error(w, "kind must be allow or deny", http.StatusBadRequest)
+		return
+	}
+	if _, err := ParsePrefix(entry.CIDR); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := a.intel.AddEntry(r.Context(), entry)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "IP lists are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to add IP list entry", "error", err, "organization_id", orgCtx.OrganizationID)
+		http.Error(w, "Failed to add entry", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// remove deletes an entry from the organization's allow or deny list
+func (a *API) remove(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	kind := chi.URLParam(r, "kind")
+	if kind != KindAllow && kind != KindDeny {
+		http.Error(w, "kind must be allow or deny", http.StatusBadRequest)
+		return
+	}
+	cidr := r.URL.Query().Get("cidr")
+	if _, err := ParsePrefix(cidr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.intel.RemoveEntry(r.Context(), orgCtx.OrganizationID, kind, cidr)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "IP lists are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to remove IP list entry", "error", err, "organization_id", orgCtx.OrganizationID)
+		http.Error(w, "Failed to remove entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookup reports the lists an address matches for the organization
+func (a *API) lookup(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	ip, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+	if err != nil {
+		http.Error(w, "Invalid ip", http.StatusBadRequest)
+		return
+	}
+
+	lists := a.intel.Lookup(orgCtx.OrganizationID, ip)
+	if lists == nil {
+		lists = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ip": ip, "lists": lists})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package ipintel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+func TestAPIWithoutWarehouse(t *testing.T) {
+	intel, err := NewIntel(nil, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("NewIntel() error = %v", err)
+	}
+	router := chi.NewRouter()
+	NewAPI(intel).Routes(router)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"add", "POST", "/", `{"kind":"deny","cidr":"203.0.113.0/24"}`, http.StatusServiceUnavailable},
+		{"remove", "DELETE", "/deny?cidr=203.0.113.0/24", "", http.StatusServiceUnavailable},
+		{"add invalid", "POST", "/", `{"kind":"deny","cidr":"nonsense"}`, http.StatusBadRequest},
+		{"list", "GET", "/", "", http.StatusOK},
+		{"lookup", "GET", "/lookup?ip=203.0.113.7", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), auth.OrganizationContextKey, &auth.OrganizationContext{OrganizationID: "org"}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.target, w.Code, tt.want)
+			}
+		})
+	}
+
+	if entries := intel.Entries("org"); len(entries) != 0 {
+		t.Errorf("Entries() = %v, want none", entries)
+	}
+}
@@ -0,0 +1,379 @@
+package ipintel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// ErrNoWarehouse is returned by list changes when ClickHouse is not configured
+var ErrNoWarehouse = errors.New("clickhouse is not configured")
+
+// Per-organization list kinds, reported by Lookup alongside global list names
+const (
+	ListOrgAllow = "org_allow" // organization trusts the address
+	ListOrgDeny  = "org_deny"  // organization blocks the address
+)
+
+// Entry kinds stored for organizations
+const (
+	KindAllow = "allow"
+	KindDeny  = "deny"
+)
+
+// Entry is a single CIDR on an organization's allow or deny list
+type Entry struct {
+	OrganizationID string    `json:"organization_id"`
+	Kind           string    `json:"kind"` // allow or deny
+	CIDR           string    `json:"cidr"`
+	Note           string    `json:"note,omitempty"`
+	CreatedBy      string    `json:"created_by,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// orgLists holds an organization's entries and their compiled tree
+type orgLists struct {
+	entries []Entry
+	tree    *Tree
+}
+
+// Intel answers which IP lists an address belongs to. Global lists
+// (datacenter ranges, Tor exits, ...) are loaded from files; allow and
+// deny lists per organization are stored in ClickHouse.
+type Intel struct {
+	clickhouse clickhouse.Conn
+	sources    map[string]string // list name -> file path
+	global     atomic.Pointer[Tree]
+
+	mu   sync.RWMutex
+	orgs map[string]*orgLists // org_id -> lists
+}
+
+// NewIntel creates an IP intelligence service. Global list files must load;
+// organization lists are loaded best effort and refreshed in the background.
+func NewIntel(ch clickhouse.Conn, sources map[string]string, fileRefresh time.Duration) (*Intel, error) {
+	in := &Intel{
+		clickhouse: ch,
+		sources:    sources,
+		orgs:       make(map[string]*orgLists),
+	}
+	in.global.Store(NewTree())
+
+	if err := in.LoadFiles(); err != nil {
+		return nil, err
+	}
+
+	if ch != nil {
+		if err := in.loadOrganizationLists(context.Background()); err != nil {
+			slog.Warn("failed to load organization IP lists", "error", err)
+		}
+	}
+
+	go in.refresh(fileRefresh)
+
+	return in, nil
+}
+
+// Lookup returns the lists containing ip for an organization. Global list
+// names are returned as configured; organization matches are reported as
+// ListOrgAllow and ListOrgDeny. The zero Addr matches nothing.
+func (in *Intel) Lookup(organizationID string, addr netip.Addr) []string {
+	if !addr.IsValid() {
+		return nil
+	}
+
+	lists := in.global.Load().Lookup(addr)
+
+	in.mu.RLock()
+	org := in.orgs[organizationID]
+	in.mu.RUnlock()
+	if org != nil {
+		lists = appendUnique(lists, org.tree.Lookup(addr))
+	}
+
+	return lists
+}
+
+// LoadFiles reloads all global list files and swaps them in atomically
+func (in *Intel) LoadFiles() error {
+	tree := NewTree()
+	for name, path := range in.sources {
+		if err := loadListFile(tree, name, path); err != nil {
+			return err
+		}
+	}
+	in.global.Store(tree)
+
+	slog.Info("loaded IP lists", "lists", len(in.sources), "prefixes", tree.Len())
+	return nil
+}
+
+// loadListFile inserts every prefix in a list file into tree. Each
+// non-comment line holds a CIDR or a single address; text after the first
+// whitespace or "#" is ignored.
+func loadListFile(tree *Tree, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open IP list %s: %w", name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		prefix, err := ParsePrefix(fields[0])
+		if err != nil {
+			return fmt.Errorf("IP list %s line %d: %w", name, lineNo, err)
+		}
+		tree.Insert(prefix, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read IP list %s: %w", name, err)
+	}
+	return nil
+}
+
+// ParsePrefix parses a CIDR or a single address as a host prefix.
+// IPv4-mapped IPv6 prefixes are normalized to IPv4.
+func ParsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q: %w", value, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Entries returns an organization's allow and deny list entries
+func (in *Intel) Entries(organizationID string) []Entry {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	org := in.orgs[organizationID]
+	if org == nil {
+		return nil
+	}
+	return append([]Entry(nil), org.entries...)
+}
+
+// AddEntry adds or updates a CIDR on an organization's list
+func (in *Intel) AddEntry(ctx context.Context, entry Entry) (Entry, error) {
+	if entry.Kind != KindAllow && entry.Kind != KindDeny {
+		return Entry{}, fmt.Errorf("invalid list kind %q", entry.Kind)
+	}
+	prefix, err := ParsePrefix(entry.CIDR)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.CIDR = prefix.String()
+	entry.UpdatedAt = time.Now().UTC()
+
+	if in.clickhouse == nil {
+		return Entry{}, ErrNoWarehouse
+	}
+
+	query := `
+		INSERT INTO ip_lists (
+			organization_id, kind, cidr, note, created_by, is_deleted, updated_at
+		) VALUES (?, ?, ?, ?, ?, 0, ?)
+	`
+
+	err = in.clickhouse.Exec(ctx, query,
+		entry.OrganizationID,
+		entry.Kind,
+		entry.CIDR,
+		entry.Note,
+		entry.CreatedBy,
+		entry.UpdatedAt,
+	)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to add IP list entry: %w", err)
+	}
+
+	// Update local lists
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var entries []Entry
+	if org := in.orgs[entry.OrganizationID]; org != nil {
+		for _, existing := range org.entries {
+			if existing.Kind != entry.Kind || existing.CIDR != entry.CIDR {
+				entries = append(entries, existing)
+			}
+		}
+	}
+	in.orgs[entry.OrganizationID] = compileOrgLists(append(entries, entry))
+
+	return entry, nil
+}
+
+// RemoveEntry removes a CIDR from an organization's list
+func (in *Intel) RemoveEntry(ctx context.Context, organizationID, kind, cidr string) error {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	cidr = prefix.String()
+
+	if in.clickhouse == nil {
+		return ErrNoWarehouse
+	}
+
+	query := `
+		INSERT INTO ip_lists (
+			organization_id, kind, cidr, is_deleted, updated_at
+		) VALUES (?, ?, ?, 1, ?)
+	`
+
+	err = in.clickhouse.Exec(ctx, query, organizationID, kind, cidr, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to remove IP list entry: %w", err)
+	}
+
+	// Update local lists
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if org := in.orgs[organizationID]; org != nil {
+		var entries []Entry
+		for _, existing := range org.entries {
+			if existing.Kind != kind || existing.CIDR != cidr {
+				entries = append(entries, existing)
+			}
+		}
+		in.orgs[organizationID] = compileOrgLists(entries)
+	}
+
+	return nil
+}
+
+// loadOrganizationLists loads all organization allow and deny lists from ClickHouse
+func (in *Intel) loadOrganizationLists(ctx context.Context) error {
+	query := `
+		SELECT
+			organization_id,
+			kind,
+			cidr,
+			note,
+			created_by,
+			updated_at
+		FROM ip_lists FINAL
+		WHERE is_deleted = 0
+		ORDER BY organization_id, kind, cidr
+	`
+
+	rows, err := in.clickhouse.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query IP lists: %w", err)
+	}
+	defer rows.Close()
+
+	byOrg := make(map[string][]Entry)
+	count := 0
+
+	for rows.Next() {
+		var entry Entry
+		err := rows.Scan(
+			&entry.OrganizationID,
+			&entry.Kind,
+			&entry.CIDR,
+			&entry.Note,
+			&entry.CreatedBy,
+			&entry.UpdatedAt,
+		)
+		if err != nil {
+			slog.Warn("failed to scan IP list row", "error", err)
+			continue
+		}
+		byOrg[entry.OrganizationID] = append(byOrg[entry.OrganizationID], entry)
+		count++
+	}
+
+	orgs := make(map[string]*orgLists, len(byOrg))
+	for organizationID, entries := range byOrg {
+		orgs[organizationID] = compileOrgLists(entries)
+	}
+
+	// Update lists atomically
+	in.mu.Lock()
+	in.orgs = orgs
+	in.mu.Unlock()
+
+	slog.Info("loaded organization IP lists", "organizations", len(orgs), "entries", count)
+	return nil
+}
+
+// compileOrgLists builds the lookup tree for an organization's entries
+func compileOrgLists(entries []Entry) *orgLists {
+	tree := NewTree()
+	for _, entry := range entries {
+		prefix, err := ParsePrefix(entry.CIDR)
+		if err != nil {
+			slog.Warn("skipping invalid IP list entry",
+				"organization_id", entry.OrganizationID,
+				"cidr", entry.CIDR,
+				"error", err)
+			continue
+		}
+		list := ListOrgDeny
+		if entry.Kind == KindAllow {
+			list = ListOrgAllow
+		}
+		tree.Insert(prefix, list)
+	}
+	return &orgLists{entries: entries, tree: tree}
+}
+
+// refresh periodically reloads organization lists and global list files
+func (in *Intel) refresh(fileRefresh time.Duration) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	lastFileLoad := time.Now()
+	for range ticker.C {
+		if in.clickhouse != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := in.loadOrganizationLists(ctx); err != nil {
+				slog.Error("failed to refresh organization IP lists", "error", err)
+			}
+			cancel()
+		}
+
+		if fileRefresh > 0 && time.Since(lastFileLoad) >= fileRefresh {
+			if err := in.LoadFiles(); err != nil {
+				slog.Error("failed to refresh IP lists", "error", err)
+			}
+			lastFileLoad = time.Now()
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package ipintel
+
+import (
+	"net/netip"
+)
+
+// Tree is a binary radix tree mapping IP prefixes to list names.
+// IPv4 and IPv6 prefixes live in separate roots; IPv4-mapped IPv6
+// addresses are looked up as IPv4. A Tree is not safe for concurrent
+// writes, but is safe for concurrent lookups once built.
+type Tree struct {
+	v4  *node
+	v6  *node
+	len int
+}
+
+// node is a single bit position in the tree
+type node struct {
+	children [2]*node
+	lists    []string // lists whose prefix ends at this node
+}
+
+// NewTree creates an empty tree
+func NewTree() *Tree {
+	return &Tree{v4: &node{}, v6: &node{}}
+}
+
+// Insert adds prefix to the tree under list
+func (t *Tree) Insert(prefix netip.Prefix, list string) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits -= 96
+	}
+
+	n := t.root(addr)
+	raw := addr.AsSlice()
+	for i := 0; i < bits; i++ {
+		bit := bitAt(raw, i)
+		if n.children[bit] == nil {
+			n.children[bit] = &node{}
+		}
+		n = n.children[bit]
+	}
+
+	for _, existing := range n.lists {
+		if existing == list {
+			return
+		}
+	}
+	n.lists = append(n.lists, list)
+	t.len++
+}
+
+// Lookup returns every list with a prefix containing addr
+func (t *Tree) Lookup(addr netip.Addr) []string {
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return nil
+	}
+
+	var lists []string
+	n := t.root(addr)
+	raw := addr.AsSlice()
+	for i := 0; n != nil; i++ {
+		lists = appendUnique(lists, n.lists)
+		if i == len(raw)*8 {
+			break
+		}
+		n = n.children[bitAt(raw, i)]
+	}
+	return lists
+}
+
+// Len returns the number of prefixes in the tree
+func (t *Tree) Len() int {
+	return t.len
+}
+
+// root returns the root for the address family
+func (t *Tree) root(addr netip.Addr) *node {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// bitAt returns bit i (0 = most significant) of raw
+func bitAt(raw []byte, i int) int {
+	return int(raw[i/8]>>(7-uint(i%8))) & 1
+}
+
+// appendUnique appends values not already in dst
+func appendUnique(dst, values []string) []string {
+	for _, v := range values {
+		found := false
+		for _, d := range dst {
+			if d == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
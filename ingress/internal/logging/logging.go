@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// level is the default logger's level, changeable at runtime
+var level = new(slog.LevelVar)
+
+// Config configures the default logger
+type Config struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+
+	// Per message and second, the first SampleInitial info and debug
+	// records are logged and then every SampleThereafter-th one. Warnings
+	// and errors are never sampled; SampleInitial <= 0 disables sampling.
+	SampleInitial    int
+	SampleThereafter int
+}
+
+// Setup installs the default slog logger writing to w
+func Setup(w io.Writer, cfg Config) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch cfg.Format {
+	case FormatJSON, "":
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	handler = &contextHandler{Handler: handler}
+	if cfg.SampleInitial > 0 {
+		handler = &samplingHandler{
+			Handler: handler,
+			sampler: &sampler{
+				initial:    cfg.SampleInitial,
+				thereafter: cfg.SampleThereafter,
+				counts:     make(map[string]int),
+			},
+		}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetLevel changes the default logger's level
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// ParseLevel parses a log level name
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+type contextKey struct{}
+
+// With returns a context whose log records carry the given attributes, as
+// key-value pairs like slog.Logger.With. They are added by the default
+// logger to records logged with a context, e.g. slog.WarnContext(ctx, ...).
+func With(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	attrs := make([]slog.Attr, len(existing), len(existing)+len(args)/2)
+	copy(attrs, existing)
+
+	record := slog.Record{}
+	record.Add(args...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// FromContext returns the default logger with the context's attributes
+func FromContext(ctx context.Context) *slog.Logger {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	if len(attrs) == 0 {
+		return slog.Default()
+	}
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	return slog.Default().With(args...)
+}
+
+// contextHandler adds the context's attributes and trace ID to records
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// samplingHandler drops repeated info and debug records
+type samplingHandler struct {
+	slog.Handler
+	sampler *sampler
+}
+
+// Handle implements slog.Handler
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && !h.sampler.allow(r.Message, r.Time) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup implements slog.Handler
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), sampler: h.sampler}
+}
+
+// sampler counts records per message within one-second windows
+type sampler struct {
+	initial    int
+	thereafter int
+
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+}
+
+// allow reports whether a record with the message should be logged
+func (s *sampler) allow(message string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.Sub(s.window) >= time.Second {
+		s.window = at.Truncate(time.Second)
+		clear(s.counts)
+	}
+	s.counts[message]++
+	n := s.counts[message]
+
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,270 @@
+package partners
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+// API exposes postback partner management over HTTP
+type API struct {
+	registry *Registry
+	baseURL  string
+}
+
+// NewAPI creates the partner API; baseURL is the public ingress URL used in postback templates
+func NewAPI(registry *Registry, baseURL string) *API {
+	return &API{
+		registry: registry,
+		baseURL:  baseURL,
+	}
+}
+
+// partnerRequest is the editable part of a partner
+type partnerRequest struct {
+	Name       string            `json:"name"`
+	Status     string            `json:"status"`
+	AuthMode   string            `json:"auth_mode"`
+	AllowedIPs []string          `json:"allowed_ips"`
+	Macros     map[string]string `json:"macros"`
+}
+
+// Routes mounts the partner endpoints:
+//
+//	GET    /                             list partners
+//	POST   /                             create a partner (returns its secret)
+//	GET    /{partner_id}                 get a partner
+//	PUT    /{partner_id}                 update a partner
+//	DELETE /{partner_id}                 delete a partner
+//	POST   /{partner_id}/rotate-secret   issue a new secret
+//	GET    /{partner_id}/postback-url    postback URL template for the partner's network
+func (a *API) Routes(r chi.Router) {
+	r.Get("/", a.list)
+	r.Post("/", a.create)
+	r.Get("/{partner_id}", a.get)
+	r.Put("/{partner_id}", a.update)
+	r.Delete("/{partner_id}", a.remove)
+	r.Post("/{partner_id}/rotate-secret", a.rotateSecret)
+	r.Get("/{partner_id}/postback-url", a.postbackURL)
+}
+
+// list returns the organization's partners without their secrets
+func (a *API) list(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	partners := []*Partner{}
+	for _, partner := range a.registry.List(orgCtx.OrganizationID) {
+		partners = append(partners, redacted(partner))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"partners": partners})
+}
+
+// create adds a partner and returns it with its secret
+func (a *API) create(w http.ResponseWriter, r *http.Request) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return
+	}
+
+	var req partnerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	partner := &Partner{
+		OrganizationID: orgCtx.OrganizationID,
+		Name:           req.Name,
+		Status:         StatusActive,
+		AuthMode:       req.AuthMode,
+		AllowedIPs:     req.AllowedIPs,
+		Macros:         req.Macros,
+	}
+	if err := partner.compile(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.registry.Create(r.Context(), partner)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Partners are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to create partner", "error", err, "organization_id", orgCtx.OrganizationID)
+		http.Error(w, "Failed to create partner", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, partner)
+}
+
+// get returns a partner without its secret
+func (a *API) get(w http.ResponseWriter, r *http.Request) {
+	partner, ok := a.partner(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, redacted(partner))
+}
+
+// update replaces a partner's settings, keeping its secret
+func (a *API) update(w http.ResponseWriter, r *http.Request) {
+	existing, ok := a.partner(w, r)
+	if !ok {
+		return
+	}
+
+	var req partnerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = existing.Status
+	}
+	if req.Status == StatusDeleted {
+		http.Error(w, "Use DELETE to remove a partner", http.StatusBadRequest)
+		return
+	}
+
+	partner := &Partner{
+		OrganizationID: existing.OrganizationID,
+		PartnerID:      existing.PartnerID,
+		Name:           req.Name,
+		Status:         req.Status,
+		AuthMode:       req.AuthMode,
+		AllowedIPs:     req.AllowedIPs,
+		Macros:         req.Macros,
+	}
+	if err := partner.compile(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.registry.Update(r.Context(), partner)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Partners are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to update partner", "error", err, "partner_id", partner.PartnerID)
+		http.Error(w, "Failed to update partner", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, redacted(partner))
+}
+
+// remove deletes a partner; its postbacks are rejected from then on
+func (a *API) remove(w http.ResponseWriter, r *http.Request) {
+	partner, ok := a.partner(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.registry.Delete(r.Context(), partner.OrganizationID, partner.PartnerID)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Partners are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to delete partner", "error", err, "partner_id", partner.PartnerID)
+		http.Error(w, "Failed to delete partner", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rotateSecret issues a new secret, invalidating the old one immediately
+func (a *API) rotateSecret(w http.ResponseWriter, r *http.Request) {
+	existing, ok := a.partner(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	partner := *existing
+	partner.Secret = secret
+
+	err = a.registry.Update(r.Context(), &partner)
+	if errors.Is(err, ErrNoWarehouse) {
+		http.Error(w, "Partners are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to rotate partner secret", "error", err, "partner_id", partner.PartnerID)
+		http.Error(w, "Failed to rotate secret", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &partner)
+}
+
+// postbackURL returns the URL template and signing details for a partner
+func (a *API) postbackURL(w http.ResponseWriter, r *http.Request) {
+	partner, ok := a.partner(w, r)
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"partner_id": partner.PartnerID,
+		"auth_mode":  partner.AuthMode,
+		"url":        PostbackURL(a.baseURL, partner),
+	}
+	if partner.AuthMode == AuthHMAC {
+		response["signature_header"] = SignatureHeader
+		response["timestamp_header"] = TimestampHeader
+		response["signature"] = "hex(HMAC-SHA256(secret, timestamp + \".\" + raw_query + \".\" + body))"
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// partner loads the URL's partner, checking it belongs to the organization
+func (a *API) partner(w http.ResponseWriter, r *http.Request) (*Partner, bool) {
+	orgCtx, ok := auth.GetOrganizationContext(r.Context())
+	if !ok {
+		http.Error(w, "Organization context not found", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	partner, ok := a.registry.Get(chi.URLParam(r, "partner_id"))
+	if !ok || partner.OrganizationID != orgCtx.OrganizationID {
+		http.Error(w, "Partner not found", http.StatusNotFound)
+		return nil, false
+	}
+	return partner, true
+}
+
+// redacted returns a copy of a partner without its secret
+func redacted(partner *Partner) *Partner {
+	copied := *partner
+	copied.Secret = ""
+	return &copied
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write response", "error", err)
+	}
+}
@@ -0,0 +1,55 @@
+package partners
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+func TestAPIWithoutWarehouse(t *testing.T) {
+	registry := NewRegistry(nil)
+	existing := &Partner{OrganizationID: "org", PartnerID: "p1", Name: "network", Status: StatusActive, Secret: "secret"}
+	if err := existing.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	registry.partners[existing.PartnerID] = existing
+
+	router := chi.NewRouter()
+	NewAPI(registry, "https://ingress.example").Routes(router)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"create", "POST", "/", `{"name":"network"}`, http.StatusServiceUnavailable},
+		{"update", "PUT", "/p1", `{"name":"renamed","status":"active"}`, http.StatusServiceUnavailable},
+		{"rotate secret", "POST", "/p1/rotate-secret", "", http.StatusServiceUnavailable},
+		{"delete", "DELETE", "/p1", "", http.StatusServiceUnavailable},
+		{"create invalid", "POST", "/", `{"name":""}`, http.StatusBadRequest},
+		{"get", "GET", "/p1", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), auth.OrganizationContextKey, &auth.OrganizationContext{OrganizationID: "org"}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.target, w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if partner, ok := registry.Get("p1"); !ok || partner.Name != "network" || partner.Secret != "secret" {
+		t.Errorf("Get() = %+v, %t, want the partner unchanged", partner, ok)
+	}
+}
@@ -0,0 +1,182 @@
+package partners
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+)
+
+// Partner credential parameters and headers
+const (
+	TokenParam      = "token"
+	TokenHeader     = "X-Trellis-Token"
+	SignatureHeader = "X-Trellis-Signature"
+	TimestampHeader = "X-Trellis-Timestamp"
+)
+
+// maxSignedBody caps the body of signed postbacks; larger ones are rejected
+const maxSignedBody = 64 * 1024
+
+// errBodyTooLarge is returned for signed bodies over maxSignedBody
+var errBodyTooLarge = errors.New("request body too large")
+
+// contextKey stores the authenticated partner in the request context
+type contextKey struct{}
+
+// Authenticator verifies partner credentials on postback requests
+type Authenticator struct {
+	registry *Registry
+	maxSkew  time.Duration
+}
+
+// NewAuthenticator creates an authenticator accepting signatures up to maxSkew old
+func NewAuthenticator(registry *Registry, maxSkew time.Duration) *Authenticator {
+	return &Authenticator{
+		registry: registry,
+		maxSkew:  maxSkew,
+	}
+}
+
+// Middleware authenticates the partner named by the partner_id URL parameter
+// in place of an organization API key. The source IP must be on the
+// partner's allowlist (if it has one), and the request must carry the
+// partner's token or a valid signature. On success the partner's
+// organization context is set for the rest of the chain.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		partnerID := chi.URLParam(r, "partner_id")
+		partner, ok := a.registry.Get(partnerID)
+		if !ok || partner.Status != StatusActive {
+			http.Error(w, "Invalid partner credentials", http.StatusUnauthorized)
+			return
+		}
+
+		addr, ok := clientip.FromContext(r.Context())
+		if !ok {
+			addr, _ = clientip.ParseHost(r.RemoteAddr)
+		}
+		if !partner.AllowsIP(addr) {
+			slog.Warn("postback from disallowed address",
+				"partner_id", partner.PartnerID,
+				"organization_id", partner.OrganizationID,
+				"ip", addr.String())
+			http.Error(w, "Source address not allowed", http.StatusForbidden)
+			return
+		}
+
+		var valid bool
+		switch partner.AuthMode {
+		case AuthHMAC:
+			body, err := readSignedBody(r)
+			if errors.Is(err, errBodyTooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			valid = err == nil && a.verifySignature(r, partner, body)
+		default:
+			valid = verifyToken(r, partner)
+		}
+		if !valid {
+			slog.Warn("postback with invalid partner credentials",
+				"partner_id", partner.PartnerID,
+				"organization_id", partner.OrganizationID)
+			http.Error(w, "Invalid partner credentials", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), auth.OrganizationContextKey, &auth.OrganizationContext{
+			OrganizationID: partner.OrganizationID,
+		})
+		ctx = context.WithValue(ctx, contextKey{}, partner)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromContext returns the partner that authenticated the request, if any
+func FromContext(ctx context.Context) (*Partner, bool) {
+	partner, ok := ctx.Value(contextKey{}).(*Partner)
+	return partner, ok
+}
+
+// verifyToken checks the shared secret in the token parameter or header,
+// removing the parameter so it isn't stored with the postback
+func verifyToken(r *http.Request, partner *Partner) bool {
+	token := r.Header.Get(TokenHeader)
+	query := r.URL.Query()
+	if query.Has(TokenParam) {
+		if token == "" {
+			token = query.Get(TokenParam)
+		}
+		query.Del(TokenParam)
+		r.URL.RawQuery = query.Encode()
+	}
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(partner.Secret)) == 1
+}
+
+// readSignedBody reads the body of a signed postback, up to maxSignedBody,
+// and restores it for the handler
+func readSignedBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	if len(body) > maxSignedBody {
+		return nil, errBodyTooLarge
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// verifySignature checks the signature header, an HMAC-SHA256 over
+// "<timestamp>.<raw query>.<body>" keyed with the partner secret
+func (a *Authenticator) verifySignature(r *http.Request, partner *Partner, body []byte) bool {
+	signature := strings.TrimPrefix(r.Header.Get(SignatureHeader), "sha256=")
+	timestamp := r.Header.Get(TimestampHeader)
+	if signature == "" || timestamp == "" {
+		return false
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > a.maxSkew || skew < -a.maxSkew {
+		return false
+	}
+
+	expected := Sign(partner.Secret, timestamp, r.URL.RawQuery, body)
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected))
+}
+
+// Sign returns the hex signature partners send for a postback
+func Sign(secret, timestamp, rawQuery string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(rawQuery))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,118 @@
+package partners
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+)
+
+func TestAuthenticatorMiddleware(t *testing.T) {
+	registry := NewRegistry(nil)
+	for _, partner := range []*Partner{
+		{OrganizationID: "org", PartnerID: "token", Name: "token", Status: StatusActive, AuthMode: AuthToken, Secret: "s3cret"},
+		{OrganizationID: "org", PartnerID: "hmac", Name: "hmac", Status: StatusActive, AuthMode: AuthHMAC, Secret: "k3y"},
+		{OrganizationID: "org", PartnerID: "office", Name: "office", Status: StatusActive, AuthMode: AuthToken, Secret: "s3cret", AllowedIPs: []string{"198.51.100.0/24"}},
+		{OrganizationID: "org", PartnerID: "disabled", Name: "disabled", Status: StatusDisabled, AuthMode: AuthToken, Secret: "s3cret"},
+	} {
+		if err := partner.compile(); err != nil {
+			t.Fatalf("compile() error = %v", err)
+		}
+		registry.partners[partner.PartnerID] = partner
+	}
+
+	var gotBody, gotQuery string
+	router := chi.NewRouter()
+	router.With(NewAuthenticator(registry, 5*time.Minute).Middleware).Post("/postback/{partner_id}", func(w http.ResponseWriter, r *http.Request) {
+		if orgCtx, ok := auth.GetOrganizationContext(r.Context()); !ok || orgCtx.OrganizationID != "org" {
+			t.Errorf("organization context = %+v, want org", orgCtx)
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotBody, gotQuery = string(body), r.URL.RawQuery
+	})
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	body := "click_id=1&status=approved"
+	oversized := strings.Repeat("x", maxSignedBody+1)
+
+	tests := []struct {
+		name      string
+		target    string
+		headers   map[string]string
+		body      string
+		want      int
+		wantBody  string
+		wantQuery string
+	}{
+		{name: "token parameter", target: "/postback/token?click_id=1&token=s3cret", want: http.StatusOK, wantQuery: "click_id=1"},
+		{name: "token header", target: "/postback/token?click_id=1", headers: map[string]string{TokenHeader: "s3cret"}, want: http.StatusOK, wantQuery: "click_id=1"},
+		{name: "bad token", target: "/postback/token?click_id=1&token=wrong", want: http.StatusUnauthorized},
+		{name: "missing token", target: "/postback/token?click_id=1", want: http.StatusUnauthorized},
+		{name: "unknown partner", target: "/postback/nobody?token=s3cret", want: http.StatusUnauthorized},
+		{name: "disabled partner", target: "/postback/disabled?token=s3cret", want: http.StatusUnauthorized},
+		{name: "disallowed address", target: "/postback/office?token=s3cret", want: http.StatusForbidden},
+		{
+			name:     "valid signature",
+			target:   "/postback/hmac?txid=9",
+			headers:  map[string]string{TimestampHeader: now, SignatureHeader: "sha256=" + Sign("k3y", now, "txid=9", []byte(body))},
+			body:     body,
+			want:     http.StatusOK,
+			wantBody: body, wantQuery: "txid=9",
+		},
+		{
+			name:    "signature over other body",
+			target:  "/postback/hmac?txid=9",
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: Sign("k3y", now, "txid=9", []byte("click_id=2"))},
+			body:    body,
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "signature with wrong key",
+			target:  "/postback/hmac?txid=9",
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: Sign("other", now, "txid=9", []byte(body))},
+			body:    body,
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "stale signature",
+			target:  "/postback/hmac?txid=9",
+			headers: map[string]string{TimestampHeader: stale, SignatureHeader: Sign("k3y", stale, "txid=9", []byte(body))},
+			body:    body,
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "oversized body",
+			target:  "/postback/hmac",
+			headers: map[string]string{TimestampHeader: now, SignatureHeader: Sign("k3y", now, "", []byte(oversized[:maxSignedBody]))},
+			body:    oversized,
+			want:    http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBody, gotQuery = "", ""
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			r.RemoteAddr = "203.0.113.7:5000"
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if gotBody != tt.wantBody || gotQuery != tt.wantQuery {
+				t.Errorf("handler saw body %q, query %q, want %q, %q", gotBody, gotQuery, tt.wantBody, tt.wantQuery)
+			}
+		})
+	}
+}
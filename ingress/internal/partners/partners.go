@@ -0,0 +1,343 @@
+package partners
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+)
+
+// Partner statuses
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+	StatusDeleted  = "deleted"
+)
+
+// Authentication modes
+const (
+	AuthToken = "token" // shared secret in the token query parameter
+	AuthHMAC  = "hmac"  // HMAC-SHA256 signature header
+)
+
+// ErrNotFound is returned for unknown partners
+var ErrNotFound = errors.New("partner not found")
+
+// ErrNoWarehouse is returned by partner changes when ClickHouse is not configured
+var ErrNoWarehouse = errors.New("clickhouse is not configured")
+
+// Partner is an affiliate network or advertiser allowed to send postbacks
+type Partner struct {
+	OrganizationID string            `json:"organization_id"`
+	PartnerID      string            `json:"partner_id"`
+	Name           string            `json:"name"`
+	Status         string            `json:"status"`
+	AuthMode       string            `json:"auth_mode"`                // token or hmac
+	Secret         string            `json:"secret,omitempty"`         // shared token or HMAC key
+	AllowedIPs     []string          `json:"allowed_ips,omitempty"`    // CIDRs; empty allows any source
+	Macros         map[string]string `json:"macros,omitempty"`         // postback field -> partner macro
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+
+	allowed []netip.Prefix
+}
+
+// Registry holds postback partners, loaded from ClickHouse and refreshed in the background
+type Registry struct {
+	clickhouse clickhouse.Conn
+	mu         sync.RWMutex
+	partners   map[string]*Partner // partner_id -> Partner
+}
+
+// NewRegistry creates a partner registry
+func NewRegistry(ch clickhouse.Conn) *Registry {
+	r := &Registry{
+		clickhouse: ch,
+		partners:   make(map[string]*Partner),
+	}
+
+	if ch != nil {
+		if err := r.loadPartners(context.Background()); err != nil {
+			slog.Warn("failed to load postback partners", "error", err)
+		}
+	}
+
+	go r.refreshPartners()
+
+	return r
+}
+
+// Get returns a partner by ID
+func (r *Registry) Get(partnerID string) (*Partner, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	partner, ok := r.partners[partnerID]
+	return partner, ok
+}
+
+// List returns an organization's partners
+func (r *Registry) List(organizationID string) []*Partner {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var partners []*Partner
+	for _, partner := range r.partners {
+		if partner.OrganizationID == organizationID {
+			partners = append(partners, partner)
+		}
+	}
+	return partners
+}
+
+// Create validates and stores a new partner, generating its ID and secret
+func (r *Registry) Create(ctx context.Context, partner *Partner) error {
+	partner.PartnerID = uuid.New().String()
+	partner.Status = StatusActive
+	partner.CreatedAt = time.Now().UTC()
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return err
+	}
+	partner.Secret = secret
+
+	return r.save(ctx, partner)
+}
+
+// Update stores changes to an existing partner
+func (r *Registry) Update(ctx context.Context, partner *Partner) error {
+	existing, ok := r.Get(partner.PartnerID)
+	if !ok || existing.OrganizationID != partner.OrganizationID {
+		return ErrNotFound
+	}
+	partner.CreatedAt = existing.CreatedAt
+	if partner.Secret == "" {
+		partner.Secret = existing.Secret
+	}
+	return r.save(ctx, partner)
+}
+
+// Delete marks a partner as deleted
+func (r *Registry) Delete(ctx context.Context, organizationID, partnerID string) error {
+	existing, ok := r.Get(partnerID)
+	if !ok || existing.OrganizationID != organizationID {
+		return ErrNotFound
+	}
+	deleted := *existing
+	deleted.Status = StatusDeleted
+	return r.save(ctx, &deleted)
+}
+
+// save validates a partner and writes a new version of it
+func (r *Registry) save(ctx context.Context, partner *Partner) error {
+	if err := partner.compile(); err != nil {
+		return err
+	}
+	partner.UpdatedAt = time.Now().UTC()
+
+	if r.clickhouse == nil {
+		return ErrNoWarehouse
+	}
+
+	query := `
+		INSERT INTO postback_partners (
+			organization_id, partner_id, name, status, auth_mode, secret,
+			allowed_ips, macros, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	err := r.clickhouse.Exec(ctx, query,
+		partner.OrganizationID,
+		partner.PartnerID,
+		partner.Name,
+		partner.Status,
+		partner.AuthMode,
+		partner.Secret,
+		partner.AllowedIPs,
+		partner.Macros,
+		partner.CreatedAt,
+		partner.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save partner: %w", err)
+	}
+
+	// Update local cache
+	r.mu.Lock()
+	if partner.Status == StatusDeleted {
+		delete(r.partners, partner.PartnerID)
+	} else {
+		r.partners[partner.PartnerID] = partner
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// compile validates a partner and parses its allowlist
+func (p *Partner) compile() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("partner name is required")
+	}
+	switch p.AuthMode {
+	case "":
+		p.AuthMode = AuthToken
+	case AuthToken, AuthHMAC:
+	default:
+		return fmt.Errorf("invalid auth mode %q", p.AuthMode)
+	}
+	switch p.Status {
+	case StatusActive, StatusDisabled, StatusDeleted:
+	default:
+		return fmt.Errorf("invalid status %q", p.Status)
+	}
+
+	for field := range p.Macros {
+		if field == "" || strings.Trim(field, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+			return fmt.Errorf("invalid macro parameter %q", field)
+		}
+	}
+
+	allowed := make([]netip.Prefix, 0, len(p.AllowedIPs))
+	for _, cidr := range p.AllowedIPs {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		allowed = append(allowed, prefix)
+	}
+	p.allowed = allowed
+	return nil
+}
+
+// AllowsIP reports whether addr may send postbacks for the partner
+func (p *Partner) AllowsIP(addr netip.Addr) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPartners loads all partners from ClickHouse
+func (r *Registry) loadPartners(ctx context.Context) error {
+	query := `
+		SELECT
+			organization_id,
+			partner_id,
+			name,
+			status,
+			auth_mode,
+			secret,
+			allowed_ips,
+			macros,
+			created_at,
+			updated_at
+		FROM postback_partners FINAL
+		WHERE status != 'deleted'
+	`
+
+	rows, err := r.clickhouse.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query partners: %w", err)
+	}
+	defer rows.Close()
+
+	partners := make(map[string]*Partner)
+
+	for rows.Next() {
+		var partner Partner
+		err := rows.Scan(
+			&partner.OrganizationID,
+			&partner.PartnerID,
+			&partner.Name,
+			&partner.Status,
+			&partner.AuthMode,
+			&partner.Secret,
+			&partner.AllowedIPs,
+			&partner.Macros,
+			&partner.CreatedAt,
+			&partner.UpdatedAt,
+		)
+		if err != nil {
+			slog.Warn("failed to scan partner row", "error", err)
+			continue
+		}
+		if err := partner.compile(); err != nil {
+			slog.Warn("skipping invalid partner",
+				"partner_id", partner.PartnerID,
+				"error", err)
+			continue
+		}
+		partners[partner.PartnerID] = &partner
+	}
+
+	// Update partners atomically
+	r.mu.Lock()
+	r.partners = partners
+	r.mu.Unlock()
+
+	slog.Info("loaded postback partners", "count", len(partners))
+	return nil
+}
+
+// refreshPartners periodically refreshes partner data
+func (r *Registry) refreshPartners() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if r.clickhouse == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := r.loadPartners(ctx); err != nil {
+			slog.Error("failed to refresh postback partners", "error", err)
+		}
+		cancel()
+	}
+}
+
+// GenerateSecret returns a new random partner secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return "pbs_" + hex.EncodeToString(buf), nil
+}
+
+// parsePrefix parses a CIDR or a single address
+func parsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid allowed IP %q: %w", value, err)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid allowed IP %q: %w", value, err)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
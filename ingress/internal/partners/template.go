@@ -0,0 +1,56 @@
+package partners
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultMacros are the placeholders used in generated postback URLs unless
+// a partner overrides them with its own network's macro syntax
+var DefaultMacros = map[string]string{
+	"click_id":       "{click_id}",
+	"transaction_id": "{transaction_id}",
+	"status":         "{status}",
+	"value":          "{payout}",
+	"currency":       "{currency}",
+}
+
+// postbackFields orders the standard parameters in generated URLs
+var postbackFields = []string{"click_id", "transaction_id", "status", "value", "currency"}
+
+// PostbackURL returns the URL template a partner configures in its network.
+// Partner macros replace the defaults; an empty macro drops the parameter,
+// and extra macros are appended as custom parameters. Token partners get
+// their secret embedded, HMAC partners sign requests instead.
+func PostbackURL(baseURL string, partner *Partner) string {
+	macros := make(map[string]string, len(DefaultMacros)+len(partner.Macros))
+	for field, macro := range DefaultMacros {
+		macros[field] = macro
+	}
+	for field, macro := range partner.Macros {
+		macros[field] = macro
+	}
+
+	var extra []string
+	for field := range macros {
+		if _, ok := DefaultMacros[field]; !ok {
+			extra = append(extra, field)
+		}
+	}
+	sort.Strings(extra)
+	fields := append(append([]string{}, postbackFields...), extra...)
+
+	var params []string
+	for _, field := range fields {
+		if macros[field] == "" {
+			continue
+		}
+		// Macros are left unescaped so the network can substitute them
+		params = append(params, field+"="+macros[field])
+	}
+	if partner.AuthMode != AuthHMAC {
+		params = append(params, TokenParam+"="+partner.Secret)
+	}
+
+	return strings.TrimRight(baseURL, "/") + "/postback/" + partner.PartnerID + "?" + strings.Join(params, "&")
+}
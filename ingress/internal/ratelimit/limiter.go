@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+	"github.com/orchard9/trellis/ingress/internal/partners"
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit scopes, checked in this order
+const (
+	ScopeIP           = "ip"
+	ScopeAPIKey       = "api_key"
+	ScopeOrganization = "organization"
+)
+
+// Plan holds the request limits per window for a pricing plan (0 = unlimited)
+type Plan struct {
+	PerIP           int
+	PerAPIKey       int
+	PerOrganization int
+}
+
+// PlanFunc returns the plan name of an organization
+type PlanFunc func(organizationID string) string
+
+// contextKey stores the limited scope in the request context
+type contextKey struct{}
+
+// Limiter enforces layered per-IP, per-API-key and per-organization limits
+// with sliding window counters in Redis, shared across replicas. It must run
+// after authentication so the organization is known, and fails open when
+// Redis is slow, unavailable or not configured.
+type Limiter struct {
+	redis   *redis.Client
+	window  time.Duration
+	timeout time.Duration
+
+	mu          sync.RWMutex
+	plans       map[string]Plan
+	defaultPlan string
+	planOf      PlanFunc
+}
+
+// NewLimiter creates a limiter. A nil planOf puts every organization on the default plan.
+func NewLimiter(redisClient *redis.Client, window, timeout time.Duration, plans map[string]Plan, defaultPlan string, planOf PlanFunc) *Limiter {
+	return &Limiter{
+		redis:       redisClient,
+		window:      window,
+		timeout:     timeout,
+		plans:       plans,
+		defaultPlan: defaultPlan,
+		planOf:      planOf,
+	}
+}
+
+// limitCheck is a single scope's counter for a request
+type limitCheck struct {
+	scope    string
+	limit    int
+	key      string
+	current  *redis.IntCmd
+	previous *redis.StringCmd
+}
+
+// Check counts the request against each limit of the organization's plan
+// and returns the first scope that is over its limit, or "" if none is.
+// The rate is estimated over a sliding window: the current window's count
+// plus the previous window's count weighted by how much of it still overlaps.
+func (l *Limiter) Check(r *http.Request) string {
+	if l.redis == nil {
+		return ""
+	}
+
+	ctx := r.Context()
+	orgCtx, ok := auth.GetOrganizationContext(ctx)
+	if !ok {
+		return ""
+	}
+	organizationID := orgCtx.OrganizationID
+	plan := l.plan(organizationID)
+
+	checks := []*limitCheck{
+		{scope: ScopeIP, limit: plan.PerIP, key: organizationID + ":" + requestIP(r)},
+		{scope: ScopeAPIKey, limit: plan.PerAPIKey, key: organizationID + ":" + apiKeyID(r)},
+		{scope: ScopeOrganization, limit: plan.PerOrganization, key: organizationID},
+	}
+
+	now := time.Now().UTC()
+	currentWindow := now.Truncate(l.window)
+	previousWindow := currentWindow.Add(-l.window)
+
+	redisCtx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	_, err := l.redis.Pipelined(redisCtx, func(pipe redis.Pipeliner) error {
+		for _, check := range checks {
+			if check.limit <= 0 {
+				continue
+			}
+			key := windowKey(check.scope, check.key, currentWindow)
+			check.current = pipe.Incr(redisCtx, key)
+			pipe.Expire(redisCtx, key, 2*l.window)
+			check.previous = pipe.Get(redisCtx, windowKey(check.scope, check.key, previousWindow))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		slog.Warn("rate limit check failed", "error", err, "organization_id", organizationID)
+		return ""
+	}
+
+	overlap := float64(l.window-now.Sub(currentWindow)) / float64(l.window)
+	for _, check := range checks {
+		if check.current == nil {
+			continue
+		}
+		previous, _ := strconv.ParseInt(check.previous.Val(), 10, 64)
+		rate := float64(previous)*overlap + float64(check.current.Val())
+		if rate > float64(check.limit) {
+			return check.scope
+		}
+	}
+	return ""
+}
+
+// Reject responds 429 to requests over their limit
+func (l *Limiter) Reject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope := l.Check(r); scope != "" {
+			w.Header().Set("Retry-After", strconv.Itoa(int(l.window.Seconds())))
+			http.Error(w, fmt.Sprintf("Rate limit exceeded (%s)", scope), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Flag lets requests over their limit through, recording the limited scope
+// in the context. Used for clicks so the visitor's journey never breaks.
+func (l *Limiter) Flag(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scope := l.Check(r); scope != "" {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, scope))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitedScope returns the scope a flagged request exceeded, if any
+func LimitedScope(ctx context.Context) (string, bool) {
+	scope, ok := ctx.Value(contextKey{}).(string)
+	return scope, ok
+}
+
+// KeyByClientIP is an httprate key function using the trusted-proxy client IP
+func KeyByClientIP(r *http.Request) (string, error) {
+	return requestIP(r), nil
+}
+
+// SetPlans replaces the plan limits, e.g. on config reload
+func (l *Limiter) SetPlans(plans map[string]Plan, defaultPlan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.plans = plans
+	l.defaultPlan = defaultPlan
+}
+
+// plan returns the limits of an organization's plan
+func (l *Limiter) plan(organizationID string) Plan {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.planOf != nil {
+		if plan, ok := l.plans[l.planOf(organizationID)]; ok {
+			return plan
+		}
+	}
+	return l.plans[l.defaultPlan]
+}
+
+// windowKey returns the Redis key of a counter window
+func windowKey(scope, key string, window time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%s:%d", scope, key, window.Unix())
+}
+
+// requestIP returns the client network of a request (IPv6 grouped by /64)
+func requestIP(r *http.Request) string {
+	if addr, ok := clientip.FromContext(r.Context()); ok {
+		return clientip.ClientKey(addr)
+	}
+	addr, _ := clientip.ParseHost(r.RemoteAddr)
+	return clientip.ClientKey(addr)
+}
+
+// apiKeyID identifies the request's API key without storing the key itself.
+// Partner postbacks are keyed by partner instead.
+func apiKeyID(r *http.Request) string {
+	if partner, ok := partners.FromContext(r.Context()); ok {
+		return "partner:" + partner.PartnerID
+	}
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
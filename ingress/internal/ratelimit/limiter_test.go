@@ -0,0 +1,239 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/orchard9/trellis/ingress/internal/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+var testPlans = map[string]Plan{
+	"free":       {PerIP: 2, PerAPIKey: 3, PerOrganization: 4},
+	"pro":        {PerIP: 5, PerAPIKey: 0, PerOrganization: 0},
+	"enterprise": {},
+}
+
+func newTestLimiter(t *testing.T, planOf PlanFunc) (*Limiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewLimiter(client, time.Minute, time.Second, testPlans, "free", planOf), mr
+}
+
+// orgRequest is a request authenticated for an organization with an API key
+func orgRequest(organizationID, remoteAddr, apiKey string) *http.Request {
+	r := httptest.NewRequest("GET", "/in", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("Authorization", "Bearer "+apiKey)
+	return r.WithContext(context.WithValue(r.Context(), auth.OrganizationContextKey, &auth.OrganizationContext{OrganizationID: organizationID}))
+}
+
+// checkAll runs the requests through the limiter and returns the limited scopes
+func checkAll(l *Limiter, requests ...*http.Request) []string {
+	scopes := make([]string, len(requests))
+	for i, r := range requests {
+		scopes[i] = l.Check(r)
+	}
+	return scopes
+}
+
+func TestLimiterScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []*http.Request
+		want     []string
+	}{
+		{
+			name: "per ip",
+			requests: []*http.Request{
+				orgRequest("org", "203.0.113.7:1", "key"),
+				orgRequest("org", "203.0.113.7:2", "key"),
+				orgRequest("org", "203.0.113.7:3", "key"),
+			},
+			want: []string{"", "", ScopeIP},
+		},
+		{
+			name: "per api key",
+			requests: []*http.Request{
+				orgRequest("org", "203.0.113.1:1", "key"),
+				orgRequest("org", "203.0.113.2:1", "key"),
+				orgRequest("org", "203.0.113.3:1", "key"),
+				orgRequest("org", "203.0.113.4:1", "key"),
+			},
+			want: []string{"", "", "", ScopeAPIKey},
+		},
+		{
+			name: "per organization",
+			requests: []*http.Request{
+				orgRequest("org", "203.0.113.1:1", "key-1"),
+				orgRequest("org", "203.0.113.2:1", "key-2"),
+				orgRequest("org", "203.0.113.3:1", "key-3"),
+				orgRequest("org", "203.0.113.4:1", "key-4"),
+				orgRequest("org", "203.0.113.5:1", "key-5"),
+			},
+			want: []string{"", "", "", "", ScopeOrganization},
+		},
+		{
+			name: "organizations are separate",
+			requests: []*http.Request{
+				orgRequest("org", "203.0.113.7:1", "key"),
+				orgRequest("org", "203.0.113.7:1", "key"),
+				orgRequest("other", "203.0.113.7:1", "key"),
+			},
+			want: []string{"", "", ""},
+		},
+		{
+			name: "ipv6 grouped by /64",
+			requests: []*http.Request{
+				orgRequest("org", "[2001:db8::1]:1", "key"),
+				orgRequest("org", "[2001:db8::2]:1", "key"),
+				orgRequest("org", "[2001:db8::3]:1", "key"),
+			},
+			want: []string{"", "", ScopeIP},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(t, nil)
+			got := checkAll(l, tt.requests...)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Check() = %q, want %q", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterPlans(t *testing.T) {
+	plans := map[string]string{"pro-org": "pro", "big-org": "enterprise", "odd-org": "unknown"}
+	l, _ := newTestLimiter(t, func(organizationID string) string { return plans[organizationID] })
+
+	tests := []struct {
+		organizationID string
+		allowed        int // requests from one IP before the first is limited, -1 for never
+	}{
+		{"free-org", 2},
+		{"pro-org", 5},
+		{"big-org", -1},
+		{"odd-org", 2}, // unknown plans fall back to the default
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.organizationID, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				scope := l.Check(orgRequest(tt.organizationID, "203.0.113.7:1", "key"))
+				if limited := scope != ""; limited != (tt.allowed >= 0 && i >= tt.allowed) {
+					t.Fatalf("request %d Check() = %q, want %d allowed", i+1, scope, tt.allowed)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterWindowSlides(t *testing.T) {
+	l, mr := newTestLimiter(t, nil)
+	l.SetPlans(map[string]Plan{"free": {PerIP: 2}}, "free")
+
+	checkAll(l, orgRequest("org", "203.0.113.7:1", "key"), orgRequest("org", "203.0.113.7:1", "key"))
+	if scope := l.Check(orgRequest("org", "203.0.113.7:1", "key")); scope != ScopeIP {
+		t.Fatalf("Check() over the limit = %q, want %q", scope, ScopeIP)
+	}
+
+	// Counters of windows two windows back have expired
+	mr.FastForward(2 * time.Minute)
+	if scope := l.Check(orgRequest("org", "203.0.113.7:1", "key")); scope != "" {
+		t.Errorf("Check() after the window = %q, want allowed", scope)
+	}
+}
+
+func TestLimiterSetPlans(t *testing.T) {
+	l, _ := newTestLimiter(t, nil)
+	r := func() *http.Request { return orgRequest("org", "203.0.113.7:1", "key") }
+
+	checkAll(l, r(), r())
+	if scope := l.Check(r()); scope != ScopeIP {
+		t.Fatalf("Check() over the free plan = %q, want %q", scope, ScopeIP)
+	}
+
+	l.SetPlans(map[string]Plan{"free": {PerIP: 100}}, "free")
+	if scope := l.Check(r()); scope != "" {
+		t.Errorf("Check() after raising the limit = %q, want allowed", scope)
+	}
+
+	l.SetPlans(map[string]Plan{"strict": {PerIP: 1}}, "strict")
+	if scope := l.Check(r()); scope != ScopeIP {
+		t.Errorf("Check() after switching the default plan = %q, want %q", scope, ScopeIP)
+	}
+}
+
+func TestLimiterFailsOpen(t *testing.T) {
+	t.Run("without redis", func(t *testing.T) {
+		l := NewLimiter(nil, time.Minute, time.Second, testPlans, "free", nil)
+		for i := 0; i < 10; i++ {
+			if scope := l.Check(orgRequest("org", "203.0.113.7:1", "key")); scope != "" {
+				t.Fatalf("Check() = %q, want allowed", scope)
+			}
+		}
+	})
+
+	t.Run("redis unavailable", func(t *testing.T) {
+		l, mr := newTestLimiter(t, nil)
+		mr.Close()
+		for i := 0; i < 10; i++ {
+			if scope := l.Check(orgRequest("org", "203.0.113.7:1", "key")); scope != "" {
+				t.Fatalf("Check() = %q, want allowed", scope)
+			}
+		}
+	})
+
+	t.Run("without organization", func(t *testing.T) {
+		l, _ := newTestLimiter(t, nil)
+		for i := 0; i < 10; i++ {
+			if scope := l.Check(httptest.NewRequest("GET", "/in", nil)); scope != "" {
+				t.Fatalf("Check() = %q, want allowed", scope)
+			}
+		}
+	})
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	l, _ := newTestLimiter(t, nil)
+	l.SetPlans(map[string]Plan{"free": {PerIP: 1}}, "free")
+
+	var flagged []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, _ := LimitedScope(r.Context())
+		flagged = append(flagged, scope)
+	})
+
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		l.Reject(next).ServeHTTP(w, orgRequest("org", "203.0.113.7:1", "key"))
+		if w.Code != want {
+			t.Errorf("Reject() status = %d, want %d", w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("Reject() Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+		}
+	}
+
+	flagged = nil
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		l.Flag(next).ServeHTTP(w, orgRequest("org", "198.51.100.1:1", "key"))
+		if w.Code != http.StatusOK {
+			t.Errorf("Flag() status = %d, want %d", w.Code, http.StatusOK)
+		}
+	}
+	if len(flagged) != 2 || flagged[0] != "" || flagged[1] != ScopeIP {
+		t.Errorf("flagged scopes = %q, want [\"\" %q]", flagged, ScopeIP)
+	}
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Source resolves rule fields to request values; missing fields never match
+type Source interface {
+	Lookup(field string) (string, bool)
+}
+
+// Map is a Source backed by a map
+type Map map[string]string
+
+// Lookup returns the field's value
+func (m Map) Lookup(field string) (string, bool) {
+	value, ok := m[field]
+	return value, ok
+}
+
+// Match reports whether the condition holds for the source
+func (c *Condition) Match(src Source) bool {
+	if !c.valid {
+		return false
+	}
+	value, ok := src.Lookup(c.Field)
+	if !ok {
+		return false
+	}
+	return c.test(value)
+}
+
+// test applies the operator to a present value
+func (c *Condition) test(value string) bool {
+	switch c.Operator {
+	case OpEquals, OpIn:
+		for _, v := range c.Values {
+			if value == v {
+				return true
+			}
+		}
+	case OpContains:
+		lower := strings.ToLower(value)
+		for _, v := range c.Values {
+			if strings.Contains(lower, strings.ToLower(v)) {
+				return true
+			}
+		}
+	case OpPrefix:
+		for _, v := range c.Values {
+			if strings.HasPrefix(value, v) {
+				return true
+			}
+		}
+	case OpBetween:
+		if c.weekday {
+			day, ok := weekdayNumber(value)
+			return ok && inWindow(day, c.low, c.high)
+		}
+		if c.numeric {
+			if number, ok := parseNumber(value); ok {
+				return inWindow(number, c.low, c.high)
+			}
+		}
+		return inWindow(value, c.Values[0], c.Values[1])
+	case OpCIDR:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, prefix := range c.prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inWindow reports whether value is within [low, high], wrapping around
+// when low is greater than high so 22..6 matches overnight hours
+func inWindow[T float64 | string](value, low, high T) bool {
+	if low <= high {
+		return value >= low && value <= high
+	}
+	return value >= low || value <= high
+}
+
+// parseNumber parses a value in the notation both backends accept.
+// Out of range values round to infinity or zero, as in ClickHouse.
+func parseNumber(value string) (float64, bool) {
+	if !numberPattern.MatchString(value) {
+		return 0, false
+	}
+	number, _ := strconv.ParseFloat(value, 64)
+	return number, true
+}
+
+// Score returns the sum of the priorities of the matching rules
+func (p *Program) Score(src Source) int {
+	score := 0
+	for i := range p.Terms {
+		if p.Terms[i].Condition.Match(src) {
+			score += p.Terms[i].Priority
+		}
+	}
+	return score
+}
+
+// Matched returns the indexes of the matching rules and their score
+func (p *Program) Matched(src Source) ([]int, int) {
+	var matched []int
+	score := 0
+	for i := range p.Terms {
+		if p.Terms[i].Condition.Match(src) {
+			matched = append(matched, i)
+			score += p.Terms[i].Priority
+		}
+	}
+	return matched, score
+}
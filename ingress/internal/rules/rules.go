@@ -0,0 +1,138 @@
+// Package rules is the campaign rule language shared by live routing and
+// warehouse queries. Rules compile once into conditions that are either
+// evaluated in memory against a request or rendered as ClickHouse SQL over
+// stored events, with the same semantics in both.
+package rules
+
+import (
+	"net/netip"
+	"regexp"
+)
+
+// Operators
+const (
+	OpEquals   = "equals"
+	OpIn       = "in"
+	OpContains = "contains" // case-insensitive substring
+	OpPrefix   = "prefix"
+	OpBetween  = "between" // two bounds, inclusive; reversed bounds wrap around
+	OpCIDR     = "cidr"
+)
+
+// Rule defines campaign matching criteria
+type Rule struct {
+	Field    string   `json:"field"`    // param.source, header.referer, ip, geo.country, time.hour_of_day, etc.
+	Operator string   `json:"operator"` // equals, contains, in, prefix, between, cidr
+	Values   []string `json:"values"`
+	Priority int      `json:"priority"` // higher priority rules match first
+}
+
+// Condition is a compiled rule: a test on the value of one field.
+// Conditions with an unknown operator or malformed values never match.
+type Condition struct {
+	Field    string
+	Operator string
+	Values   []string
+
+	valid bool
+
+	// between: numeric bounds compare numeric values as numbers, and
+	// weekday names compare in week order, Monday first
+	numeric   bool
+	weekday   bool
+	low, high float64
+
+	// cidr: parsed ranges; invalid ones are dropped and bare addresses
+	// become single-host ranges
+	prefixes []netip.Prefix
+}
+
+// Term is a condition weighted by its rule's priority
+type Term struct {
+	Condition Condition
+	Priority  int
+}
+
+// Program is a compiled rule set. Its score is the sum of the priorities
+// of the matching rules; terms keep the order of the rules.
+type Program struct {
+	Terms []Term
+}
+
+// numberPattern is what both backends treat as a number: plain decimal
+// notation with an optional exponent
+var numberPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// Weekdays are the day names in ISO order, Monday first
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// weekdayNumber returns the ISO number (1-7) of a day name
+func weekdayNumber(name string) (float64, bool) {
+	for i, day := range Weekdays {
+		if name == day {
+			return float64(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// weekdayBounds returns the ISO numbers of between bounds that are both
+// day names
+func weekdayBounds(bounds []string) (float64, float64, bool) {
+	low, lowOK := weekdayNumber(bounds[0])
+	high, highOK := weekdayNumber(bounds[1])
+	return low, high, lowOK && highOK
+}
+
+// Compile compiles a single rule
+func Compile(rule Rule) Condition {
+	c := Condition{
+		Field:    rule.Field,
+		Operator: rule.Operator,
+		Values:   rule.Values,
+	}
+
+	switch rule.Operator {
+	case OpEquals, OpIn, OpContains, OpPrefix:
+		c.valid = true
+	case OpBetween:
+		if len(rule.Values) != 2 {
+			break
+		}
+		c.valid = true
+		if low, high, ok := weekdayBounds(rule.Values); ok {
+			c.weekday, c.low, c.high = true, low, high
+			break
+		}
+		low, lowOK := parseNumber(rule.Values[0])
+		high, highOK := parseNumber(rule.Values[1])
+		if lowOK && highOK {
+			c.numeric, c.low, c.high = true, low, high
+		}
+	case OpCIDR:
+		c.valid = true
+		for _, value := range rule.Values {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(value)
+				if addrErr != nil {
+					continue
+				}
+				addr = addr.Unmap()
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			c.prefixes = append(c.prefixes, prefix.Masked())
+		}
+	}
+
+	return c
+}
+
+// CompileSet compiles a campaign's rules
+func CompileSet(rules []Rule) *Program {
+	p := &Program{Terms: make([]Term, len(rules))}
+	for i, rule := range rules {
+		p.Terms[i] = Term{Condition: Compile(rule), Priority: rule.Priority}
+	}
+	return p
+}
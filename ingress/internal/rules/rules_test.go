@@ -0,0 +1,130 @@
+package rules
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// fixture is a rule and a request it must or must not match. The fixtures
+// are the contract between the evaluator and the SQL backend; add one
+// whenever rule semantics change.
+type fixture struct {
+	name   string
+	rule   Rule
+	fields map[string]string
+	want   bool
+}
+
+// fixtures covers every operator and the edge cases the backends must agree on
+var fixtures = []fixture{
+	{"equals match", Rule{Field: "source", Operator: OpEquals, Values: []string{"google"}}, map[string]string{"source": "google"}, true},
+	{"equals is case-sensitive", Rule{Field: "source", Operator: OpEquals, Values: []string{"google"}}, map[string]string{"source": "Google"}, false},
+	{"equals missing field", Rule{Field: "source", Operator: OpEquals, Values: []string{""}}, map[string]string{}, false},
+	{"equals present empty value", Rule{Field: "source", Operator: OpEquals, Values: []string{""}}, map[string]string{"source": ""}, true},
+	{"in second value", Rule{Field: "geo.country", Operator: OpIn, Values: []string{"US", "CA"}}, map[string]string{"geo.country": "CA"}, true},
+	{"in no values", Rule{Field: "geo.country", Operator: OpIn}, map[string]string{"geo.country": "CA"}, false},
+	{"contains ignores case", Rule{Field: "user_agent", Operator: OpContains, Values: []string{"iphone"}}, map[string]string{"user_agent": "Mozilla/5.0 (iPhone; CPU)"}, true},
+	{"contains non-ascii", Rule{Field: "param.q", Operator: OpContains, Values: []string{"ÉTÉ"}}, map[string]string{"param.q": "soldes d'été"}, true},
+	{"contains no match", Rule{Field: "user_agent", Operator: OpContains, Values: []string{"android"}}, map[string]string{"user_agent": "Mozilla/5.0 (iPhone; CPU)"}, false},
+	{"prefix match", Rule{Field: "utm_campaign", Operator: OpPrefix, Values: []string{"summer_"}}, map[string]string{"utm_campaign": "summer_sale"}, true},
+	{"prefix is case-sensitive", Rule{Field: "utm_campaign", Operator: OpPrefix, Values: []string{"summer_"}}, map[string]string{"utm_campaign": "Summer_sale"}, false},
+	{"between numeric", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"9", "17"}}, map[string]string{"time.hour_of_day": "12"}, true},
+	{"between numeric not lexical", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"9", "17"}}, map[string]string{"time.hour_of_day": "10"}, true},
+	{"between inclusive", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"9", "17"}}, map[string]string{"time.hour_of_day": "17"}, true},
+	{"between outside", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"9", "17"}}, map[string]string{"time.hour_of_day": "8"}, false},
+	{"between wraps around", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"22", "6"}}, map[string]string{"time.hour_of_day": "3"}, true},
+	{"between wrap excludes middle", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"22", "6"}}, map[string]string{"time.hour_of_day": "12"}, false},
+	{"between decimals", Rule{Field: "param.bid", Operator: OpBetween, Values: []string{"0.5", "1.5"}}, map[string]string{"param.bid": "1.25"}, true},
+	{"between exponent", Rule{Field: "param.bid", Operator: OpBetween, Values: []string{"100", "2000"}}, map[string]string{"param.bid": "1e3"}, true},
+	{"between out of range number", Rule{Field: "param.bid", Operator: OpBetween, Values: []string{"100", "2000"}}, map[string]string{"param.bid": "1e400"}, false},
+	{"between non-numeric value is lexical", Rule{Field: "param.bid", Operator: OpBetween, Values: []string{"1", "9"}}, map[string]string{"param.bid": "5x"}, true},
+	{"between hex is not a number", Rule{Field: "param.bid", Operator: OpBetween, Values: []string{"1", "9"}}, map[string]string{"param.bid": "0x5"}, false},
+	{"between lexical", Rule{Field: "time.date", Operator: OpBetween, Values: []string{"2024-01-01", "2024-01-31"}}, map[string]string{"time.date": "2024-01-15"}, true},
+	{"between lexical outside", Rule{Field: "time.time_of_day", Operator: OpBetween, Values: []string{"09:00", "17:30"}}, map[string]string{"time.time_of_day": "17:31"}, false},
+	{"between weekdays", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"monday", "friday"}}, map[string]string{"time.day_of_week": "thursday"}, true},
+	{"between weekdays not lexical", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"monday", "friday"}}, map[string]string{"time.day_of_week": "tuesday"}, true},
+	{"between weekdays outside", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"monday", "friday"}}, map[string]string{"time.day_of_week": "saturday"}, false},
+	{"between weekdays wrap around", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"friday", "monday"}}, map[string]string{"time.day_of_week": "sunday"}, true},
+	{"between weekdays wrap excludes middle", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"friday", "monday"}}, map[string]string{"time.day_of_week": "wednesday"}, false},
+	{"between weekdays other value", Rule{Field: "time.day_of_week", Operator: OpBetween, Values: []string{"monday", "friday"}}, map[string]string{"time.day_of_week": "noday"}, false},
+	{"between one bound", Rule{Field: "time.hour_of_day", Operator: OpBetween, Values: []string{"9"}}, map[string]string{"time.hour_of_day": "9"}, false},
+	{"cidr ipv4", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"10.0.0.0/8"}}, map[string]string{"ip": "10.1.2.3"}, true},
+	{"cidr ipv4 outside", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"10.0.0.0/8"}}, map[string]string{"ip": "11.1.2.3"}, false},
+	{"cidr mapped address", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"192.168.0.0/16"}}, map[string]string{"ip": "::ffff:192.168.1.1"}, true},
+	{"cidr mapped address upper case", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"10.0.0.0/8"}}, map[string]string{"ip": "::FFFF:10.0.0.1"}, true},
+	{"cidr ipv6", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"2001:db8::/32"}}, map[string]string{"ip": "2001:db8::1"}, true},
+	{"cidr bare address", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"203.0.113.7"}}, map[string]string{"ip": "203.0.113.7"}, true},
+	{"cidr unmasked range", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"10.1.2.3/8"}}, map[string]string{"ip": "10.200.0.1"}, true},
+	{"cidr invalid range skipped", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"nonsense", "10.0.0.0/8"}}, map[string]string{"ip": "10.0.0.1"}, true},
+	{"cidr invalid address", Rule{Field: "ip", Operator: OpCIDR, Values: []string{"10.0.0.0/8"}}, map[string]string{"ip": "10.0.0"}, false},
+	{"unknown operator", Rule{Field: "source", Operator: "regex", Values: []string{".*"}}, map[string]string{"source": "google"}, false},
+}
+
+func TestMatch(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			condition := Compile(f.rule)
+			if got := condition.Match(Map(f.fields)); got != f.want {
+				t.Errorf("Match() = %t, want %t", got, f.want)
+			}
+		})
+	}
+}
+
+// fixtureColumns reads fields from a Map(String, String) column named fields
+func fixtureColumns(field string) (Column, bool) {
+	return Column{
+		Value:   Expr{SQL: "fields[?]", Args: []interface{}{field}},
+		Present: &Expr{SQL: "mapContains(fields, ?)", Args: []interface{}{field}},
+	}, true
+}
+
+// TestSQL runs every fixture's condition in ClickHouse over a row holding
+// the fixture's fields. It needs TRELLIS_TEST_CLICKHOUSE_DSN, e.g.
+// clickhouse://localhost:9000/default.
+func TestSQL(t *testing.T) {
+	dsn := os.Getenv("TRELLIS_TEST_CLICKHOUSE_DSN")
+	if dsn == "" {
+		t.Skip("TRELLIS_TEST_CLICKHOUSE_DSN is not set")
+	}
+	options, err := clickhouse.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse dsn: %v", err)
+	}
+	conn, err := clickhouse.Open(options)
+	if err != nil {
+		t.Fatalf("failed to connect to clickhouse: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			condition := Compile(f.rule)
+			expr := condition.SQL(fixtureColumns)
+
+			keys, values := []string{}, []string{}
+			for k, v := range f.fields {
+				keys = append(keys, k)
+				values = append(values, v)
+			}
+
+			query := "SELECT toUInt8(" + expr.SQL + ") FROM (SELECT CAST(mapFromArrays(?, ?), 'Map(String, String)') AS fields)"
+			args := append(expr.Args, keys, values)
+
+			var matched uint8
+			if err := conn.QueryRow(ctx, query, args...).Scan(&matched); err != nil {
+				t.Fatalf("failed to evaluate: %v", err)
+			}
+			if got := matched == 1; got != f.want {
+				t.Errorf("SQL() matched = %t, want %t", got, f.want)
+			}
+		})
+	}
+}
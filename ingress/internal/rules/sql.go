@@ -0,0 +1,217 @@
+package rules
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Expr is a ClickHouse expression with its positional arguments
+type Expr struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Column reads a rule field in SQL. Value is a String expression; the
+// field is present where Present holds, or where Value is non-empty when
+// Present is nil.
+type Column struct {
+	Value   Expr
+	Present *Expr
+}
+
+// Columns maps a rule field to its column, reporting false for fields the
+// table doesn't have; rules on those never match
+type Columns func(field string) (Column, bool)
+
+// writer accumulates an expression and its arguments in order
+type writer struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+// raw writes SQL without arguments
+func (w *writer) raw(sql string) {
+	w.sql.WriteString(sql)
+}
+
+// expr writes an expression and its arguments
+func (w *writer) expr(e Expr) {
+	w.sql.WriteString(e.SQL)
+	w.args = append(w.args, e.Args...)
+}
+
+// bind writes a placeholder for value
+func (w *writer) bind(value interface{}) {
+	w.sql.WriteString("?")
+	w.args = append(w.args, value)
+}
+
+// result returns the written expression
+func (w *writer) result() Expr {
+	return Expr{SQL: w.sql.String(), Args: w.args}
+}
+
+// SQL renders the condition as a boolean expression
+func (c *Condition) SQL(columns Columns) Expr {
+	w := &writer{}
+	c.write(w, columns)
+	return w.result()
+}
+
+// ScoreSQL renders the program as an expression equal to its score
+func (p *Program) ScoreSQL(columns Columns) Expr {
+	if len(p.Terms) == 0 {
+		return Expr{SQL: "0"}
+	}
+
+	w := &writer{}
+	w.raw("(")
+	for i := range p.Terms {
+		if i > 0 {
+			w.raw(" + ")
+		}
+		w.raw("if(")
+		p.Terms[i].Condition.write(w, columns)
+		w.raw(", " + strconv.Itoa(p.Terms[i].Priority) + ", 0)")
+	}
+	w.raw(")")
+	return w.result()
+}
+
+// write renders the condition: the field must be present and pass the operator
+func (c *Condition) write(w *writer, columns Columns) {
+	col, ok := columns(c.Field)
+	if !ok || !c.valid {
+		w.raw("0")
+		return
+	}
+
+	w.raw("(")
+	if col.Present != nil {
+		w.expr(*col.Present)
+	} else {
+		w.expr(col.Value)
+		w.raw(" != ''")
+	}
+	w.raw(" AND ")
+	c.writeTest(w, col.Value)
+	w.raw(")")
+}
+
+// writeTest renders the operator applied to value
+func (c *Condition) writeTest(w *writer, value Expr) {
+	switch c.Operator {
+	case OpEquals, OpIn:
+		anyOf(w, c.Values, func(v string) {
+			w.expr(value)
+			w.raw(" = ")
+			w.bind(v)
+		})
+	case OpContains:
+		anyOf(w, c.Values, func(v string) {
+			w.raw("positionCaseInsensitiveUTF8(")
+			w.expr(value)
+			w.raw(", ")
+			w.bind(v)
+			w.raw(") > 0")
+		})
+	case OpPrefix:
+		anyOf(w, c.Values, func(v string) {
+			w.raw("startsWith(")
+			w.expr(value)
+			w.raw(", ")
+			w.bind(v)
+			w.raw(")")
+		})
+	case OpBetween:
+		lexical := func() {
+			window(w, c.Values[0] <= c.Values[1], func() { w.expr(value) }, c.Values[0], c.Values[1])
+		}
+		if c.weekday {
+			day := func() {
+				w.raw("indexOf(")
+				w.bind(Weekdays)
+				w.raw(", ")
+				w.expr(value)
+				w.raw(")")
+			}
+			w.raw("(")
+			day()
+			w.raw(" > 0 AND ")
+			window(w, c.low <= c.high, day, int(c.low), int(c.high))
+			w.raw(")")
+			return
+		}
+		if !c.numeric {
+			lexical()
+			return
+		}
+		w.raw("if(match(")
+		w.expr(value)
+		w.raw(", ")
+		w.bind(numberPattern.String())
+		w.raw("), ")
+		window(w, c.low <= c.high, func() {
+			w.raw("toFloat64OrZero(")
+			w.expr(value)
+			w.raw(")")
+		}, c.low, c.high)
+		w.raw(", ")
+		lexical()
+		w.raw(")")
+	case OpCIDR:
+		// IPv4-mapped addresses are unmapped, as netip's Unmap. The pattern
+		// avoids ? so it isn't taken for a placeholder.
+		unmapped := func() {
+			w.raw("replaceRegexpOne(")
+			w.expr(value)
+			w.raw(`, '^::[fF][fF][fF][fF]:([0-9]+\\.[0-9]+\\.[0-9]+\\.[0-9]+)$', '\\1')`)
+		}
+		w.raw("(isIPv4String(")
+		unmapped()
+		w.raw(") OR isIPv6String(")
+		unmapped()
+		w.raw(")) AND ")
+		anyOf(w, c.prefixes, func(prefix netip.Prefix) {
+			w.raw("isIPAddressInRange(")
+			unmapped()
+			w.raw(", ")
+			w.bind(prefix.String())
+			w.raw(")")
+		})
+	}
+}
+
+// anyOf writes the disjunction of one condition per value; none is false
+func anyOf[T any](w *writer, values []T, cond func(T)) {
+	if len(values) == 0 {
+		w.raw("0")
+		return
+	}
+	w.raw("(")
+	for i, v := range values {
+		if i > 0 {
+			w.raw(" OR ")
+		}
+		cond(v)
+	}
+	w.raw(")")
+}
+
+// window writes value >= low AND value <= high, or the wrapped OR form
+func window(w *writer, ordered bool, value func(), low, high interface{}) {
+	join := " OR "
+	if ordered {
+		join = " AND "
+	}
+	w.raw("(")
+	value()
+	w.raw(" >= ")
+	w.bind(low)
+	w.raw(join)
+	value()
+	w.raw(" <= ")
+	w.bind(high)
+	w.raw(")")
+}
@@ -0,0 +1,103 @@
+package tracking
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Session describes the visitor session an event belongs to
+type Session struct {
+	ID                string
+	StartedAt         time.Time
+	LandingCampaignID string
+	EventIndex        int // zero-based position of the event within the session
+	IsNew             bool
+}
+
+// sessionScript atomically continues or starts a session. The key expires
+// after the inactivity gap, so a missing key means the previous session ended.
+// KEYS[1] = session key
+// ARGV = now (ms), gap (ms), candidate session ID, landing campaign
+var sessionScript = redis.NewScript(`
+local id = redis.call('HGET', KEYS[1], 'id')
+if id then
+	local idx = redis.call('HINCRBY', KEYS[1], 'idx', 1)
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	local fields = redis.call('HMGET', KEYS[1], 'start', 'landing')
+	return {id, fields[1], fields[2], idx, 0}
+end
+redis.call('HSET', KEYS[1], 'id', ARGV[3], 'start', ARGV[1], 'landing', ARGV[4], 'idx', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return {ARGV[3], ARGV[1], ARGV[4], 0, 1}
+`)
+
+// Sessionizer groups a visitor's events into sessions split by inactivity gaps
+type Sessionizer struct {
+	redis *redis.Client
+	ids   *IDGenerator
+	gap   time.Duration
+}
+
+// NewSessionizer creates a sessionizer that starts a new session after gap of inactivity
+func NewSessionizer(redisClient *redis.Client, ids *IDGenerator, gap time.Duration) *Sessionizer {
+	return &Sessionizer{
+		redis: redisClient,
+		ids:   ids,
+		gap:   gap,
+	}
+}
+
+// Track assigns the event at time now to the visitor's current session,
+// starting a new one (landing on campaignID) if the previous session expired
+func (s *Sessionizer) Track(ctx context.Context, organizationID, userID, campaignID string, now time.Time) (Session, error) {
+	if userID == "" {
+		return Session{}, fmt.Errorf("user ID is required for sessionization")
+	}
+
+	// Without Redis there is no session state; every event starts one
+	if s.redis == nil {
+		return Session{
+			ID:                s.ids.NextString(),
+			StartedAt:         now,
+			LandingCampaignID: campaignID,
+			IsNew:             true,
+		}, nil
+	}
+
+	key := fmt.Sprintf("session:%s:%s", organizationID, userID)
+	res, err := sessionScript.Run(ctx, s.redis, []string{key},
+		now.UnixMilli(),
+		s.gap.Milliseconds(),
+		s.ids.NextString(),
+		campaignID,
+	).Slice()
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to track session: %w", err)
+	}
+	if len(res) != 5 {
+		return Session{}, fmt.Errorf("unexpected session script result: %v", res)
+	}
+
+	startMs, err := strconv.ParseInt(fmt.Sprint(res[1]), 10, 64)
+	if err != nil {
+		return Session{}, fmt.Errorf("invalid session start: %w", err)
+	}
+
+	session := Session{
+		ID:                fmt.Sprint(res[0]),
+		StartedAt:         time.UnixMilli(startMs),
+		LandingCampaignID: fmt.Sprint(res[2]),
+	}
+	if idx, ok := res[3].(int64); ok {
+		session.EventIndex = int(idx)
+	}
+	if isNew, ok := res[4].(int64); ok {
+		session.IsNew = isNew == 1
+	}
+
+	return session, nil
+}
@@ -0,0 +1,84 @@
+package tracking
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Snowflake layout: 41 bits of milliseconds since epoch, 10 bits of node ID
+// and 12 bits of per-millisecond sequence. IDs sort by creation time.
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	maxNodeID    = -1 ^ (-1 << nodeBits)
+	maxSequence  = -1 ^ (-1 << sequenceBits)
+)
+
+// epoch is the custom snowflake epoch (2024-01-01T00:00:00Z)
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IDGenerator generates time-ordered snowflake IDs
+type IDGenerator struct {
+	mu       sync.Mutex
+	nodeID   int64
+	lastMs   int64
+	sequence int64
+}
+
+// NewIDGenerator creates a generator for the given node (0-1023)
+func NewIDGenerator(nodeID int64) (*IDGenerator, error) {
+	if nodeID < 0 || nodeID > maxNodeID {
+		return nil, fmt.Errorf("node ID must be between 0 and %d, got %d", maxNodeID, nodeID)
+	}
+	return &IDGenerator{nodeID: nodeID}, nil
+}
+
+// Next returns the next ID, waiting for the next millisecond if the
+// sequence for the current one is exhausted
+func (g *IDGenerator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Since(epoch).Milliseconds()
+	if now < g.lastMs {
+		// Clock moved backwards; keep IDs monotonic
+		now = g.lastMs
+	}
+
+	if now == g.lastMs {
+		g.sequence = (g.sequence + 1) & maxSequence
+		if g.sequence == 0 {
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Since(epoch).Milliseconds()
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+
+	g.lastMs = now
+	return now<<(nodeBits+sequenceBits) | g.nodeID<<sequenceBits | g.sequence
+}
+
+// NextString returns the next ID in decimal form
+func (g *IDGenerator) NextString() string {
+	return formatID(g.Next())
+}
+
+// IDTime extracts the creation time from a snowflake ID
+func IDTime(id int64) time.Time {
+	return epoch.Add(time.Duration(id>>(nodeBits+sequenceBits)) * time.Millisecond)
+}
+
+// formatID renders an ID in decimal form
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// parseID parses a decimal ID
+func parseID(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
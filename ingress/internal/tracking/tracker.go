@@ -0,0 +1,205 @@
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/orchard9/trellis/ingress/internal/clientip"
+	"github.com/redis/go-redis/v9"
+)
+
+// CookieName is the first-party visitor cookie set on tracking endpoints
+const CookieName = "trellis_uid"
+
+// Visitor identifies the person behind a request
+type Visitor struct {
+	ID          string
+	IsReturning bool
+	// FirstSeen is derived from the snowflake ID and is zero for foreign IDs
+	FirstSeen time.Time
+	// Fingerprinted is set when the visitor was recognized without a cookie
+	Fingerprinted bool
+}
+
+// fingerprintScript returns the visitor ID stored for a fingerprint, or
+// stores the candidate ID. The window slides with every request.
+// KEYS[1] = fingerprint key
+// ARGV = candidate visitor ID, window (ms)
+var fingerprintScript = redis.NewScript(`
+local id = redis.call('GET', KEYS[1])
+if id then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {id, 1}
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return {ARGV[1], 0}
+`)
+
+// versionPattern matches version numbers in user agents, so a fingerprint
+// keeps the browser family across upgrades
+var versionPattern = regexp.MustCompile(`[0-9][0-9._]*`)
+
+// Tracker recognizes returning visitors with a signed first-party cookie.
+// Requests without one fall back to a coarse fingerprint (user agent
+// family, primary language and IP subnet) remembered in Redis for a short
+// window, so clients that drop cookies keep one ID.
+type Tracker struct {
+	ids               *IDGenerator
+	redis             *redis.Client
+	secret            []byte
+	domain            string
+	maxAge            time.Duration
+	fingerprintWindow time.Duration
+	secure            bool
+}
+
+// NewTracker creates a visitor tracker. Cookies are signed with secret and
+// bound to the organization so they cannot be replayed across organizations.
+// Without Redis, or with a zero fingerprintWindow, there is no fingerprint
+// fallback.
+func NewTracker(ids *IDGenerator, redisClient *redis.Client, secret, domain string, maxAge, fingerprintWindow time.Duration, secure bool) *Tracker {
+	return &Tracker{
+		ids:               ids,
+		redis:             redisClient,
+		secret:            []byte(secret),
+		domain:            domain,
+		maxAge:            maxAge,
+		fingerprintWindow: fingerprintWindow,
+		secure:            secure,
+	}
+}
+
+// Identify returns the visitor for the request. Without a valid cookie for
+// this organization the visitor is matched by fingerprint, or a new ID is
+// minted.
+func (t *Tracker) Identify(r *http.Request, organizationID string) Visitor {
+	if cookie, err := r.Cookie(CookieName); err == nil {
+		if id, ok := t.verify(cookie.Value, organizationID); ok {
+			visitor := Visitor{ID: id, IsReturning: true}
+			if n, err := parseID(id); err == nil {
+				visitor.FirstSeen = IDTime(n)
+			}
+			return visitor
+		}
+	}
+
+	id := t.ids.Next()
+	visitor := Visitor{ID: formatID(id), FirstSeen: IDTime(id)}
+	if matched, ok := t.matchFingerprint(r, organizationID, visitor.ID); ok {
+		return matched
+	}
+	return visitor
+}
+
+// matchFingerprint returns the visitor remembered for the request's
+// fingerprint, remembering candidateID when there is none
+func (t *Tracker) matchFingerprint(r *http.Request, organizationID, candidateID string) (Visitor, bool) {
+	if t.redis == nil || t.fingerprintWindow <= 0 {
+		return Visitor{}, false
+	}
+	fingerprint, ok := t.fingerprint(r, organizationID)
+	if !ok {
+		return Visitor{}, false
+	}
+
+	key := fmt.Sprintf("visitorfp:%s:%s", organizationID, fingerprint)
+	res, err := fingerprintScript.Run(r.Context(), t.redis, []string{key},
+		candidateID, t.fingerprintWindow.Milliseconds()).Slice()
+	if err != nil || len(res) != 2 {
+		slog.WarnContext(r.Context(), "failed to match visitor fingerprint", "error", err)
+		return Visitor{}, false
+	}
+
+	visitor := Visitor{ID: fmt.Sprint(res[0]), Fingerprinted: true}
+	if seen, ok := res[1].(int64); ok {
+		visitor.IsReturning = seen == 1
+	}
+	if n, err := parseID(visitor.ID); err == nil {
+		visitor.FirstSeen = IDTime(n)
+	}
+	return visitor, true
+}
+
+// fingerprint is a keyed hash of the request's user agent family, primary
+// language and IP subnet (/24 for IPv4, /64 for IPv6). Requests without a
+// client address have none.
+func (t *Tracker) fingerprint(r *http.Request, organizationID string) (string, bool) {
+	addr, ok := clientip.FromContext(r.Context())
+	if !ok {
+		addr, ok = clientip.ParseHost(r.RemoteAddr)
+	}
+	if !ok {
+		return "", false
+	}
+	addr = addr.Unmap()
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	subnet, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+
+	language, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	language, _, _ = strings.Cut(language, ";")
+	language, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(language)), "-")
+
+	mac := hmac.New(sha256.New, t.secret)
+	for _, part := range []string{organizationID, versionPattern.ReplaceAllString(r.UserAgent(), ""), language, subnet.String()} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16]), true
+}
+
+// SetCookie writes (or refreshes) the visitor cookie on the response.
+// It must be called before the response status is written.
+func (t *Tracker) SetCookie(w http.ResponseWriter, organizationID string, visitor Visitor) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    t.sign(visitor.ID, organizationID),
+		Path:     "/",
+		Domain:   t.domain,
+		MaxAge:   int(t.maxAge.Seconds()),
+		Secure:   t.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign produces "<id>.<signature>"
+func (t *Tracker) sign(id, organizationID string) string {
+	return id + "." + t.signature(id, organizationID)
+}
+
+// verify checks a cookie value and returns the visitor ID it carries
+func (t *Tracker) verify(value, organizationID string) (string, bool) {
+	idx := strings.LastIndex(value, ".")
+	if idx <= 0 {
+		return "", false
+	}
+	id, sig := value[:idx], value[idx+1:]
+
+	expected := t.signature(id, organizationID)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return "", false
+	}
+	return id, true
+}
+
+// signature computes a truncated HMAC-SHA256 over the organization and ID
+func (t *Tracker) signature(id, organizationID string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(organizationID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
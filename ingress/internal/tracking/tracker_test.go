@@ -0,0 +1,151 @@
+package tracking
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestTracker(t *testing.T, redisClient *redis.Client) *Tracker {
+	ids, err := NewIDGenerator(1)
+	if err != nil {
+		t.Fatalf("NewIDGenerator() error = %v", err)
+	}
+	return NewTracker(ids, redisClient, "secret", "", time.Hour, 30*time.Minute, true)
+}
+
+// visitorRequest is a request from a client, carrying cookie when non-empty
+func visitorRequest(remoteAddr, userAgent, language, cookie string) *http.Request {
+	r := httptest.NewRequest("GET", "/in", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("User-Agent", userAgent)
+	r.Header.Set("Accept-Language", language)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: CookieName, Value: cookie})
+	}
+	return r
+}
+
+const safariUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Version/17.0 Mobile/15E148 Safari/604.1"
+
+func TestTrackerCookie(t *testing.T) {
+	tracker := newTestTracker(t, nil)
+
+	first := tracker.Identify(visitorRequest("203.0.113.7:5000", safariUA, "en-US", ""), "org")
+	if first.IsReturning || first.ID == "" || first.FirstSeen.IsZero() {
+		t.Fatalf("Identify() without cookie = %+v, want a new visitor", first)
+	}
+
+	w := httptest.NewRecorder()
+	tracker.SetCookie(w, "org", first)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("SetCookie() wrote %d cookies, want 1", len(cookies))
+	}
+	cookie := cookies[0]
+	if cookie.Name != CookieName || !cookie.HttpOnly || !cookie.Secure || cookie.MaxAge != 3600 || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("SetCookie() = %+v, want a secure HttpOnly Lax cookie for an hour", cookie)
+	}
+	if !strings.HasPrefix(cookie.Value, first.ID+".") {
+		t.Errorf("cookie value = %q, want the visitor ID and a signature", cookie.Value)
+	}
+
+	returning := tracker.Identify(visitorRequest("198.51.100.1:5000", "curl/8.0", "", cookie.Value), "org")
+	if !returning.IsReturning || returning.ID != first.ID || !returning.FirstSeen.Equal(first.FirstSeen) || returning.Fingerprinted {
+		t.Errorf("Identify() with cookie = %+v, want returning visitor %s", returning, first.ID)
+	}
+}
+
+func TestTrackerRejectsTamperedCookies(t *testing.T) {
+	tracker := newTestTracker(t, nil)
+	id := tracker.ids.NextString()
+	valid := tracker.sign(id, "org")
+	_, signature, _ := strings.Cut(valid, ".")
+
+	other := newTestTracker(t, nil)
+	other.secret = []byte("other secret")
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"changed ID", tracker.ids.NextString() + "." + signature},
+		{"changed signature", id + "." + strings.Repeat("A", len(signature))},
+		{"other organization", tracker.sign(id, "other-org")},
+		{"other secret", other.sign(id, "org")},
+		{"unsigned", id},
+		{"empty ID", "." + signature},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visitor := tracker.Identify(visitorRequest("203.0.113.7:5000", safariUA, "en", tt.value), "org")
+			if visitor.IsReturning || visitor.ID == id {
+				t.Errorf("Identify() = %+v, want a new visitor", visitor)
+			}
+		})
+	}
+
+	if visitor := tracker.Identify(visitorRequest("203.0.113.7:5000", safariUA, "en", valid), "org"); !visitor.IsReturning || visitor.ID != id {
+		t.Errorf("Identify() with the untampered cookie = %+v, want returning visitor %s", visitor, id)
+	}
+}
+
+func TestTrackerFingerprintFallback(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	tracker := newTestTracker(t, client)
+
+	first := tracker.Identify(visitorRequest("203.0.113.7:5000", safariUA, "en-US,en;q=0.9", ""), "org")
+	if first.IsReturning || !first.Fingerprinted || first.FirstSeen.IsZero() {
+		t.Fatalf("Identify() first cookieless request = %+v, want a new fingerprinted visitor", first)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		userAgent string
+		language  string
+		org       string
+		same      bool
+	}{
+		{"same client", "203.0.113.7:6000", safariUA, "en-US,en;q=0.9", "org", true},
+		{"same subnet", "203.0.113.99:5000", safariUA, "en-GB", "org", true},
+		{"browser upgrade", "203.0.113.7:5000", strings.ReplaceAll(safariUA, "17", "18"), "en", "org", true},
+		{"other subnet", "203.0.114.7:5000", safariUA, "en", "org", false},
+		{"other language", "203.0.113.7:5000", safariUA, "fr-FR", "org", false},
+		{"other browser", "203.0.113.7:5000", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36", "en", "org", false},
+		{"other organization", "203.0.113.7:5000", safariUA, "en", "other-org", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			visitor := tracker.Identify(visitorRequest(tt.remote, tt.userAgent, tt.language, ""), tt.org)
+			if (visitor.ID == first.ID) != tt.same || visitor.IsReturning != tt.same {
+				t.Errorf("Identify() = %+v, want same visitor as %s: %t", visitor, first.ID, tt.same)
+			}
+		})
+	}
+
+	mr.FastForward(31 * time.Minute)
+	if visitor := tracker.Identify(visitorRequest("203.0.113.7:5000", safariUA, "en", ""), "org"); visitor.ID == first.ID {
+		t.Errorf("Identify() after the window = %+v, want a new visitor", visitor)
+	}
+}
+
+func TestTrackerWithoutRedis(t *testing.T) {
+	tracker := newTestTracker(t, nil)
+	r := func() *http.Request { return visitorRequest("203.0.113.7:5000", safariUA, "en", "") }
+
+	first, second := tracker.Identify(r(), "org"), tracker.Identify(r(), "org")
+	if first.ID == second.ID || second.IsReturning || second.Fingerprinted {
+		t.Errorf("Identify() without Redis = %+v, %+v, want two new visitors", first, second)
+	}
+}
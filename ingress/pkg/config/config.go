@@ -13,6 +13,15 @@ type Config struct {
 	Port        int    `json:"port"`
 	Environment string `json:"environment"`
 	LogLevel    string `json:"log_level"`
+	LogFormat   string `json:"log_format"` // json or text
+
+	// Per message and second, the first LogSampleInitial info/debug lines
+	// are logged, then every LogSampleThereafter-th (0 disables sampling)
+	LogSampleInitial    int `json:"log_sample_initial"`
+	LogSampleThereafter int `json:"log_sample_thereafter"`
+
+	// Comma-separated proxy CIDRs whose forwarding headers are trusted
+	TrustedProxies string `json:"trusted_proxies"`
 
 	// Warden configuration for organization-aware authentication
 	Warden WardenConfig `json:"warden"`
@@ -28,6 +37,24 @@ type Config struct {
 
 	// Google Cloud Storage configuration
 	GCS GCSConfig `json:"gcs"`
+
+	// Visitor tracking configuration
+	Tracking TrackingConfig `json:"tracking"`
+
+	// Deduplication and fraud detection configuration
+	Fraud FraudConfig `json:"fraud"`
+
+	// Ingestion rate limiting configuration
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// Partner postback configuration
+	Postback PostbackConfig `json:"postback"`
+
+	// Prometheus metrics configuration
+	Metrics MetricsConfig `json:"metrics"`
+
+	// OpenTelemetry tracing configuration
+	Tracing TracingConfig `json:"tracing"`
 }
 
 // WardenConfig holds Warden service connection settings
@@ -93,51 +120,273 @@ type GCSConfig struct {
 	ArchivePrefix string `json:"archive_prefix"`
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
-	config := &Config{
-		Port:        getEnvInt("TRELLIS_PORT", 8080),
-		Environment: getEnvString("TRELLIS_ENV", "development"),
-		LogLevel:    getEnvString("TRELLIS_LOG_LEVEL", "info"),
+// TrackingConfig holds visitor recognition settings
+type TrackingConfig struct {
+	// Secret used to sign the trellis_uid cookie
+	CookieSecret string `json:"cookie_secret"`
+
+	// Cookie domain (empty means the request host)
+	CookieDomain string `json:"cookie_domain"`
+
+	// Cookie lifetime in days
+	CookieMaxAgeDays int `json:"cookie_max_age_days"`
+
+	// Snowflake node ID (0-1023), unique per ingress replica
+	NodeID int `json:"node_id"`
+
+	// Inactivity gap in minutes after which a new session starts
+	SessionTimeoutMinutes int `json:"session_timeout_minutes"`
+
+	// Minutes a cookieless visitor is recognized by fingerprint
+	FingerprintWindowMinutes int `json:"fingerprint_window_minutes"`
+}
+
+// FraudConfig holds deduplication and fraud detector settings.
+// Per-organization windows and thresholds live in organization settings.
+type FraudConfig struct {
+	// Timeout for Redis operations on the redirect path
+	RedisTimeoutMs int `json:"redis_timeout_ms"`
+
+	// Click velocity limits per window (0 disables the check)
+	VelocityWindowSeconds int `json:"velocity_window_seconds"`
+	MaxClicksPerIP        int `json:"max_clicks_per_ip"`
+	MaxClicksPerVisitor   int `json:"max_clicks_per_visitor"`
+
+	// Header carrying the client's ASN, set by the edge
+	ASNHeader string `json:"asn_header"`
+
+	// Comma-separated datacenter/hosting ASNs
+	DatacenterASNs string `json:"datacenter_asns"`
+
+	// Conversions faster than this after their click are flagged
+	MinConversionSeconds int `json:"min_conversion_seconds"`
+
+	// How long click times are kept for conversion checks
+	ClickRetentionDays int `json:"click_retention_days"`
+
+	// Optional bot list file (pattern|name|category|verify.domains per line)
+	BotListFile string `json:"bot_list_file"`
+
+	// Timeout for reverse DNS verification of claimed crawlers
+	BotVerifyTimeoutMs int `json:"bot_verify_timeout_ms"`
+
+	// Comma-separated IP list files as name=path (e.g. "datacenter=/etc/trellis/dc.txt")
+	IPListFiles string `json:"ip_list_files"`
+
+	// How often IP list files are reloaded (0 disables reloading)
+	IPListRefreshMinutes int `json:"ip_list_refresh_minutes"`
+}
+
+// RateLimitConfig holds layered rate limit settings. Plans are
+// comma-separated name=per_ip/per_api_key/per_organization entries giving
+// requests per window, where 0 means unlimited.
+type RateLimitConfig struct {
+	// Sliding window length for plan limits
+	WindowSeconds int `json:"window_seconds"`
+
+	// Plan limits, e.g. "free=120/1200/3000,pro=600/12000/60000"
+	Plans string `json:"plans"`
+
+	// Plan used by organizations without one
+	DefaultPlan string `json:"default_plan"`
+
+	// Per-IP requests per minute on the management API, checked before authentication
+	APIRequestsPerMinute int `json:"api_requests_per_minute"`
+
+	// Timeout for Redis counter operations
+	RedisTimeoutMs int `json:"redis_timeout_ms"`
+}
+
+// PostbackConfig holds partner postback settings
+type PostbackConfig struct {
+	// Public ingress URL used in generated partner postback URLs
+	BaseURL string `json:"base_url"`
+
+	// Maximum age of a signed postback's timestamp
+	SignatureMaxSkewSeconds int `json:"signature_max_skew_seconds"`
+
+	// Outbound postback delivery: attempts before giving up, per-request
+	// timeout, first retry delay (doubled per attempt) and its cap
+	ForwardMaxAttempts       int `json:"forward_max_attempts"`
+	ForwardTimeoutMs         int `json:"forward_timeout_ms"`
+	ForwardBackoffSeconds    int `json:"forward_backoff_seconds"`
+	ForwardMaxBackoffMinutes int `json:"forward_max_backoff_minutes"`
+
+	// Concurrent outbound deliveries per replica
+	ForwardWorkers int `json:"forward_workers"`
+
+	// Allow outbound postbacks to loopback and private addresses (local testing only)
+	ForwardAllowPrivate bool `json:"forward_allow_private"`
+}
+
+// MetricsConfig holds Prometheus metrics settings
+type MetricsConfig struct {
+	// Serve /metrics on a separate listener instead of logging metrics
+	Enabled bool `json:"enabled"`
+
+	// Port of the metrics listener
+	Port int `json:"port"`
+
+	// Distinct organization label values before organizations are grouped as "other"
+	MaxOrganizations int `json:"max_organizations"`
+}
+
+// TracingConfig holds OpenTelemetry tracing settings
+type TracingConfig struct {
+	// Span exporter: none, otlp or stdout
+	Exporter string `json:"exporter"`
+
+	// OTLP/HTTP collector endpoint (host:port) and whether to skip TLS
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	OTLPInsecure bool   `json:"otlp_insecure"`
+
+	// Share of new traces sampled (0-1); traces sampled upstream are always continued
+	SampleRatio float64 `json:"sample_ratio"`
+
+	// Service name reported on spans
+	ServiceName string `json:"service_name"`
+}
+
+// RateLimitPlan holds the request limits of a plan
+type RateLimitPlan struct {
+	PerIP           int
+	PerAPIKey       int
+	PerOrganization int
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() *Config {
+	return &Config{
+		Port:        8080,
+		Environment: "development",
+		LogLevel:    "info",
+		LogFormat:   "json",
+
+		LogSampleInitial:    100,
+		LogSampleThereafter: 100,
+
+		TrustedProxies: "127.0.0.0/8,::1/128",
 		
 		Warden: WardenConfig{
-			Address:        getEnvString("WARDEN_ADDRESS", "localhost:21382"),
-			TLS:            getEnvBool("WARDEN_TLS", false),
-			ServiceAPIKey:  getEnvString("WARDEN_SERVICE_API_KEY", ""),
-			TimeoutSeconds: getEnvInt("WARDEN_TIMEOUT_SECONDS", 30),
+			Address:        "localhost:21382",
+			TLS:            false,
+			ServiceAPIKey:  "",
+			TimeoutSeconds: 30,
 		},
 		
 		ClickHouse: ClickHouseConfig{
-			Host:               getEnvString("CLICKHOUSE_HOST", "localhost"),
-			Port:               getEnvInt("CLICKHOUSE_PORT", 8123),
-			Database:           getEnvString("CLICKHOUSE_DATABASE", "trellis"),
-			Username:           getEnvString("CLICKHOUSE_USERNAME", "default"),
-			Password:           getEnvString("CLICKHOUSE_PASSWORD", ""),
-			MaxOpenConnections: getEnvInt("CLICKHOUSE_MAX_OPEN_CONNS", 10),
-			ConnMaxLifetime:    getEnvInt("CLICKHOUSE_CONN_MAX_LIFETIME", 60),
+			Host:               "localhost",
+			Port:               8123,
+			Database:           "trellis",
+			Username:           "default",
+			Password:           "",
+			MaxOpenConnections: 10,
+			ConnMaxLifetime:    60,
 		},
 		
 		Redis: RedisConfig{
-			URL:          getEnvString("REDIS_URL", "redis://localhost:6379/0"),
-			PoolSize:     getEnvInt("REDIS_POOL_SIZE", 10),
-			MinIdleConns: getEnvInt("REDIS_MIN_IDLE_CONNS", 2),
-			KeyPrefix:    getEnvString("REDIS_KEY_PREFIX", "trellis"),
+			URL:          "redis://localhost:6379/0",
+			PoolSize:     10,
+			MinIdleConns: 2,
+			KeyPrefix:    "trellis",
 		},
 		
 		PubSub: PubSubConfig{
-			ProjectID:              getEnvString("PUBSUB_PROJECT_ID", ""),
-			TopicID:                getEnvString("PUBSUB_TOPIC_ID", "trellis-events"),
-			SubscriptionID:         getEnvString("PUBSUB_SUBSCRIPTION_ID", "trellis-processor"),
-			MaxOutstandingMessages: getEnvInt("PUBSUB_MAX_OUTSTANDING", 1000),
-			NumGoroutines:          getEnvInt("PUBSUB_NUM_GOROUTINES", 10),
+			ProjectID:              "",
+			TopicID:                "trellis-events",
+			SubscriptionID:         "trellis-processor",
+			MaxOutstandingMessages: 1000,
+			NumGoroutines:          10,
 		},
 		
 		GCS: GCSConfig{
-			ProjectID:     getEnvString("GCS_PROJECT_ID", ""),
-			BucketName:    getEnvString("GCS_BUCKET_NAME", ""),
-			ArchivePrefix: getEnvString("GCS_ARCHIVE_PREFIX", "events"),
+			ProjectID:     "",
+			BucketName:    "",
+			ArchivePrefix: "events",
+		},
+
+		Tracking: TrackingConfig{
+			CookieSecret:             "trellis-dev-cookie-secret",
+			CookieDomain:             "",
+			CookieMaxAgeDays:         365,
+			NodeID:                   0,
+			SessionTimeoutMinutes:    30,
+			FingerprintWindowMinutes: 30,
+		},
+
+		Fraud: FraudConfig{
+			RedisTimeoutMs:        10,
+			VelocityWindowSeconds: 60,
+			MaxClicksPerIP:        30,
+			MaxClicksPerVisitor:   10,
+			ASNHeader:             "X-Client-ASN",
+			// AWS, Google Cloud, Azure, DigitalOcean, OVH, Hetzner, Linode
+			DatacenterASNs:       "16509,14618,15169,396982,8075,14061,16276,24940,63949",
+			MinConversionSeconds: 10,
+			ClickRetentionDays:   30,
+			BotListFile:          "",
+			BotVerifyTimeoutMs:   50,
+			IPListFiles:          "",
+			IPListRefreshMinutes: 60,
+		},
+
+		RateLimit: RateLimitConfig{
+			WindowSeconds:        60,
+			Plans:                "free=120/1200/3000,pro=600/12000/60000,enterprise=0/0/0",
+			DefaultPlan:          "free",
+			APIRequestsPerMinute: 300,
+			RedisTimeoutMs:       10,
+		},
+
+		Postback: PostbackConfig{
+			BaseURL:                  "http://localhost:8080",
+			SignatureMaxSkewSeconds:  300,
+			ForwardMaxAttempts:       8,
+			ForwardTimeoutMs:         5000,
+			ForwardBackoffSeconds:    30,
+			ForwardMaxBackoffMinutes: 360,
+			ForwardWorkers:           16,
+			ForwardAllowPrivate:      false,
+		},
+
+		Metrics: MetricsConfig{
+			Enabled:          true,
+			Port:             9091,
+			MaxOrganizations: 500,
+		},
+
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4318",
+			OTLPInsecure: true,
+			SampleRatio:  0.1,
+			ServiceName:  "trellis-ingress",
 		},
 	}
+}
+
+// Load loads configuration from the file named by TRELLIS_CONFIG_FILE, if
+// set, overridden by environment variables
+func Load() (*Config, error) {
+	return LoadFile(os.Getenv("TRELLIS_CONFIG_FILE"))
+}
+
+// LoadFile loads configuration from the defaults, the YAML or JSON file at
+// path (skipped when empty) and environment variables, in that order.
+// Malformed values are errors naming the offending key.
+func LoadFile(path string) (*Config, error) {
+	config := Default()
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := config.resolveSecrets(); err != nil {
+		return nil, err
+	}
 	
 	// Validate required configuration
 	if err := config.Validate(); err != nil {
@@ -147,12 +396,109 @@ func Load() (*Config, error) {
 	return config, nil
 }
 
+// applyEnv overrides settings with the environment variables that are set
+func (c *Config) applyEnv() error {
+	env := &envReader{}
+	env.Int("TRELLIS_PORT", &c.Port)
+	env.String("TRELLIS_ENV", &c.Environment)
+	env.String("TRELLIS_LOG_LEVEL", &c.LogLevel)
+	env.String("TRELLIS_LOG_FORMAT", &c.LogFormat)
+	env.Int("TRELLIS_LOG_SAMPLE_INITIAL", &c.LogSampleInitial)
+	env.Int("TRELLIS_LOG_SAMPLE_THEREAFTER", &c.LogSampleThereafter)
+	env.String("TRELLIS_TRUSTED_PROXIES", &c.TrustedProxies)
+
+	env.String("WARDEN_ADDRESS", &c.Warden.Address)
+	env.Bool("WARDEN_TLS", &c.Warden.TLS)
+	env.Secret("WARDEN_SERVICE_API_KEY", &c.Warden.ServiceAPIKey)
+	env.Int("WARDEN_TIMEOUT_SECONDS", &c.Warden.TimeoutSeconds)
+
+	env.String("CLICKHOUSE_HOST", &c.ClickHouse.Host)
+	env.Int("CLICKHOUSE_PORT", &c.ClickHouse.Port)
+	env.String("CLICKHOUSE_DATABASE", &c.ClickHouse.Database)
+	env.String("CLICKHOUSE_USERNAME", &c.ClickHouse.Username)
+	env.Secret("CLICKHOUSE_PASSWORD", &c.ClickHouse.Password)
+	env.Int("CLICKHOUSE_MAX_OPEN_CONNS", &c.ClickHouse.MaxOpenConnections)
+	env.Int("CLICKHOUSE_CONN_MAX_LIFETIME", &c.ClickHouse.ConnMaxLifetime)
+
+	env.Secret("REDIS_URL", &c.Redis.URL)
+	env.Int("REDIS_POOL_SIZE", &c.Redis.PoolSize)
+	env.Int("REDIS_MIN_IDLE_CONNS", &c.Redis.MinIdleConns)
+	env.String("REDIS_KEY_PREFIX", &c.Redis.KeyPrefix)
+
+	env.String("PUBSUB_PROJECT_ID", &c.PubSub.ProjectID)
+	env.String("PUBSUB_TOPIC_ID", &c.PubSub.TopicID)
+	env.String("PUBSUB_SUBSCRIPTION_ID", &c.PubSub.SubscriptionID)
+	env.Int("PUBSUB_MAX_OUTSTANDING", &c.PubSub.MaxOutstandingMessages)
+	env.Int("PUBSUB_NUM_GOROUTINES", &c.PubSub.NumGoroutines)
+
+	env.String("GCS_PROJECT_ID", &c.GCS.ProjectID)
+	env.String("GCS_BUCKET_NAME", &c.GCS.BucketName)
+	env.String("GCS_ARCHIVE_PREFIX", &c.GCS.ArchivePrefix)
+
+	env.Secret("TRACKING_COOKIE_SECRET", &c.Tracking.CookieSecret)
+	env.String("TRACKING_COOKIE_DOMAIN", &c.Tracking.CookieDomain)
+	env.Int("TRACKING_COOKIE_MAX_AGE_DAYS", &c.Tracking.CookieMaxAgeDays)
+	env.Int("TRACKING_NODE_ID", &c.Tracking.NodeID)
+	env.Int("TRACKING_SESSION_TIMEOUT_MINUTES", &c.Tracking.SessionTimeoutMinutes)
+	env.Int("TRACKING_FINGERPRINT_WINDOW_MINUTES", &c.Tracking.FingerprintWindowMinutes)
+
+	env.Int("FRAUD_REDIS_TIMEOUT_MS", &c.Fraud.RedisTimeoutMs)
+	env.Int("FRAUD_VELOCITY_WINDOW_SECONDS", &c.Fraud.VelocityWindowSeconds)
+	env.Int("FRAUD_MAX_CLICKS_PER_IP", &c.Fraud.MaxClicksPerIP)
+	env.Int("FRAUD_MAX_CLICKS_PER_VISITOR", &c.Fraud.MaxClicksPerVisitor)
+	env.String("FRAUD_ASN_HEADER", &c.Fraud.ASNHeader)
+	env.String("FRAUD_DATACENTER_ASNS", &c.Fraud.DatacenterASNs)
+	env.Int("FRAUD_MIN_CONVERSION_SECONDS", &c.Fraud.MinConversionSeconds)
+	env.Int("FRAUD_CLICK_RETENTION_DAYS", &c.Fraud.ClickRetentionDays)
+	env.String("FRAUD_BOT_LIST_FILE", &c.Fraud.BotListFile)
+	env.Int("FRAUD_BOT_VERIFY_TIMEOUT_MS", &c.Fraud.BotVerifyTimeoutMs)
+	env.String("FRAUD_IP_LIST_FILES", &c.Fraud.IPListFiles)
+	env.Int("FRAUD_IP_LIST_REFRESH_MINUTES", &c.Fraud.IPListRefreshMinutes)
+
+	env.Int("RATE_LIMIT_WINDOW_SECONDS", &c.RateLimit.WindowSeconds)
+	env.String("RATE_LIMIT_PLANS", &c.RateLimit.Plans)
+	env.String("RATE_LIMIT_DEFAULT_PLAN", &c.RateLimit.DefaultPlan)
+	env.Int("RATE_LIMIT_API_REQUESTS_PER_MINUTE", &c.RateLimit.APIRequestsPerMinute)
+	env.Int("RATE_LIMIT_REDIS_TIMEOUT_MS", &c.RateLimit.RedisTimeoutMs)
+
+	env.String("POSTBACK_BASE_URL", &c.Postback.BaseURL)
+	env.Int("POSTBACK_SIGNATURE_MAX_SKEW_SECONDS", &c.Postback.SignatureMaxSkewSeconds)
+	env.Int("POSTBACK_FORWARD_MAX_ATTEMPTS", &c.Postback.ForwardMaxAttempts)
+	env.Int("POSTBACK_FORWARD_TIMEOUT_MS", &c.Postback.ForwardTimeoutMs)
+	env.Int("POSTBACK_FORWARD_BACKOFF_SECONDS", &c.Postback.ForwardBackoffSeconds)
+	env.Int("POSTBACK_FORWARD_MAX_BACKOFF_MINUTES", &c.Postback.ForwardMaxBackoffMinutes)
+	env.Int("POSTBACK_FORWARD_WORKERS", &c.Postback.ForwardWorkers)
+	env.Bool("POSTBACK_FORWARD_ALLOW_PRIVATE", &c.Postback.ForwardAllowPrivate)
+
+	env.Bool("METRICS_ENABLED", &c.Metrics.Enabled)
+	env.Int("METRICS_PORT", &c.Metrics.Port)
+	env.Int("METRICS_MAX_ORGANIZATIONS", &c.Metrics.MaxOrganizations)
+
+	env.String("TRACING_EXPORTER", &c.Tracing.Exporter)
+	env.String("TRACING_OTLP_ENDPOINT", &c.Tracing.OTLPEndpoint)
+	env.Bool("TRACING_OTLP_INSECURE", &c.Tracing.OTLPInsecure)
+	env.Float("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+	env.String("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+
+	return env.err()
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.Port < 1 || c.Port > 65535 {
 		return fmt.Errorf("invalid port: %d", c.Port)
 	}
 	
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("invalid log level: %q", c.LogLevel)
+	}
+	
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		return fmt.Errorf("invalid log format: %q", c.LogFormat)
+	}
+	
 	if c.Warden.Address == "" {
 		return fmt.Errorf("warden address is required")
 	}
@@ -169,6 +515,32 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("redis URL is required")
 	}
 	
+	if c.RateLimit.WindowSeconds < 1 {
+		return fmt.Errorf("invalid rate limit window: %d", c.RateLimit.WindowSeconds)
+	}
+	
+	if c.Postback.ForwardMaxAttempts < 1 || c.Postback.ForwardWorkers < 1 {
+		return fmt.Errorf("postback forwarding needs at least one attempt and one worker")
+	}
+	
+	if c.Metrics.Enabled && (c.Metrics.Port < 1 || c.Metrics.Port > 65535 || c.Metrics.Port == c.Port) {
+		return fmt.Errorf("invalid metrics port: %d", c.Metrics.Port)
+	}
+	
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	default:
+		return fmt.Errorf("invalid tracing exporter: %q", c.Tracing.Exporter)
+	}
+	
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("invalid tracing sample ratio: %v", c.Tracing.SampleRatio)
+	}
+	
+	if c.Tracking.NodeID < 0 || c.Tracking.NodeID > 1023 {
+		return fmt.Errorf("invalid tracking node ID: %d", c.Tracking.NodeID)
+	}
+	
 	// PubSub validation (optional for development)
 	if c.Environment == "production" {
 		if c.PubSub.ProjectID == "" {
@@ -177,6 +549,9 @@ func (c *Config) Validate() error {
 		if c.GCS.ProjectID == "" {
 			return fmt.Errorf("gcs project ID is required in production")
 		}
+		if c.Tracking.CookieSecret == "" || c.Tracking.CookieSecret == "trellis-dev-cookie-secret" {
+			return fmt.Errorf("tracking cookie secret is required in production")
+		}
 	}
 	
 	return nil
@@ -220,29 +595,83 @@ func (c *Config) IsDevelopment() bool {
 	return strings.ToLower(c.Environment) == "development"
 }
 
-// Helper functions for environment variable parsing
+// GetTrustedProxies returns the configured trusted proxy CIDRs
+func (c *Config) GetTrustedProxies() []string {
+	var proxies []string
+	for _, part := range strings.Split(c.TrustedProxies, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			proxies = append(proxies, part)
+		}
+	}
+	return proxies
+}
 
-func getEnvString(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// GetDatacenterASNs parses the configured datacenter ASN list
+func (c *Config) GetDatacenterASNs() ([]uint32, error) {
+	var asns []uint32
+	for _, part := range strings.Split(c.Fraud.DatacenterASNs, ",") {
+		part = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(part)), "AS")
+		if part == "" {
+			continue
+		}
+		asn, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid datacenter ASN %q: %w", part, err)
+		}
+		asns = append(asns, uint32(asn))
 	}
-	return defaultValue
+	return asns, nil
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// GetIPListFiles parses the configured IP list files into name -> path
+func (c *Config) GetIPListFiles() (map[string]string, error) {
+	files := make(map[string]string)
+	for _, part := range strings.Split(c.Fraud.IPListFiles, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(part, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid IP list file %q, expected name=path", part)
 		}
+		files[name] = path
 	}
-	return defaultValue
+	return files, nil
 }
 
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+// GetRateLimitPlans parses the configured rate limit plans
+func (c *Config) GetRateLimitPlans() (map[string]RateLimitPlan, error) {
+	plans := make(map[string]RateLimitPlan)
+	for _, part := range strings.Split(c.RateLimit.Plans, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, limits, ok := strings.Cut(part, "=")
+		values := strings.Split(limits, "/")
+		if !ok || strings.TrimSpace(name) == "" || len(values) != 3 {
+			return nil, fmt.Errorf("invalid rate limit plan %q, expected name=per_ip/per_api_key/per_organization", part)
+		}
+
+		var parsed [3]int
+		for i, value := range values {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid rate limit plan %q: bad limit %q", part, value)
+			}
+			parsed[i] = n
+		}
+		plans[strings.TrimSpace(name)] = RateLimitPlan{
+			PerIP:           parsed[0],
+			PerAPIKey:       parsed[1],
+			PerOrganization: parsed[2],
 		}
 	}
-	return defaultValue
-}
\ No newline at end of file
+
+	if _, ok := plans[c.RateLimit.DefaultPlan]; !ok {
+		return nil, fmt.Errorf("default rate limit plan %q is not defined", c.RateLimit.DefaultPlan)
+	}
+	return plans, nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretFilePrefix marks a secret value read from a file, e.g. "file:/run/secrets/clickhouse"
+const secretFilePrefix = "file:"
+
+// readFile applies a YAML or JSON config file. Keys are the json field
+// names; unknown keys and mistyped values are errors.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Decode YAML generically and re-encode it so both formats share the json field names
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(values); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".json":
+	default:
+		return fmt.Errorf("unsupported config file %s: expected .yaml, .yml or .json", path)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// resolveSecrets replaces secrets given as file:<path> with the file's contents
+func (c *Config) resolveSecrets() error {
+	for _, secret := range []*string{
+		&c.Warden.ServiceAPIKey,
+		&c.ClickHouse.Password,
+		&c.Redis.URL,
+		&c.Tracking.CookieSecret,
+	} {
+		path, ok := strings.CutPrefix(*secret, secretFilePrefix)
+		if !ok {
+			continue
+		}
+		value, err := readSecretFile(path)
+		if err != nil {
+			return err
+		}
+		*secret = value
+	}
+	return nil
+}
+
+// readSecretFile reads a secret, dropping the trailing newline most tools write
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envReader applies environment variables that are set, collecting parse
+// errors instead of falling back to defaults
+type envReader struct {
+	errs []error
+}
+
+// String reads a string variable
+func (e *envReader) String(key string, dst *string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+// Secret reads a string variable, or the file named by key_FILE
+func (e *envReader) Secret(key string, dst *string) {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		value, err := readSecretFile(path)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s_FILE: %w", key, err))
+			return
+		}
+		*dst = value
+		return
+	}
+	e.String(key, dst)
+}
+
+// Int reads an integer variable
+func (e *envReader) Int(key string, dst *int) {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: expected an integer", key, value))
+			return
+		}
+		*dst = n
+	}
+}
+
+// Float reads a decimal variable
+func (e *envReader) Float(key string, dst *float64) {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: expected a number", key, value))
+			return
+		}
+		*dst = f
+	}
+}
+
+// Bool reads a boolean variable
+func (e *envReader) Bool(key string, dst *bool) {
+	if value := os.Getenv(key); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: expected true or false", key, value))
+			return
+		}
+		*dst = b
+	}
+}
+
+// err returns the collected parse errors
+func (e *envReader) err() error {
+	return errors.Join(e.errs...)
+}
+
+// Reloaded returns a copy of c with the settings that can change at
+// runtime taken from next: log level, rate limit plans and the fraud
+// velocity and conversion timing limits
+func (c *Config) Reloaded(next *Config) *Config {
+	reloaded := *c
+	reloaded.LogLevel = next.LogLevel
+	reloaded.RateLimit.Plans = next.RateLimit.Plans
+	reloaded.RateLimit.DefaultPlan = next.RateLimit.DefaultPlan
+	reloaded.Fraud.MaxClicksPerIP = next.Fraud.MaxClicksPerIP
+	reloaded.Fraud.MaxClicksPerVisitor = next.Fraud.MaxClicksPerVisitor
+	reloaded.Fraud.MinConversionSeconds = next.Fraud.MinConversionSeconds
+	return &reloaded
+}
+
+// RestartRequired lists the settings, by top-level json name, that differ
+// in next but only take effect on restart
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	reloaded, updated := reflect.ValueOf(*c.Reloaded(next)), reflect.ValueOf(*next)
+	for i := 0; i < updated.NumField(); i++ {
+		if !reflect.DeepEqual(reloaded.Field(i).Interface(), updated.Field(i).Interface()) {
+			changed = append(changed, updated.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	return changed
+}
@@ -0,0 +1,85 @@
+-- Upgrades a database created from the original Phase 1 schema to the
+-- current one. Run it before schema.sql on existing deployments;
+-- schema.sql then creates the new tables and views. Every statement is
+-- safe to repeat.
+
+USE trellis;
+
+-- Events: IPv6 client addresses (IPv4 becomes ::ffff:a.b.c.d)
+ALTER TABLE events MODIFY COLUMN ip IPv6;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS ip_version UInt8 MATERIALIZED if(startsWith(toString(ip), '::ffff:'), 4, 6) AFTER ip;
+
+-- Events: click IDs
+ALTER TABLE events ADD COLUMN IF NOT EXISTS event_type LowCardinality(String) DEFAULT 'click' AFTER organization_id;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS click_ids Map(String, String) AFTER click_id;
+
+-- Events: routing decision and shadow campaigns
+ALTER TABLE events ADD COLUMN IF NOT EXISTS routing_reason LowCardinality(String) DEFAULT '' AFTER campaign_id;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS routed_campaign_id String DEFAULT '' AFTER routing_reason;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS campaign_version UInt64 DEFAULT 0 AFTER routed_campaign_id;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS matched_rules Array(UInt16) AFTER campaign_version;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS match_score Int32 DEFAULT 0 AFTER matched_rules;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS variant LowCardinality(String) DEFAULT '' AFTER match_score;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS destination_url String DEFAULT '' AFTER variant;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS shadow_matches Nested(
+    campaign_id String,
+    score Int32,
+    would_win UInt8,
+    destination_url String
+) AFTER destination_url;
+
+-- Events: visitors and sessions
+ALTER TABLE events ADD COLUMN IF NOT EXISTS user_id String DEFAULT '' AFTER shadow_matches.destination_url;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS session_id String DEFAULT '' AFTER user_id;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS is_returning UInt8 DEFAULT 0 AFTER session_id;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS session_started_at Nullable(DateTime64(3)) AFTER is_returning;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS session_event_index UInt32 DEFAULT 0 AFTER session_started_at;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS landing_campaign_id Nullable(String) AFTER session_event_index;
+
+-- Events: bots and IP lists
+ALTER TABLE events ADD COLUMN IF NOT EXISTS bot_name Nullable(String) AFTER is_bot;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS ip_lists Array(LowCardinality(String)) AFTER bot_name;
+
+-- Events: per-organization retention
+ALTER TABLE events ADD COLUMN IF NOT EXISTS retention_days UInt16 DEFAULT 90 AFTER is_duplicate;
+ALTER TABLE events MODIFY TTL event_date + toIntervalDay(retention_days);
+
+ALTER TABLE events ADD INDEX IF NOT EXISTS idx_user_id user_id TYPE bloom_filter(0.01) GRANULARITY 1;
+ALTER TABLE events ADD INDEX IF NOT EXISTS idx_routed_campaign_id routed_campaign_id TYPE bloom_filter(0.01) GRANULARITY 1;
+
+-- Campaigns: variants, parameter forwarding, schedule, dedup and outbound postbacks
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS variants String DEFAULT '[]' AFTER append_params;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS forward_params Array(String) AFTER variants;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS block_params Array(String) AFTER forward_params;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS starts_at Nullable(DateTime64(3)) AFTER block_params;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS ends_at Nullable(DateTime64(3)) AFTER starts_at;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS dedup_window_seconds UInt32 DEFAULT 0 AFTER ends_at;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS dedup_key String DEFAULT '' AFTER dedup_window_seconds;
+ALTER TABLE campaigns ADD COLUMN IF NOT EXISTS outbound_postbacks String DEFAULT '[]' AFTER dedup_key;
+
+-- Postbacks: linking and fraud signals
+ALTER TABLE postbacks ADD COLUMN IF NOT EXISTS event_id String DEFAULT '' AFTER organization_id;
+ALTER TABLE postbacks ADD COLUMN IF NOT EXISTS partner_id String DEFAULT '' AFTER event_id;
+ALTER TABLE postbacks ADD COLUMN IF NOT EXISTS campaign_id String DEFAULT '' AFTER transaction_id;
+ALTER TABLE postbacks ADD COLUMN IF NOT EXISTS fraud_score Float32 DEFAULT 0 AFTER custom_data;
+ALTER TABLE postbacks ADD COLUMN IF NOT EXISTS fraud_flags Array(String) AFTER fraud_score;
+
+-- Hourly statistics: known bots are excluded from click counts
+SET allow_experimental_alter_materialized_view_structure = 1;
+ALTER TABLE events_hourly MODIFY QUERY
+SELECT
+    organization_id,
+    toStartOfHour(event_time) AS hour,
+    campaign_id,
+    source,
+    country,
+    device_type,
+    countIf(ifNull(is_bot, 0) = 0) AS clicks,
+    uniqIf(click_id, ifNull(is_bot, 0) = 0) AS unique_clicks,
+    uniq(ip) AS unique_ips,
+    countIf(is_bot = 1) AS bot_clicks,
+    countIf(is_duplicate = 1) AS duplicate_clicks,
+    avgIf(fraud_score, fraud_score IS NOT NULL) AS avg_fraud_score
+FROM events
+WHERE campaign_id IS NOT NULL
+GROUP BY organization_id, hour, campaign_id, source, country, device_type;
@@ -18,9 +18,36 @@ CREATE TABLE IF NOT EXISTS events
     organization_id String,
     
     -- Click tracking
-    click_id String,
+    event_type LowCardinality(String) DEFAULT 'click',
+    click_id String,  -- canonical Trellis click ID
+    click_ids Map(String, String),  -- network click IDs (gclid, fbclid, ...) by name
     campaign_id Nullable(String),
     
+    -- Routing decision for clicks (routing_reason: explicit, rules, default, fallback)
+    routing_reason LowCardinality(String) DEFAULT '',
+    routed_campaign_id String DEFAULT '',
+    campaign_version UInt64 DEFAULT 0,  -- campaign updated_at, unix milliseconds
+    matched_rules Array(UInt16),  -- indexes into the campaign's rules
+    match_score Int32 DEFAULT 0,
+    variant LowCardinality(String) DEFAULT '',
+    destination_url String DEFAULT '',
+    
+    -- Shadow campaigns whose rules matched the click, and whether they would have routed it
+    shadow_matches Nested(
+        campaign_id String,
+        score Int32,
+        would_win UInt8,
+        destination_url String
+    ),
+    
+    -- Visitor tracking
+    user_id String DEFAULT '',
+    session_id String DEFAULT '',
+    is_returning UInt8 DEFAULT 0,
+    session_started_at Nullable(DateTime64(3)),
+    session_event_index UInt32 DEFAULT 0,
+    landing_campaign_id Nullable(String),
+    
     -- Request information
     method String,
     url String,
@@ -29,8 +56,9 @@ CREATE TABLE IF NOT EXISTS events
     headers Map(String, String),
     body Nullable(String),
     
-    -- Network information
-    ip IPv4,
+    -- Network information (IPv4 clients are stored IPv4-mapped, ::ffff:a.b.c.d)
+    ip IPv6,
+    ip_version UInt8 MATERIALIZED if(startsWith(toString(ip), '::ffff:'), 4, 6),
     
     -- Enriched data (Phase 2)
     country Nullable(FixedString(2)),
@@ -44,8 +72,10 @@ CREATE TABLE IF NOT EXISTS events
     browser Nullable(String),
     browser_version Nullable(String),
     is_bot Nullable(UInt8),
+    bot_name Nullable(String),
     
     -- Fraud signals (Phase 2)
+    ip_lists Array(LowCardinality(String)),
     fraud_flags Array(String),
     fraud_score Nullable(Float32),
     
@@ -63,9 +93,14 @@ CREATE TABLE IF NOT EXISTS events
     -- Deduplication
     is_duplicate UInt8 DEFAULT 0,
     
+    -- Organization retention at ingest time, drives the TTL below
+    retention_days UInt16 DEFAULT 90,
+    
     -- Indexes for common queries
     INDEX idx_click_id click_id TYPE bloom_filter(0.01) GRANULARITY 1,
+    INDEX idx_user_id user_id TYPE bloom_filter(0.01) GRANULARITY 1,
     INDEX idx_campaign_id campaign_id TYPE bloom_filter(0.01) GRANULARITY 1,
+    INDEX idx_routed_campaign_id routed_campaign_id TYPE bloom_filter(0.01) GRANULARITY 1,
     INDEX idx_source source TYPE bloom_filter(0.01) GRANULARITY 1,
     INDEX idx_country country TYPE bloom_filter(0.01) GRANULARITY 1,
     INDEX idx_organization_id organization_id TYPE bloom_filter(0.01) GRANULARITY 1
@@ -74,7 +109,7 @@ ENGINE = MergeTree()
 PARTITION BY (toYYYYMM(event_date), organization_id)
 ORDER BY (organization_id, event_date, event_time, event_id)
 SAMPLE BY xxHash32(click_id)
-TTL event_date + INTERVAL 90 DAY
+TTL event_date + toIntervalDay(retention_days)
 SETTINGS index_granularity = 8192;
 
 -- Campaign definitions table
@@ -84,7 +119,7 @@ CREATE TABLE IF NOT EXISTS campaigns
     organization_id String,
     campaign_id String,
     name String,
-    status String,  -- active, paused, archived
+    status String,  -- active, shadow, paused, archived
     
     -- Rules stored as JSON
     rules String,  -- JSON array of matching rules
@@ -92,6 +127,20 @@ CREATE TABLE IF NOT EXISTS campaigns
     -- Destination
     destination_url String,
     append_params UInt8 DEFAULT 1,
+    variants String DEFAULT '[]',       -- JSON array of weighted destination variants
+    forward_params Array(String),       -- params appended to the destination (empty = all)
+    block_params Array(String),         -- params never appended; trailing * matches a prefix
+    
+    -- Schedule (campaign is live only inside this window)
+    starts_at Nullable(DateTime64(3)),
+    ends_at Nullable(DateTime64(3)),
+    
+    -- Deduplication overrides (0 / empty inherit organization settings)
+    dedup_window_seconds UInt32 DEFAULT 0,
+    dedup_key String DEFAULT '',
+    
+    -- Outbound postbacks to the traffic source (JSON array of templates)
+    outbound_postbacks String DEFAULT '[]',
     
     -- Metadata
     created_at DateTime64(3) DEFAULT now64(3),
@@ -107,6 +156,82 @@ ENGINE = ReplacingMergeTree(updated_at)
 ORDER BY (organization_id, campaign_id)
 SETTINGS index_granularity = 8192;
 
+-- Organization settings table
+CREATE TABLE IF NOT EXISTS organization_settings
+(
+    organization_id String,
+    
+    -- IANA timezone used for time-based routing rules
+    timezone String DEFAULT 'UTC',
+    
+    -- Deduplication (dedup_key: click_id, ip_ua, visitor)
+    dedup_window_seconds UInt32 DEFAULT 5,
+    dedup_key String DEFAULT 'click_id',
+    
+    -- Fraud policy
+    fraud_review_threshold Float32 DEFAULT 0.6,
+    fraud_block_threshold Float32 DEFAULT 0.9,
+    safe_page_url String DEFAULT '',
+    
+    -- Rate limit plan (empty uses the default plan)
+    plan LowCardinality(String) DEFAULT '',
+    
+    -- Click IDs: extra param mappings (JSON array of {param, name, source}) and
+    -- the destination param carrying the canonical click ID (empty disables it)
+    click_id_mappings String DEFAULT '[]',
+    click_id_param String DEFAULT 'trellis_click_id',
+    
+    -- Destination for unmatched clicks (template; empty answers 404)
+    default_destination_url String DEFAULT '',
+    
+    -- Parameter forwarding policy (campaign allow lists replace forward_params)
+    forward_params Array(String),
+    block_params Array(String),
+    
+    -- Data retention and PII (pii_policy: full, truncate_ip, drop_ip)
+    retention_days UInt16 DEFAULT 90,
+    pii_policy LowCardinality(String) DEFAULT 'full',
+    redact_params Array(String),
+    
+    updated_at DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY organization_id
+SETTINGS index_granularity = 8192;
+
+-- Organization IP allow and deny lists (removals are tombstone rows)
+CREATE TABLE IF NOT EXISTS ip_lists
+(
+    organization_id String,
+    kind LowCardinality(String), -- allow, deny
+    cidr String,
+    note String DEFAULT '',
+    created_by String DEFAULT '',
+    is_deleted UInt8 DEFAULT 0,
+    updated_at DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (organization_id, kind, cidr)
+SETTINGS index_granularity = 8192;
+
+-- Postback partners with their credentials (latest version per partner wins)
+CREATE TABLE IF NOT EXISTS postback_partners
+(
+    organization_id String,
+    partner_id String,
+    name String,
+    status LowCardinality(String),  -- active, disabled, deleted
+    auth_mode LowCardinality(String),  -- token, hmac
+    secret String,
+    allowed_ips Array(String),  -- CIDRs, empty allows any source
+    macros Map(String, String),  -- postback field -> partner macro
+    created_at DateTime64(3) DEFAULT now64(3),
+    updated_at DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (organization_id, partner_id)
+SETTINGS index_granularity = 8192;
+
 -- Discovered patterns table (Phase 3)
 CREATE TABLE IF NOT EXISTS discovered_patterns
 (
@@ -146,8 +271,11 @@ CREATE TABLE IF NOT EXISTS postbacks
     organization_id String,
     
     -- Linking
+    event_id String DEFAULT '',
+    partner_id String DEFAULT '',  -- sending partner, empty for API key postbacks
     click_id String,
     transaction_id Nullable(String),
+    campaign_id String DEFAULT '',  -- attributed from the click
     
     -- Postback data
     status String,
@@ -155,7 +283,11 @@ CREATE TABLE IF NOT EXISTS postbacks
     currency Nullable(String),
     custom_data Nullable(String),  -- JSON
     
-    -- Processing
+    -- Fraud signals
+    fraud_score Float32 DEFAULT 0,
+    fraud_flags Array(String),
+    
+    -- Processing (outbound delivery attempts are logged in postback_deliveries)
     processed UInt8 DEFAULT 0,
     retry_count UInt8 DEFAULT 0,
     last_retry_at Nullable(DateTime64(3)),
@@ -166,6 +298,99 @@ ENGINE = MergeTree()
 ORDER BY (organization_id, received_at, click_id)
 SETTINGS index_granularity = 8192;
 
+-- Outbound postback delivery log, one row per attempt
+CREATE TABLE IF NOT EXISTS postback_deliveries
+(
+    delivery_id String,
+    organization_id String,
+    postback_id String,
+    campaign_id String,
+    click_id String,
+    
+    -- Attempt
+    attempt UInt16,  -- 0 when queued
+    state LowCardinality(String),  -- pending, retrying, delivered, failed
+    attempted_at DateTime64(3) DEFAULT now64(3),
+    next_attempt_at Nullable(DateTime64(3)),
+    
+    -- Request
+    method LowCardinality(String),
+    url String,
+    content_type String DEFAULT '',
+    body String DEFAULT '',
+    headers Map(String, String),
+    
+    -- Response
+    status_code UInt16 DEFAULT 0,
+    error String DEFAULT '',
+    response String DEFAULT '',  -- first 1KB
+    duration_ms UInt32 DEFAULT 0,
+    
+    INDEX idx_postback_id postback_id TYPE bloom_filter(0.01) GRANULARITY 1
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(attempted_at)
+ORDER BY (organization_id, delivery_id, attempted_at)
+TTL toDateTime(attempted_at) + INTERVAL 90 DAY
+SETTINGS index_granularity = 8192;
+
+-- Retroactive attribution runs (latest row per version wins); version is a
+-- unique run ID
+CREATE TABLE IF NOT EXISTS attribution_runs
+(
+    organization_id String,
+    campaign_id String,
+    version String,
+    
+    -- Campaign rules the run applied (JSON array) and their hash
+    rules String,
+    rules_hash String,
+    
+    -- Event time window, from inclusive to exclusive
+    window_from DateTime64(3),
+    window_to DateTime64(3),
+    
+    state LowCardinality(String),  -- running, completed, failed
+    matched UInt64 DEFAULT 0,
+    error String DEFAULT '',
+    
+    created_at DateTime64(3) DEFAULT now64(3),
+    updated_at DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (organization_id, campaign_id, version)
+SETTINGS index_granularity = 8192;
+
+-- Events attributed to campaigns by attribution runs; events are never mutated
+CREATE TABLE IF NOT EXISTS campaign_attributions
+(
+    organization_id String,
+    campaign_id String,
+    version String,
+    event_id UUID,
+    event_time DateTime64(3),
+    click_id String,
+    match_reason LowCardinality(String),  -- recorded, rules
+    score Int32 DEFAULT 0,
+    attributed_at DateTime64(3) DEFAULT now64(3)
+)
+ENGINE = MergeTree()
+PARTITION BY toYYYYMM(event_time)
+ORDER BY (organization_id, campaign_id, version, event_time, event_id)
+SETTINGS index_granularity = 8192;
+
+-- Attributions of the latest completed run per campaign; rows of running or
+-- failed runs are never visible
+CREATE VIEW IF NOT EXISTS current_campaign_attributions AS
+SELECT a.*
+FROM campaign_attributions AS a
+WHERE (a.organization_id, a.campaign_id, a.version) IN (
+    SELECT organization_id, campaign_id, argMax(version, created_at)
+    FROM attribution_runs FINAL
+    WHERE state = 'completed'
+    GROUP BY organization_id, campaign_id
+);
+
 -- Materialized view for hourly statistics (Phase 2)
 CREATE MATERIALIZED VIEW IF NOT EXISTS events_hourly
 ENGINE = SummingMergeTree()
@@ -180,9 +405,9 @@ SELECT
     country,
     device_type,
     
-    -- Metrics
-    count() AS clicks,
-    uniq(click_id) AS unique_clicks,
+    -- Metrics (known bots are stored but excluded from click counts)
+    countIf(ifNull(is_bot, 0) = 0) AS clicks,
+    uniqIf(click_id, ifNull(is_bot, 0) = 0) AS unique_clicks,
     uniq(ip) AS unique_ips,
     countIf(is_bot = 1) AS bot_clicks,
     countIf(is_duplicate = 1) AS duplicate_clicks,
@@ -191,6 +416,29 @@ FROM events
 WHERE campaign_id IS NOT NULL
 GROUP BY organization_id, hour, campaign_id, source, country, device_type;
 
+-- Materialized view for visitor sessions
+-- Sessions are split by the ingress inactivity gap
+-- (TRACKING_SESSION_TIMEOUT_MINUTES) and every event carries its session's
+-- start, so all of a session's rows share one key however many inserts or
+-- days it spans. Session end is the last event seen.
+CREATE MATERIALIZED VIEW IF NOT EXISTS sessions
+ENGINE = AggregatingMergeTree()
+PARTITION BY (toYYYYMM(session_date), organization_id)
+ORDER BY (organization_id, session_date, session_id, user_id)
+AS
+SELECT
+    organization_id,
+    toDate(assumeNotNull(session_started_at)) AS session_date,
+    session_id,
+    user_id,
+    minState(event_time) AS session_start,
+    maxState(event_time) AS session_end,
+    countState() AS events,
+    argMinState(landing_campaign_id, session_event_index) AS landing_campaign_id
+FROM events
+WHERE session_id != '' AND session_started_at IS NOT NULL
+GROUP BY organization_id, session_date, session_id, user_id;
+
 -- System metrics table for monitoring
 CREATE TABLE IF NOT EXISTS system_metrics
 (